@@ -3,7 +3,9 @@
 // By default, `autometrics` generates metric collection code for usage with the
 // [Prometheus client library]. If you want to use [OpenTelemetry metrics]
 // instead (with a prometheus exporter for the metrics), pass the `--otel` flag
-// to the invocation.
+// to the invocation, and to send the metrics to a [StatsD] agent (with [DogStatsD] tags),
+// pass the `--statsd` flag. Other backends, that expose the same API as the Prometheus one,
+// are used by passing their import path with the `--backend` flag.
 //
 // By default, when activating Service Level Objectives (SLOs) `autometrics`
 // does not allow to use latency targets that are outside the default latencies
@@ -11,6 +13,12 @@
 // your latency SLOs, pass the `--custom-latency` flag to the invocation.
 //
 // It is meant to be used in a Go generator context. As such, it takes mandatory arguments in the form of environment variables.
+// It can also transform whole packages at once when given package patterns, like `autometrics ./...`: in that case every
+// file containing `//autometrics:` directives in the matching packages is transformed.
+//
+// To check in CI that the generated code is up to date, pass the `--check` flag to the
+// invocation. No file is written then, and `autometrics` exits with an error and prints a
+// unified diff for every file that differs from the generator output.
 // You can also control the base URL of the prometheus instance in doc comments with an environment variable.
 //
 //	Note: If you do not use the custom latencies in the SLO, the allowed latencies (in seconds) are in [autometrics.DefBuckets].
@@ -18,22 +26,36 @@
 // Check https://github.com/autometrics-dev/autometrics-go for more help (including examples) and information.
 // Autometrics is built by Fiberplane -- https://autometrics.dev
 //
-// Usage: autometrics -f FILE_NAME -m MODULE_NAME [--prom_url PROMETHEUS_URL] [--otel] [--custom-latency]
+// Usage: autometrics [-f FILE_NAME] [-m MODULE_NAME] [--prom_url PROMETHEUS_URL] [--otel] [--statsd] [--backend IMPORT_PATH] [--custom-latency] [--no-doc] [--inst-all] [--rm-all] [PACKAGES [PACKAGES ...]]
+//
+// Positional arguments:
+//
+//	PACKAGES               Packages to transform, in 'go list' syntax (e.g. ./...). If absent, only the file given by FILE_NAME is transformed.
 //
 // Options:
 //
-//	-f FILE_NAME           File to transform. [env: GOFILE]
-//	-m MODULE_NAME         Module containing the file to transform. [env: GOPACKAGE]
+//	-f FILE_NAME           File to transform. Mandatory if no PACKAGES are given. [env: GOFILE]
+//	-m MODULE_NAME         Module containing the file to transform. Mandatory if no PACKAGES are given. [env: GOPACKAGE]
 //	--prom_url PROMETHEUS_URL
 //	                       Base URL of the Prometheus instance to generate links to. [default: http://localhost:9090, env: AM_PROMETHEUS_URL]
 //	--otel                 Use [OpenTelemetry client library] to instrument code instead of default [Prometheus client library]. [default: false]
+//	--statsd               Use StatsD (with DogStatsD tags) to instrument code instead of default Prometheus. [default: false]
+//	--backend IMPORT_PATH  Import path of the autometrics backend to instrument code with, instead of the Prometheus, OpenTelemetry or StatsD ones. Overrides --otel and --statsd. [env: AM_BACKEND]
 //	--custom-latency       Allow non-default latencies to be used in latency-based SLOs. [default: false]
+//	--no-doc               Disable documentation links generation for all instrumented functions. [default: false, env: AM_NO_DOCGEN]
+//	--inst-all, -i         Instrument all function declared in the file to transform. [default: false, env: AM_INSTRUMENT_ALL]
+//	--rm-all               Remove all function instrumentation in the file to transform. [default: false, env: AM_RM_ALL]
+//	--name-errors          Name the unnamed error return values of instrumented functions, so that errors are reported. [default: false, env: AM_NAME_ERRORS]
+//	--error-kinds          Add the "Errors by Kind" link to the documentation of all instrumented functions, for programs that register error kinds in their Init call. [default: false, env: AM_ERROR_KINDS]
+//	--check                Do not write any file, but exit with an error and print a diff if a file is not up to date with the generator output. [default: false, env: AM_CHECK]
 //	--help, -h             display this help and exit
 //	--version              display version and exit
 //
 // [Prometheus client library]: https://github.com/prometheus/client_golang
 // [OpenTelemetry metrics]: https://opentelemetry.io/docs/instrumentation/go/
 // [autometrics.DefBuckets]: https://godoc.org/github.com/autometrics-dev/autometrics-go/pkg/autometrics#DefBuckets
+// [StatsD]: https://github.com/statsd/statsd
+// [DogStatsD]: https://docs.datadoghq.com/developers/dogstatsd/
 //
 // [OpenTelemetry client library]: https://github.com/open-telemetry/opentelemetry-go
 package main
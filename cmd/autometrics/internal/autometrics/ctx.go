@@ -1,4 +1,4 @@
-package autometrics // import "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+package autometrics // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 
 import (
 	"errors"
@@ -20,8 +20,11 @@ type GeneratorContext struct {
 	//
 	// Notably, it contains all the data relative to the parsing of the arguments in the directive.
 	FuncCtx GeneratorFunctionContext
-	// Implementation is the metrics library we expect to use in the instrumented code.
-	Implementation autometrics.Implementation
+	// BackendPackage is the import path of the autometrics backend we expect to use in the instrumented code.
+	//
+	// Any package exposing the same API as the Prometheus and OpenTelemetry backends can be used, so new
+	// backends do not need to be known by the generator.
+	BackendPackage string
 	// DocumentationGenerator is the generator to use to generate comments.
 	DocumentationGenerator AutometricsLinkCommentGenerator
 	// Allow the autometrics directive to have latency targets outside the default buckets.
@@ -36,6 +39,16 @@ type GeneratorContext struct {
 	// Flag to ask the generator to only remove all autometrics generated code in the
 	// file.
 	RemoveEverything bool
+	// Flag to ask the generator to name the unnamed `error` return values of all
+	// instrumented functions, so that errors are reported in the metrics.
+	//
+	// This can be set in the command for the generator or through the environment.
+	NameUnnamedErrors bool
+	// Flag to ask the generator to add the "Errors by Kind" link to the documentation of all
+	// instrumented functions, for the programs that register error kinds in their Init call.
+	//
+	// This can be set in the command for the generator or through the environment.
+	ErrorKindsDoc bool
 	// ImportMap maps the alias to import in the current file, to canonical names associated with that name.
 	ImportsMap map[string]string
 }
@@ -141,21 +154,35 @@ type GeneratorFunctionContext struct {
 	ModuleName           string
 	ImplImportName       string
 	DisableDocGeneration bool
+	NameUnnamedError     bool
+	ErrorKindsDoc        bool
 }
 
 func (c *GeneratorContext) ResetFuncCtx() {
 	c.FuncCtx.CommentIndex = -1
 	c.FuncCtx.FunctionName = ""
 	c.FuncCtx.ModuleName = ""
+	c.FuncCtx.NameUnnamedError = false
+	c.FuncCtx.ErrorKindsDoc = false
 }
 
 func (c *GeneratorContext) SetCommentIdx(i int) {
 	c.FuncCtx.CommentIndex = i
 }
 
+// implementationPackages are the import paths of the backends shipped with autometrics.
+var implementationPackages = map[autometrics.Implementation]string{
+	autometrics.PROMETHEUS: "github.com/autometrics-dev/autometrics-go/prometheus/autometrics",
+	autometrics.OTEL:       "github.com/autometrics-dev/autometrics-go/otel/autometrics",
+	autometrics.STATSD:     "github.com/autometrics-dev/autometrics-go/statsd/autometrics",
+}
+
+// NewGeneratorContext returns the context of the generator for the given implementation.
+//
+// To use another backend, set the BackendPackage of the returned context.
 func NewGeneratorContext(implementation autometrics.Implementation, prometheusUrl string, allowCustomLatencies, disableDocGeneration, instrumentEverything, removeEverything bool) (GeneratorContext, error) {
 	ctx := GeneratorContext{
-		Implementation:       implementation,
+		BackendPackage:       implementationPackages[implementation],
 		AllowCustomLatencies: allowCustomLatencies,
 		DisableDocGeneration: disableDocGeneration,
 		InstrumentEverything: instrumentEverything,
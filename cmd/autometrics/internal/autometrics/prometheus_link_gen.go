@@ -1,4 +1,4 @@
-package autometrics // import "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+package autometrics // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 
 import (
 	"fmt"
@@ -84,6 +84,22 @@ func errorRatioQuery(counterName, labelKey, labelValue string) string {
 	)
 }
 
+func errorKindsQuery(counterName, labelKey, labelValue string) string {
+	return fmt.Sprintf("sum by (%s, %s, %s, %s, %s, %s) (rate(%s{%s=\"%s\",%s=\"error\"}[5m]) %s)",
+		prometheus.ErrorKindLabel,
+		prometheus.FunctionLabel,
+		prometheus.ModuleLabel,
+		prometheus.ServiceNameLabel,
+		prometheus.VersionLabel,
+		prometheus.CommitLabel,
+		counterName,
+		labelKey,
+		labelValue,
+		prometheus.ResultLabel,
+		addBuildInfoLabels(),
+	)
+}
+
 func latencyQuery(bucketName, labelKey, labelValue string) string {
 	latency := fmt.Sprintf("sum by (le, %s, %s, %s, %s, %s) (rate(%s_bucket{%s=\"%s\"}[5m]) %s)",
 		prometheus.FunctionLabel,
@@ -126,6 +142,8 @@ func (p Prometheus) GenerateAutometricsComment(ctx GeneratorContext, funcName, m
 		requestRateQuery(prometheus.FunctionCallsCountName, prometheus.CallerFunctionLabel, funcName), fmt.Sprintf("Rate of function calls emanating from `%s` function per second, averaged over 5 minute windows", funcName))
 	errorRatioUrl := p.makePrometheusUrl(
 		errorRatioQuery(prometheus.FunctionCallsCountName, prometheus.FunctionLabel, funcName), fmt.Sprintf("Percentage of calls to the `%s` function that return errors, averaged over 5 minute windows", funcName))
+	errorKindsUrl := p.makePrometheusUrl(
+		errorKindsQuery(prometheus.FunctionCallsCountName, prometheus.FunctionLabel, funcName), fmt.Sprintf("Rate of errors returned by the `%s` function per second, broken down by error kind, averaged over 5 minute windows", funcName))
 	calleeErrorRatioUrl := p.makePrometheusUrl(
 		errorRatioQuery(prometheus.FunctionCallsCountName, prometheus.CallerFunctionLabel, funcName), fmt.Sprintf("Percentage of function emanating from `%s` function that return errors, averaged over 5 minute windows", funcName))
 	latencyUrl := p.makePrometheusUrl(
@@ -140,8 +158,15 @@ func (p Prometheus) GenerateAutometricsComment(ctx GeneratorContext, funcName, m
 		fmt.Sprintf("// View the live metrics for the `%s` function:", funcName),
 		"//   - [Request Rate]",
 		"//   - [Error Ratio]",
-		"//   - [Latency (95th and 99th percentiles)]",
 	}
+	if ctx.ErrorKindsDoc || ctx.FuncCtx.ErrorKindsDoc {
+		retval = append(retval,
+			"//   - [Errors by Kind]",
+		)
+	}
+	retval = append(retval,
+		"//   - [Latency (95th and 99th percentiles)]",
+	)
 	if ctx.RuntimeCtx.TrackConcurrentCalls {
 		retval = append(retval,
 			"//   - [Concurrent Calls]",
@@ -158,6 +183,15 @@ func (p Prometheus) GenerateAutometricsComment(ctx GeneratorContext, funcName, m
 		"//",
 		fmt.Sprintf("// [Request Rate]: %s", requestRateUrl.String()),
 		fmt.Sprintf("// [Error Ratio]: %s", errorRatioUrl.String()),
+	)
+
+	if ctx.ErrorKindsDoc || ctx.FuncCtx.ErrorKindsDoc {
+		retval = append(retval,
+			fmt.Sprintf("// [Errors by Kind]: %s", errorKindsUrl.String()),
+		)
+	}
+
+	retval = append(retval,
 		fmt.Sprintf("// [Latency (95th and 99th percentiles)]: %s", latencyUrl.String()),
 	)
 
@@ -177,5 +211,5 @@ func (p Prometheus) GenerateAutometricsComment(ctx GeneratorContext, funcName, m
 }
 
 func (p Prometheus) GeneratedLinks() []string {
-	return []string{"Request Rate", "Error Ratio", "Latency (95th and 99th percentiles)", "Concurrent Calls", "Request Rate Callee", "Error Ratio Callee"}
+	return []string{"Request Rate", "Error Ratio", "Errors by Kind", "Latency (95th and 99th percentiles)", "Concurrent Calls", "Request Rate Callee", "Error Ratio Callee"}
 }
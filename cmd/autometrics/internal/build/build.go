@@ -1,4 +1,4 @@
-package build // import "github.com/autometrics-dev/autometrics-go/internal/build"
+package build // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/build"
 
 // Version is the version string of the build, when made available through ldflags.
 var Version = "1.1.0"
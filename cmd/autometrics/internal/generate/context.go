@@ -1,4 +1,4 @@
-package generate // import "github.com/autometrics-dev/autometrics-go/internal/generate"
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 
 import (
 	"fmt"
@@ -9,7 +9,7 @@ import (
 
 	"golang.org/x/exp/slices"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 
 	"github.com/dave/dst"
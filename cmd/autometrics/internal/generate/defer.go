@@ -0,0 +1,276 @@
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
+
+	"github.com/dave/dst"
+)
+
+const (
+	deferDecoration      = "//autometrics:defer"
+	generatedErrorPrefix = "amErr"
+)
+
+// injectDeferStatement add all the necessary information into context to produce the correct defer instrumentation statement.
+//
+// injectDeferStatement is _always_ meant to be called after injectContextStatement, so the injection will always try to happen after the
+// statemtent marked with the shadowing marker
+func injectDeferStatement(ctx *internal.GeneratorContext, funcDeclaration *dst.FuncDecl) error {
+	contextAssignmentIndex, found := findContextStatement(ctx, funcDeclaration)
+	if !found {
+		return fmt.Errorf("getting context: the %v statement is missing", contextDecoration)
+	}
+
+	variable, err := errorReturnValueName(funcDeclaration)
+	if err != nil {
+		return fmt.Errorf("getting error return value name: %w", err)
+	}
+
+	if len(variable) == 0 && (ctx.NameUnnamedErrors || ctx.FuncCtx.NameUnnamedError) {
+		variable, err = nameErrorReturnValue(funcDeclaration)
+		if err != nil {
+			return fmt.Errorf("naming the error return value: %w", err)
+		}
+	}
+
+	if len(variable) == 0 {
+		variable = "nil"
+	} else {
+		variable = "&" + variable
+	}
+
+	autometricsDeferStatement, err := buildAutometricsDeferStatement(ctx, variable)
+	if err != nil {
+		return fmt.Errorf("building the defer statement for instrumentation: %w", err)
+	}
+
+	funcDeclaration.Body.List = insertStatements(funcDeclaration.Body.List, contextAssignmentIndex+1, []dst.Stmt{&autometricsDeferStatement})
+	return nil
+}
+
+func insertStatements(inputArray []dst.Stmt, index int, values []dst.Stmt) []dst.Stmt {
+	if len(inputArray) == index { // nil or empty slice or after last element
+		return append(inputArray, values...)
+	}
+
+	beginning := inputArray[:index]
+	// Maybe the deep copy is not necessary, wasn't able to
+	// specify the semantics properly here.
+	end := make([]dst.Stmt, len(inputArray[index:]))
+	copy(end, inputArray[index:])
+
+	inputArray = append(beginning, values...)
+	inputArray = append(inputArray, end...)
+
+	return inputArray
+}
+
+// removeDeferStatement removes, if detected, a previously injected defer statement.
+func removeDeferStatement(ctx *internal.GeneratorContext, funcDeclaration *dst.FuncDecl) error {
+	for index, statement := range funcDeclaration.Body.List {
+		if deferStatement, ok := statement.(*dst.DeferStmt); ok {
+			decorations := deferStatement.Decorations().End
+			if slices.Contains(decorations.All(), deferDecoration) {
+				funcDeclaration.Body.List = append(funcDeclaration.Body.List[:index], funcDeclaration.Body.List[index+1:]...)
+				if name, ok := deferErrorPointerName(deferStatement); ok {
+					unnameErrorReturnValue(funcDeclaration, name)
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// errorReturnValueName returns the name of the error return value if it exists.
+func errorReturnValueName(funcNode *dst.FuncDecl) (string, error) {
+	returnValues := funcNode.Type.Results
+	if returnValues == nil || returnValues.List == nil {
+		return "", nil
+	}
+
+	for _, field := range returnValues.List {
+		fieldType := field.Type
+		if spec, ok := fieldType.(*dst.Ident); ok {
+			if spec.Name == "error" {
+				// Assuming that the `error` type has 0 or 1 name before it.
+				if field.Names == nil {
+					return "", nil
+				} else if len(field.Names) > 1 {
+					return "", fmt.Errorf("expecting a single named `error` return value, got %d instead.", len(field.Names))
+				}
+				return field.Names[0].Name, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// nameErrorReturnValue gives a name to the unnamed `error` return value of the function, and returns that name.
+//
+// As Go does not allow mixing named and unnamed return values, all the other return values are named `_`. The chosen
+// name starts with generatedErrorPrefix and does not collide with any identifier used in the function.
+func nameErrorReturnValue(funcNode *dst.FuncDecl) (string, error) {
+	returnValues := funcNode.Type.Results
+	if returnValues == nil || returnValues.List == nil {
+		return "", nil
+	}
+
+	errorIndex := -1
+	for i, field := range returnValues.List {
+		if len(field.Names) > 0 {
+			return "", fmt.Errorf("expecting all return values to be unnamed, got %v named", field.Names[0].Name)
+		}
+		if spec, ok := field.Type.(*dst.Ident); ok && spec.Name == "error" {
+			if errorIndex != -1 {
+				return "", errors.New("expecting a single unnamed `error` return value, got multiple.")
+			}
+			errorIndex = i
+		}
+	}
+
+	if errorIndex == -1 {
+		return "", nil
+	}
+
+	usedNames := make(map[string]bool)
+	dst.Inspect(funcNode, func(node dst.Node) bool {
+		if ident, ok := node.(*dst.Ident); ok {
+			usedNames[ident.Name] = true
+		}
+		return true
+	})
+
+	name := generatedErrorPrefix
+	for i := 1; usedNames[name]; i++ {
+		name = fmt.Sprintf("%s%d", generatedErrorPrefix, i)
+	}
+
+	for i, field := range returnValues.List {
+		if i == errorIndex {
+			field.Names = []*dst.Ident{dst.NewIdent(name)}
+		} else {
+			field.Names = []*dst.Ident{dst.NewIdent("_")}
+		}
+	}
+
+	return name, nil
+}
+
+// unnameErrorReturnValue reverts the effects of nameErrorReturnValue, if the `error` return value called name
+// has been named by the generator.
+//
+// The names are only removed when it is safe, i.e. when the only named return value is the generated one,
+// and the function body neither uses it nor contains bare return statements.
+func unnameErrorReturnValue(funcNode *dst.FuncDecl, name string) {
+	if !strings.HasPrefix(name, generatedErrorPrefix) {
+		return
+	}
+
+	returnValues := funcNode.Type.Results
+	if returnValues == nil || returnValues.List == nil {
+		return
+	}
+
+	for _, field := range returnValues.List {
+		if len(field.Names) != 1 {
+			return
+		}
+		fieldName := field.Names[0].Name
+		if fieldName == "_" {
+			continue
+		}
+		spec, ok := field.Type.(*dst.Ident)
+		if fieldName != name || !ok || spec.Name != "error" {
+			return
+		}
+	}
+
+	safe := true
+	dst.Inspect(funcNode.Body, func(node dst.Node) bool {
+		if ident, ok := node.(*dst.Ident); ok && ident.Name == name {
+			safe = false
+		}
+		return safe
+	})
+	dst.Inspect(funcNode.Body, func(node dst.Node) bool {
+		switch n := node.(type) {
+		case *dst.FuncLit:
+			// Bare returns in function literals refer to the literal's own return values.
+			return false
+		case *dst.ReturnStmt:
+			if len(n.Results) == 0 {
+				safe = false
+			}
+		}
+		return safe
+	})
+
+	if !safe {
+		return
+	}
+
+	for _, field := range returnValues.List {
+		field.Names = nil
+	}
+}
+
+// deferErrorPointerName returns the name of the variable whose address is passed to the defer instrumentation statement.
+func deferErrorPointerName(deferStatement *dst.DeferStmt) (string, bool) {
+	if deferStatement.Call == nil || len(deferStatement.Call.Args) < 2 {
+		return "", false
+	}
+
+	switch arg := deferStatement.Call.Args[1].(type) {
+	case *dst.UnaryExpr:
+		if ident, ok := arg.X.(*dst.Ident); ok && arg.Op == token.AND {
+			return ident.Name, true
+		}
+	case *dst.Ident:
+		// Statements built by the generator use a single identifier for the pointer.
+		if name, found := cutPrefix(arg.Name, "&"); found {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// buildAutometricsDeferStatement builds the AST node for the defer instrumentation statement to be inserted.
+func buildAutometricsDeferStatement(ctx *internal.GeneratorContext, errorPointerVariable string) (dst.DeferStmt, error) {
+	_, contextName, err := buildAutometricsContextNode(ctx)
+	if err != nil {
+		return dst.DeferStmt{}, fmt.Errorf("could not generate the runtime context value: %w", err)
+	}
+	statement := dst.DeferStmt{
+		Call: &dst.CallExpr{
+			Fun: dst.NewIdent(fmt.Sprintf("%vInstrument", autometricsNamespacePrefix(ctx))),
+			Args: []dst.Expr{
+				dst.NewIdent(contextName),
+				dst.NewIdent(errorPointerVariable),
+			},
+		},
+	}
+
+	statement.Decs.Before = dst.NewLine
+	statement.Decs.End = []string{deferDecoration}
+	statement.Decs.After = dst.EmptyLine
+
+	return statement, nil
+}
+
+func autometricsNamespacePrefix(ctx *internal.GeneratorContext) string {
+	if ctx.FuncCtx.ImplImportName == "_" {
+		return ""
+	} else {
+		return fmt.Sprintf("%v.", ctx.FuncCtx.ImplImportName)
+	}
+}
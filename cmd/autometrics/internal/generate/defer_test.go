@@ -5,7 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 )
 
@@ -890,3 +890,173 @@ func main(thisIsAContext *Context) {
 
 	assert.Equal(t, want, actual, "The generated source code is not as expected.")
 }
+
+// TestNameUnnamedError tests that autometrics names the unnamed error return value
+// when asked to, without colliding with existing identifiers.
+func TestNameUnnamedError(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+//autometrics:inst --no-doc --name-error
+func main(amErr int) (int, error) {
+	return amErr, nil
+}
+`
+
+	want := "// This is the package comment.\n" +
+		"package main\n" +
+		"\n" +
+		"import (\n" +
+		"\tprom \"github.com/autometrics-dev/autometrics-go/prometheus/autometrics\"\n" +
+		")\n" +
+		"\n" +
+		"//autometrics:inst --no-doc --name-error\n" +
+		"func main(amErr int) (_ int, amErr1 error) {\n" +
+		"\tamCtx := prom.PreInstrument(prom.NewContext(\n" +
+		"\t\tnil,\n" +
+		"\t\tprom.WithConcurrentCalls(true),\n" +
+		"\t\tprom.WithCallerName(true),\n" +
+		"\t)) //autometrics:shadow-ctx\n" +
+		"\tdefer prom.Instrument(amCtx, &amErr1) //autometrics:defer\n" +
+		"\n" +
+		"\treturn amErr, nil\n" +
+		"}\n"
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+
+	// Running the generator again must be idempotent
+	actual, err = GenerateDocumentationAndInstrumentation(ctx, actual, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation a second time: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected after a second pass.")
+
+	// Removing the instrumentation must restore the original signature
+	ctx.RemoveEverything = true
+	actual, err = GenerateDocumentationAndInstrumentation(ctx, actual, "main")
+	if err != nil {
+		t.Fatalf("error removing the instrumentation: %s", err)
+	}
+
+	assert.Contains(t, actual, "func main(amErr int) (int, error) {\n", "The original signature is not restored.")
+}
+
+// TestNameUnnamedErrorGlobalFlag tests that the generator-wide flag names the error
+// return values of all instrumented functions only.
+func TestNameUnnamedErrorGlobalFlag(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+//autometrics:inst --no-doc
+func instrumented() error {
+	return nil
+}
+
+func notInstrumented() error {
+	return nil
+}
+`
+
+	want := "// This is the package comment.\n" +
+		"package main\n" +
+		"\n" +
+		"import (\n" +
+		"\tprom \"github.com/autometrics-dev/autometrics-go/prometheus/autometrics\"\n" +
+		")\n" +
+		"\n" +
+		"//autometrics:inst --no-doc\n" +
+		"func instrumented() (amErr error) {\n" +
+		"\tamCtx := prom.PreInstrument(prom.NewContext(\n" +
+		"\t\tnil,\n" +
+		"\t\tprom.WithConcurrentCalls(true),\n" +
+		"\t\tprom.WithCallerName(true),\n" +
+		"\t)) //autometrics:shadow-ctx\n" +
+		"\tdefer prom.Instrument(amCtx, &amErr) //autometrics:defer\n" +
+		"\n" +
+		"\treturn nil\n" +
+		"}\n" +
+		"\n" +
+		"func notInstrumented() error {\n" +
+		"\treturn nil\n" +
+		"}\n"
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+	ctx.NameUnnamedErrors = true
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
+
+// TestUnnameErrorKeepsBareReturns tests that autometrics does not remove the name of
+// an error return value when the function relies on it.
+func TestUnnameErrorKeepsBareReturns(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+func main() (_ int, amErr error) {
+	amCtx := prom.PreInstrument(prom.NewContext(
+		nil,
+		prom.WithConcurrentCalls(true),
+		prom.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer prom.Instrument(amCtx, &amErr) //autometrics:defer
+
+	return
+}
+`
+
+	want := `// This is the package comment.
+package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+func main() (_ int, amErr error) {
+
+	return
+}
+`
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, true)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
@@ -1,11 +1,11 @@
-package generate // import "github.com/autometrics-dev/autometrics-go/internal/generate"
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 
 import (
 	"fmt"
 	"math"
 	"strings"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 
 	"github.com/dave/dst"
 )
@@ -1,16 +1,18 @@
-package generate // import "github.com/autometrics-dev/autometrics-go/internal/generate"
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/shlex"
+	"github.com/pmezard/go-difflib/difflib"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 
 	"github.com/dave/dst"
@@ -23,9 +25,12 @@ const (
 	LatencyMsArgument  = "--latency-ms"
 	LatencyObjArgument = "--latency-target"
 	NoDocArgument      = "--no-doc"
+	NameErrorArgument  = "--name-error"
+	ErrorKindsArgument = "--error-kinds"
 
-	AmPromPackage = "\"github.com/autometrics-dev/autometrics-go/prometheus/autometrics\""
-	AmOtelPackage = "\"github.com/autometrics-dev/autometrics-go/otel/autometrics\""
+	AmPromPackage   = "\"github.com/autometrics-dev/autometrics-go/prometheus/autometrics\""
+	AmOtelPackage   = "\"github.com/autometrics-dev/autometrics-go/otel/autometrics\""
+	AmStatsdPackage = "\"github.com/autometrics-dev/autometrics-go/statsd/autometrics\""
 )
 
 type GenerateError struct {
@@ -45,40 +50,94 @@ func (errs GenerateErrors) Error() string {
 	return sb.String()
 }
 
+// StaleFileError is returned when checking a file whose content differs
+// from the output of the generator.
+type StaleFileError struct {
+	FileName string
+	// Diff is the unified diff from the current content of the file to the
+	// generator output.
+	Diff string
+}
+
+func (err *StaleFileError) Error() string {
+	return fmt.Sprintf("%v is not up to date with the autometrics generator output", err.FileName)
+}
+
 // TransformFile takes a file path and generates the documentation
 // for the `//autometrics:inst` functions.
 //
 // It also replaces the file in place.
 func TransformFile(ctx internal.GeneratorContext, path, moduleName string) error {
-	cwd, err := os.Getwd()
+	sourceCode, permissions, err := readSourceFile(path)
 	if err != nil {
-		return fmt.Errorf("error getting a working directory: %w", err)
+		return err
 	}
 
-	info, err := os.Stat(path)
+	transformedSource, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, moduleName)
 	if err != nil {
-		return fmt.Errorf("error reading file information from %s: %w", path, err)
+		return fmt.Errorf("errors generating instrumentation and documentation: %w", err)
 	}
 
-	permissions := info.Mode()
+	err = os.WriteFile(path, []byte(transformedSource), permissions)
+	if err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
 
-	sourceBytes, err := os.ReadFile(path)
+	return nil
+}
+
+// CheckFile takes a file path and checks that the documentation and
+// instrumentation for the `//autometrics:inst` functions are up to date.
+//
+// The file is never modified. If the generator would change the file, the
+// returned error is a [*StaleFileError] containing the unified diff between
+// the file on disk and the generator output.
+func CheckFile(ctx internal.GeneratorContext, path, moduleName string) error {
+	sourceCode, _, err := readSourceFile(path)
 	if err != nil {
-		return fmt.Errorf("error reading the source code from %s (cwd: %s): %w", path, cwd, err)
+		return err
 	}
 
-	sourceCode := string(sourceBytes)
 	transformedSource, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, moduleName)
 	if err != nil {
 		return fmt.Errorf("errors generating instrumentation and documentation: %w", err)
 	}
 
-	err = os.WriteFile(path, []byte(transformedSource), permissions)
+	if transformedSource == sourceCode {
+		return nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(sourceCode),
+		B:        difflib.SplitLines(transformedSource),
+		FromFile: path,
+		ToFile:   path + " (generated)",
+		Context:  3,
+	})
 	if err != nil {
-		return fmt.Errorf("error writing file: %w", err)
+		return fmt.Errorf("error computing the diff of %s: %w", path, err)
 	}
 
-	return nil
+	return &StaleFileError{FileName: path, Diff: diff}
+}
+
+func readSourceFile(path string) (string, fs.FileMode, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", 0, fmt.Errorf("error getting a working directory: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading file information from %s: %w", path, err)
+	}
+
+	sourceBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading the source code from %s (cwd: %s): %w", path, cwd, err)
+	}
+
+	return string(sourceBytes), info.Mode(), nil
 }
 
 // GenerateDocumentationAndInstrumentation takes the raw source code from a file and generates
@@ -142,21 +201,9 @@ func GenerateDocumentationAndInstrumentation(ctx internal.GeneratorContext, sour
 // walkFuncDeclaration uses the context to generate documentation and code if necessary for a function declaration in a file.
 func walkFuncDeclaration(ctx *internal.GeneratorContext, funcDeclaration *dst.FuncDecl, moduleName string) *GenerateError {
 	if !ctx.RemoveEverything && ctx.FuncCtx.ImplImportName == "" {
-		if ctx.Implementation == autometrics.PROMETHEUS {
-			return &GenerateError{
-				FunctionName: funcDeclaration.Name.Name,
-				Detail:       fmt.Errorf("the source file is missing a %v import", AmPromPackage),
-			}
-		} else if ctx.Implementation == autometrics.OTEL {
-			return &GenerateError{
-				FunctionName: funcDeclaration.Name.Name,
-				Detail:       fmt.Errorf("the source file is missing a %v import", AmOtelPackage),
-			}
-		} else {
-			return &GenerateError{
-				FunctionName: funcDeclaration.Name.Name,
-				Detail:       fmt.Errorf("unknown implementation of metrics has been queried"),
-			}
+		return &GenerateError{
+			FunctionName: funcDeclaration.Name.Name,
+			Detail:       fmt.Errorf("the source file is missing a %q import", ctx.BackendPackage),
 		}
 	}
 
@@ -298,6 +345,12 @@ func parseAutometricsFnContext(ctx *internal.GeneratorContext, commentGroup []st
 				case token == NoDocArgument:
 					ctx.FuncCtx.DisableDocGeneration = true
 					tokenIndex = tokenIndex + 1
+				case token == NameErrorArgument:
+					ctx.FuncCtx.NameUnnamedError = true
+					tokenIndex = tokenIndex + 1
+				case token == ErrorKindsArgument:
+					ctx.FuncCtx.ErrorKindsDoc = true
+					tokenIndex = tokenIndex + 1
 				default:
 					// Advance past the "value"
 					tokenIndex = tokenIndex + 1
@@ -11,7 +11,7 @@ import (
 	"github.com/dave/dst/decorator"
 	"github.com/stretchr/testify/assert"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 )
 
@@ -95,6 +95,93 @@ func main() {
 	assert.Equal(t, want, actual, "The generated source code is not as expected.")
 }
 
+// This test makes sure that the "Errors by Kind" link is only generated when the
+// directive or the generator flag asks for it.
+func TestErrorKindsDocumentation(t *testing.T) {
+	want := `package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+// main
+//
+//	autometrics:doc-start Generated documentation by Autometrics.
+//
+// # Autometrics
+//
+// # Prometheus
+//
+// View the live metrics for the ` + "`main`" + ` function:
+//   - [Request Rate]
+//   - [Error Ratio]
+//   - [Errors by Kind]
+//   - [Latency (95th and 99th percentiles)]
+//   - [Concurrent Calls]
+//
+// Or, dig into the metrics of *functions called by* ` + "`main`" + `
+//   - [Request Rate Callee]
+//   - [Error Ratio Callee]
+//
+//	autometrics:doc-end Generated documentation by Autometrics.
+//
+// [Request Rate]: http://localhost:9090/graph?g0.expr=%23+Rate+of+calls+to+the+%60main%60+function+per+second%2C+averaged+over+5+minute+windows%0A%0Asum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bfunction%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29&g0.tab=0
+// [Error Ratio]: http://localhost:9090/graph?g0.expr=%23+Percentage+of+calls+to+the+%60main%60+function+that+return+errors%2C+averaged+over+5+minute+windows%0A%0A%28sum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bfunction%3D%22main%22%2Cresult%3D%22error%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29+%2F+%28sum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bfunction%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29&g0.tab=0
+// [Errors by Kind]: http://localhost:9090/graph?g0.expr=%23+Rate+of+errors+returned+by+the+%60main%60+function+per+second%2C+broken+down+by+error+kind%2C+averaged+over+5+minute+windows%0A%0Asum+by+%28error_kind%2C+function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bfunction%3D%22main%22%2Cresult%3D%22error%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29&g0.tab=0
+// [Latency (95th and 99th percentiles)]: http://localhost:9090/graph?g0.expr=%23+95th+and+99th+percentile+latencies+%28in+seconds%29+for+the+%60main%60+function%0A%0Alabel_replace%28histogram_quantile%280.99%2C+sum+by+%28le%2C+function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_duration_seconds_bucket%7Bfunction%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29%2C+%22percentile_latency%22%2C+%2299%22%2C+%22%22%2C+%22%22%29+or+label_replace%28histogram_quantile%280.95%2C+sum+by+%28le%2C+function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_duration_seconds_bucket%7Bfunction%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29%2C%22percentile_latency%22%2C+%2295%22%2C+%22%22%2C+%22%22%29&g0.tab=0
+// [Concurrent Calls]: http://localhost:9090/graph?g0.expr=%23+Concurrent+calls+to+the+%60main%60+function%0A%0Asum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28function_calls_concurrent%7Bfunction%3D%22main%22%7D+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29&g0.tab=0
+// [Request Rate Callee]: http://localhost:9090/graph?g0.expr=%23+Rate+of+function+calls+emanating+from+%60main%60+function+per+second%2C+averaged+over+5+minute+windows%0A%0Asum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bcaller_function%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29&g0.tab=0
+// [Error Ratio Callee]: http://localhost:9090/graph?g0.expr=%23+Percentage+of+function+emanating+from+%60main%60+function+that+return+errors%2C+averaged+over+5+minute+windows%0A%0A%28sum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bcaller_function%3D%22main%22%2Cresult%3D%22error%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29+%2F+%28sum+by+%28function%2C+module%2C+service_name%2C+version%2C+commit%29+%28rate%28function_calls_total%7Bcaller_function%3D%22main%22%7D%5B5m%5D%29+%2A+on+%28instance%2C+job%29+group_left%28version%2C+commit%29+last_over_time%28build_info%5B1s%5D%29%29%29&g0.tab=0
+//
+//autometrics:inst
+func main() {
+	amCtx := prom.PreInstrument(prom.NewContext(
+		nil,
+		prom.WithConcurrentCalls(true),
+		prom.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer prom.Instrument(amCtx, nil) //autometrics:defer
+
+	fmt.Println(hello)
+}
+`
+
+	for name, test := range map[string]struct {
+		directive string
+		flag      bool
+	}{
+		"directive argument": {directive: " --error-kinds"},
+		"generator flag":     {flag: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sourceCode := `package main
+
+import (
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+//autometrics:inst` + test.directive + `
+func main() {
+	fmt.Println(hello)
+}
+`
+
+			ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, false, false, false)
+			if err != nil {
+				t.Fatalf("error creating the generation context: %s", err)
+			}
+			ctx.ErrorKindsDoc = test.flag
+
+			actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+			if err != nil {
+				t.Fatalf("error generating the documentation: %s", err)
+			}
+
+			assert.Equal(t, strings.Replace(want, "//autometrics:inst\n", "//autometrics:inst"+test.directive+"\n", 1), actual, "The generated source code is not as expected.")
+		})
+	}
+}
+
 // This test makes sure that creating a doc comment when the function had
 // nothing before will add a header with the function name before the
 // autometrics section, to be sure that gopls (and IDEs downstream) will
@@ -175,6 +262,160 @@ func main() {
 	assert.Equal(t, want, actual, "The generated source code is not as expected.")
 }
 
+func TestInstrumentDirectiveWithOtherBackend(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	"example.com/statsd"
+)
+
+// main is a function here.
+//autometrics:inst --no-doc
+func main() {
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	want := `// This is the package comment.
+package main
+
+import (
+	"example.com/statsd"
+)
+
+// main is a function here.
+//
+//autometrics:inst --no-doc
+func main() {
+	amCtx := statsd.PreInstrument(statsd.NewContext(
+		nil,
+		statsd.WithConcurrentCalls(true),
+		statsd.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer statsd.Instrument(amCtx, nil) //autometrics:defer
+
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, false, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+	ctx.BackendPackage = "example.com/statsd"
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
+
+func TestInstrumentDirectiveWithVersionedBackend(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	"example.com/statsd/v2"
+)
+
+// main is a function here.
+//autometrics:inst --no-doc
+func main() {
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	want := `// This is the package comment.
+package main
+
+import (
+	"example.com/statsd/v2"
+)
+
+// main is a function here.
+//
+//autometrics:inst --no-doc
+func main() {
+	amCtx := statsd.PreInstrument(statsd.NewContext(
+		nil,
+		statsd.WithConcurrentCalls(true),
+		statsd.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer statsd.Instrument(amCtx, nil) //autometrics:defer
+
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, false, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+	ctx.BackendPackage = "example.com/statsd/v2"
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
+
+func TestInstrumentDirectiveAddsVersionedBackendImport(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+import (
+	"fmt"
+)
+
+// main is a function here.
+//autometrics:inst --no-doc
+func main() {
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	want := `// This is the package comment.
+package main
+
+import (
+	"example.com/statsd/v2"
+	"fmt"
+)
+
+// main is a function here.
+//
+//autometrics:inst --no-doc
+func main() {
+	amCtx := statsd.PreInstrument(statsd.NewContext(
+		nil,
+		statsd.WithConcurrentCalls(true),
+		statsd.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer statsd.Instrument(amCtx, nil) //autometrics:defer
+
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, false, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+	ctx.BackendPackage = "example.com/statsd/v2"
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
+
 func TestInstrumentDirectiveWithoutDoc(t *testing.T) {
 	sourceCode := `// This is the package comment.
 package main
@@ -606,6 +847,49 @@ func main() {
 	assert.Equal(t, want, actual, "The generated source code is not as expected.")
 }
 
+// TestCommentAddStatsdImport calls GenerateDocumentationAndInstrumentation on a
+// decorated function, making sure that the statsd autometrics import is automatically added.
+func TestCommentAddStatsdImport(t *testing.T) {
+	sourceCode := `// This is the package comment.
+package main
+
+//autometrics:inst --no-doc
+func main() {
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	want := `// This is the package comment.
+package main
+
+import ` + AmStatsdPackage + `
+
+//autometrics:inst --no-doc
+func main() {
+	amCtx := autometrics.PreInstrument(autometrics.NewContext(
+		nil,
+		autometrics.WithConcurrentCalls(true),
+		autometrics.WithCallerName(true),
+	)) //autometrics:shadow-ctx
+	defer autometrics.Instrument(amCtx, nil) //autometrics:defer
+
+	fmt.Println(hello) // line comment 3
+}
+`
+
+	ctx, err := internal.NewGeneratorContext(autometrics.STATSD, defaultPrometheusInstanceUrl, false, false, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	actual, err := GenerateDocumentationAndInstrumentation(ctx, sourceCode, "main")
+	if err != nil {
+		t.Fatalf("error generating the documentation: %s", err)
+	}
+
+	assert.Equal(t, want, actual, "The generated source code is not as expected.")
+}
+
 // TestCommentAddImportToBlock calls GenerateDocumentationAndInstrumentation on a
 // decorated function, making sure that the autometrics import is automatically added.
 func TestCommentAddImportToBlock(t *testing.T) {
@@ -1,14 +1,14 @@
-package generate // import "github.com/autometrics-dev/autometrics-go/internal/generate"
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 
 import (
 	"errors"
 	"fmt"
 	"go/token"
+	"path"
 	"strconv"
 	"strings"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
-	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
 
 	"github.com/dave/dst"
 )
@@ -17,32 +17,18 @@ import (
 func inspectImportSpec(ctx *internal.GeneratorContext, importSpec *dst.ImportSpec) bool {
 	var foundAm bool
 
-	if ctx.Implementation == autometrics.PROMETHEUS {
-		if importSpec.Path.Value == AmPromPackage {
-			if importSpec.Name != nil {
-				ctx.FuncCtx.ImplImportName = importSpec.Name.Name
-			} else {
-				ctx.FuncCtx.ImplImportName = "autometrics"
-			}
-			foundAm = true
-		}
-	}
-
-	if ctx.Implementation == autometrics.OTEL {
-		if importSpec.Path.Value == AmOtelPackage {
-			if importSpec.Name != nil {
-				ctx.FuncCtx.ImplImportName = importSpec.Name.Name
-			} else {
-				ctx.FuncCtx.ImplImportName = "autometrics"
-			}
-			foundAm = true
+	if importSpec.Path.Value == strconv.Quote(ctx.BackendPackage) {
+		if importSpec.Name != nil {
+			ctx.FuncCtx.ImplImportName = importSpec.Name.Name
+		} else {
+			ctx.FuncCtx.ImplImportName = importName(ctx.BackendPackage)
 		}
+		foundAm = true
 	}
 
 	if importSpec.Name == nil {
-		names := strings.Split(importSpec.Path.Value, "/")
-		name := strings.Trim(names[len(names)-1], "\"")
-		ctx.ImportsMap[name] = strings.Trim(importSpec.Path.Value, "\"")
+		importPath := strings.Trim(importSpec.Path.Value, "\"")
+		ctx.ImportsMap[importName(importPath)] = importPath
 	} else {
 		ctx.ImportsMap[importSpec.Name.Name] = strings.Trim(importSpec.Path.Value, "\"")
 	}
@@ -52,28 +38,29 @@ func inspectImportSpec(ctx *internal.GeneratorContext, importSpec *dst.ImportSpe
 
 // addAutometricsImport adds the correct autometrics import to the passed fileTree.
 func addAutometricsImport(ctx *internal.GeneratorContext, fileTree *dst.File) error {
-	// var importSpec dst.ImportSpec
-	if ctx.Implementation == autometrics.PROMETHEUS {
-		addImport(fileTree, mustUnquote(AmPromPackage))
-		ctx.FuncCtx.ImplImportName = "autometrics"
-		ctx.ImportsMap["autometrics"] = AmPromPackage
-
-		return nil
+	if ctx.BackendPackage == "" {
+		return errors.New("no autometrics backend package has been queried")
 	}
 
-	if ctx.Implementation == autometrics.OTEL {
-		addImport(fileTree, mustUnquote(AmOtelPackage))
-		ctx.FuncCtx.ImplImportName = "autometrics"
-		ctx.ImportsMap["autometrics"] = AmOtelPackage
+	addImport(fileTree, ctx.BackendPackage)
+	ctx.FuncCtx.ImplImportName = importName(ctx.BackendPackage)
+	ctx.ImportsMap[ctx.FuncCtx.ImplImportName] = ctx.BackendPackage
 
-		return nil
-	}
+	return nil
+}
 
-	if ctx.FuncCtx.ImplImportName == "" {
-		return errors.New("assertion error: ctx.FuncCtx.ImplImportName is empty at the end of addAutometricsImport")
+// importName returns the name under which the package at importPath is used without an
+// import alias, assuming like goimports that the package is named after the last element of
+// its path that is not a major version suffix (like "/v2").
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if strings.HasPrefix(name, "v") && path.Dir(importPath) != "." {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			return path.Base(path.Dir(importPath))
+		}
 	}
 
-	return errors.New("unrecognized implementation of Autometrics has been queried")
+	return name
 }
 
 // addImport walks a file declarations to add in the correct location an additional import for 'imp' without alias.
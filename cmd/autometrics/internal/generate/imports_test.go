@@ -0,0 +1,21 @@
+package generate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportName(t *testing.T) {
+	for importPath, want := range map[string]string{
+		"fmt":      "fmt",
+		"net/http": "http",
+		"github.com/autometrics-dev/autometrics-go/prometheus/autometrics": "autometrics",
+		"example.com/statsd/v2":  "statsd",
+		"example.com/statsd/v10": "statsd",
+		"example.com/statsd/vx":  "vx",
+		"v2":                     "v2",
+	} {
+		assert.Equal(t, want, importName(importPath), importPath)
+	}
+}
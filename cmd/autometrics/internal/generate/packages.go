@@ -0,0 +1,154 @@
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
+)
+
+const (
+	directivePrefix = "//autometrics:"
+)
+
+type TransformError struct {
+	FileName string
+	Detail   error
+}
+
+type TransformErrors []TransformError
+
+func (errs TransformErrors) Error() string {
+	var sb strings.Builder
+
+	for _, err := range errs {
+		sb.WriteString(fmt.Sprintf("%v:\n%v\n", err.FileName, err.Detail.Error()))
+	}
+
+	return sb.String()
+}
+
+// TransformPackages loads all the packages matching the patterns and
+// transforms every Go file that needs to be processed by the generator.
+//
+// The patterns follow the syntax of `go list` (for example `./...` or
+// `./pkg/foo`), and are resolved relative to dir. An empty dir means the
+// current working directory.
+//
+// Files are transformed in parallel, and all the errors encountered are
+// returned as [TransformErrors], with one entry per failing file.
+func TransformPackages(ctx internal.GeneratorContext, dir string, patterns ...string) error {
+	return walkPackages(ctx, dir, patterns, TransformFile)
+}
+
+// CheckPackages is the equivalent of [TransformPackages] for [CheckFile]: no
+// file is modified, and all the files that are not up to date have a
+// [*StaleFileError] in the returned [TransformErrors].
+func CheckPackages(ctx internal.GeneratorContext, dir string, patterns ...string) error {
+	return walkPackages(ctx, dir, patterns, CheckFile)
+}
+
+type fileProcessor func(ctx internal.GeneratorContext, path, moduleName string) error
+
+func walkPackages(ctx internal.GeneratorContext, dir string, patterns []string, process fileProcessor) error {
+	config := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles,
+		Dir:  dir,
+	}
+
+	pkgs, err := packages.Load(config, patterns...)
+	if err != nil {
+		return fmt.Errorf("loading packages %v: %w", patterns, err)
+	}
+
+	var loadErrs TransformErrors
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, pkgErr := range pkg.Errors {
+			if pkgErr.Kind == packages.ListError {
+				loadErrs = append(loadErrs, TransformError{
+					FileName: pkg.PkgPath,
+					Detail:   pkgErr,
+				})
+			}
+		}
+	})
+	if loadErrs != nil {
+		return loadErrs
+	}
+
+	type job struct {
+		path       string
+		moduleName string
+	}
+
+	// Only the packages matching the patterns are transformed, not their dependencies.
+	var jobs []job
+	for _, pkg := range pkgs {
+		for _, path := range pkg.GoFiles {
+			jobs = append(jobs, job{path: path, moduleName: pkg.Name})
+		}
+	}
+
+	var (
+		transformErrs TransformErrors
+		errsLock      sync.Mutex
+		wg            sync.WaitGroup
+	)
+
+	queue := make(chan job)
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				if err := processPackageFile(ctx, j.path, j.moduleName, process); err != nil {
+					errsLock.Lock()
+					transformErrs = append(transformErrs, TransformError{FileName: j.path, Detail: err})
+					errsLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	if transformErrs != nil {
+		sort.Slice(transformErrs, func(i, j int) bool {
+			return transformErrs[i].FileName < transformErrs[j].FileName
+		})
+		return transformErrs
+	}
+
+	return nil
+}
+
+// processPackageFile processes a single file found while walking packages,
+// skipping the files that do not need any processing.
+func processPackageFile(ctx internal.GeneratorContext, path, moduleName string, process fileProcessor) error {
+	if !ctx.InstrumentEverything {
+		sourceBytes, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading the source code from %s: %w", path, err)
+		}
+
+		if !bytes.Contains(sourceBytes, []byte(directivePrefix)) {
+			return nil
+		}
+	}
+
+	// The context is shared between all the workers, so each file needs its own imports map.
+	ctx.ImportsMap = make(map[string]string)
+
+	return process(ctx, path, moduleName)
+}
@@ -0,0 +1,168 @@
+package generate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+func writeTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/amtest\n\ngo 1.18\n"
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("creating the test module directories: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("writing the test module file %s: %s", name, err)
+		}
+	}
+
+	return dir
+}
+
+// TestTransformPackages makes sure that the package-wide mode only transforms
+// the files with directives, in all the packages matching the pattern.
+func TestTransformPackages(t *testing.T) {
+	withDirective := `package %s
+
+//autometrics:inst --no-doc
+func Instrumented() error {
+	return nil
+}
+`
+	withoutDirective := `package %s
+
+func NotInstrumented() error {
+	return nil
+}
+`
+
+	dir := writeTestModule(t, map[string]string{
+		"main.go":          strings.ReplaceAll(withDirective, "%s", "main"),
+		"other.go":         strings.ReplaceAll(withoutDirective, "%s", "main"),
+		"pkg/foo/foo.go":   strings.ReplaceAll(withDirective, "%s", "foo"),
+		"pkg/foo/bar.go":   strings.ReplaceAll(withoutDirective, "%s", "foo"),
+		"pkg/baz/baz.go":   strings.ReplaceAll(withDirective, "%s", "baz"),
+		"pkg/baz/quux.go":  strings.ReplaceAll(withoutDirective, "%s", "baz"),
+		"pkg/baz/README":   "not a go file",
+		"pkg/foo/gen/x.go": strings.ReplaceAll(withoutDirective, "%s", "gen"),
+	})
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	err = TransformPackages(ctx, dir, "./pkg/...")
+	if err != nil {
+		t.Fatalf("error transforming the packages: %s", err)
+	}
+
+	for _, name := range []string{"pkg/foo/foo.go", "pkg/baz/baz.go"} {
+		content, _ := os.ReadFile(filepath.Join(dir, name))
+		assert.Contains(t, string(content), "defer autometrics.Instrument(amCtx, nil) //autometrics:defer", "%s should be instrumented", name)
+		assert.Contains(t, string(content), AmPromPackage, "%s should import autometrics", name)
+	}
+
+	for _, name := range []string{"main.go", "other.go", "pkg/foo/bar.go", "pkg/baz/quux.go", "pkg/foo/gen/x.go"} {
+		content, _ := os.ReadFile(filepath.Join(dir, name))
+		assert.NotContains(t, string(content), "autometrics.Instrument", "%s should not be instrumented", name)
+	}
+}
+
+// TestTransformPackagesErrors makes sure that errors are reported per file.
+func TestTransformPackagesErrors(t *testing.T) {
+	invalidDirective := `package foo
+
+//autometrics:inst --slo "API" --success-target 42
+func Invalid() error {
+	return nil
+}
+`
+	dir := writeTestModule(t, map[string]string{
+		"foo/a.go": invalidDirective,
+		"foo/b.go": invalidDirective,
+		"foo/c.go": "package foo\n\n//autometrics:inst --no-doc\nfunc Valid() {}\n",
+	})
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	err = TransformPackages(ctx, dir, "./...")
+
+	var transformErrs TransformErrors
+	if !errors.As(err, &transformErrs) {
+		t.Fatalf("expected TransformErrors, got %v", err)
+	}
+
+	if assert.Len(t, transformErrs, 2) {
+		assert.Equal(t, filepath.Join(dir, "foo", "a.go"), transformErrs[0].FileName)
+		assert.Equal(t, filepath.Join(dir, "foo", "b.go"), transformErrs[1].FileName)
+
+		var generateErrs GenerateErrors
+		assert.True(t, errors.As(transformErrs[0].Detail, &generateErrs))
+		assert.Equal(t, "Invalid", generateErrs[0].FunctionName)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "foo", "c.go"))
+	assert.Contains(t, string(content), "//autometrics:defer")
+}
+
+// TestCheckPackages makes sure that the check mode reports stale files with a
+// diff, and never modifies them.
+func TestCheckPackages(t *testing.T) {
+	stale := `package foo
+
+//autometrics:inst --no-doc
+func Stale() error {
+	return nil
+}
+`
+	dir := writeTestModule(t, map[string]string{
+		"foo/stale.go": stale,
+		"foo/fresh.go": stale,
+	})
+
+	ctx, err := internal.NewGeneratorContext(autometrics.PROMETHEUS, defaultPrometheusInstanceUrl, false, true, false, false)
+	if err != nil {
+		t.Fatalf("error creating the generation context: %s", err)
+	}
+
+	freshPath := filepath.Join(dir, "foo", "fresh.go")
+	if err := TransformFile(ctx, freshPath, "foo"); err != nil {
+		t.Fatalf("error transforming the fresh file: %s", err)
+	}
+	assert.NoError(t, CheckFile(ctx, freshPath, "foo"))
+
+	err = CheckPackages(ctx, dir, "./...")
+
+	var transformErrs TransformErrors
+	if !errors.As(err, &transformErrs) {
+		t.Fatalf("expected TransformErrors, got %v", err)
+	}
+
+	if assert.Len(t, transformErrs, 1) {
+		var staleErr *StaleFileError
+		if assert.True(t, errors.As(transformErrs[0].Detail, &staleErr)) {
+			assert.Equal(t, filepath.Join(dir, "foo", "stale.go"), staleErr.FileName)
+			assert.Contains(t, staleErr.Diff, "+\tdefer autometrics.Instrument(amCtx, nil) //autometrics:defer\n")
+		}
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "foo", "stale.go"))
+	assert.Equal(t, stale, string(content), "checking must not modify the file")
+}
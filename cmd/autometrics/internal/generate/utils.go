@@ -1,4 +1,4 @@
-package generate // import "github.com/autometrics-dev/autometrics-go/internal/generate"
+package generate // import "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 
 import (
 	"strings"
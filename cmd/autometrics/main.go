@@ -1,13 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
-	internal "github.com/autometrics-dev/autometrics-go/internal/autometrics"
-	"github.com/autometrics-dev/autometrics-go/internal/build"
-	"github.com/autometrics-dev/autometrics-go/internal/generate"
+	internal "github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/autometrics"
+	"github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/build"
+	"github.com/autometrics-dev/autometrics-go/cmd/autometrics/internal/generate"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 
 	arg "github.com/alexflint/go-arg"
@@ -18,14 +20,20 @@ const (
 )
 
 type args struct {
-	FileName             string `arg:"-f,--,required,env:GOFILE" placeholder:"FILE_NAME" help:"File to transform."`
-	ModuleName           string `arg:"-m,--,required,env:GOPACKAGE" placeholder:"MODULE_NAME" help:"Module containing the file to transform."`
-	PrometheusUrl        string `arg:"--prom_url,env:AM_PROMETHEUS_URL" placeholder:"PROMETHEUS_URL" default:"http://localhost:9090" help:"Base URL of the Prometheus instance to generate links to."`
-	UseOtel              bool   `arg:"--otel" default:"false" help:"Use OpenTelemetry client library to instrument code instead of default Prometheus."`
-	AllowCustomLatencies bool   `arg:"--custom-latency" default:"false" help:"Allow non-default latencies to be used in latency-based SLOs."`
-	DisableDocGeneration bool   `arg:"--no-doc,env:AM_NO_DOCGEN" default:"false" help:"Disable documentation links generation for all instrumented functions. Has the same effect as --no-doc in the //autometrics:inst directive."`
-	ProcessAllFunctions  bool   `arg:"-i,--inst-all,env:AM_INSTRUMENT_ALL" default:"false" help:"Instrument all function declared in the file to transform. Overwritten by the --rm-all argument if both are set."`
-	RemoveAllFunctions   bool   `arg:"--rm-all,env:AM_RM_ALL" default:"false" help:"Remove all function instrumentation in the file to transform."`
+	Packages             []string `arg:"positional" placeholder:"PACKAGES" help:"Packages to transform, in 'go list' syntax (e.g. ./...). If absent, only the file given by FILE_NAME is transformed."`
+	FileName             string   `arg:"-f,--,env:GOFILE" placeholder:"FILE_NAME" help:"File to transform. Mandatory if no PACKAGES are given."`
+	ModuleName           string   `arg:"-m,--,env:GOPACKAGE" placeholder:"MODULE_NAME" help:"Module containing the file to transform. Mandatory if no PACKAGES are given."`
+	PrometheusUrl        string   `arg:"--prom_url,env:AM_PROMETHEUS_URL" placeholder:"PROMETHEUS_URL" default:"http://localhost:9090" help:"Base URL of the Prometheus instance to generate links to."`
+	UseOtel              bool     `arg:"--otel" default:"false" help:"Use OpenTelemetry client library to instrument code instead of default Prometheus."`
+	UseStatsd            bool     `arg:"--statsd" default:"false" help:"Use StatsD (with DogStatsD tags) to instrument code instead of default Prometheus."`
+	Backend              string   `arg:"--backend,env:AM_BACKEND" placeholder:"IMPORT_PATH" help:"Import path of the autometrics backend to instrument code with, instead of the Prometheus, OpenTelemetry or StatsD ones. Overrides --otel and --statsd."`
+	AllowCustomLatencies bool     `arg:"--custom-latency" default:"false" help:"Allow non-default latencies to be used in latency-based SLOs."`
+	DisableDocGeneration bool     `arg:"--no-doc,env:AM_NO_DOCGEN" default:"false" help:"Disable documentation links generation for all instrumented functions. Has the same effect as --no-doc in the //autometrics:inst directive."`
+	ProcessAllFunctions  bool     `arg:"-i,--inst-all,env:AM_INSTRUMENT_ALL" default:"false" help:"Instrument all function declared in the file to transform. Overwritten by the --rm-all argument if both are set."`
+	RemoveAllFunctions   bool     `arg:"--rm-all,env:AM_RM_ALL" default:"false" help:"Remove all function instrumentation in the file to transform."`
+	NameErrors           bool     `arg:"--name-errors,env:AM_NAME_ERRORS" default:"false" help:"Name the unnamed error return values of instrumented functions, so that errors are reported. Has the same effect as --name-error in the //autometrics:inst directive."`
+	ErrorKindsDoc        bool     `arg:"--error-kinds,env:AM_ERROR_KINDS" default:"false" help:"Add the 'Errors by Kind' link to the documentation of all instrumented functions, for programs that register error kinds in their Init call. Has the same effect as --error-kinds in the //autometrics:inst directive."`
+	Check                bool     `arg:"--check,env:AM_CHECK" default:"false" help:"Do not write any file, but exit with an error and print a diff if a file is not up to date with the generator output."`
 }
 
 func (args) Version() string {
@@ -63,12 +71,23 @@ func (args) Description() string {
 
 func main() {
 	var args args
-	arg.MustParse(&args)
+	parser := arg.MustParse(&args)
+
+	if len(args.Packages) == 0 && (args.FileName == "" || args.ModuleName == "") {
+		parser.Fail("either PACKAGES, or both -f and -m must be provided")
+	}
+
+	if args.UseOtel && args.UseStatsd {
+		parser.Fail("--otel and --statsd cannot be used together")
+	}
 
 	implementation := autometrics.PROMETHEUS
 	if args.UseOtel {
 		implementation = autometrics.OTEL
 	}
+	if args.UseStatsd {
+		implementation = autometrics.STATSD
+	}
 
 	ctx, err := internal.NewGeneratorContext(
 		implementation,
@@ -81,8 +100,60 @@ func main() {
 	if err != nil {
 		log.Fatalf("error initialising autometrics context: %s", err)
 	}
+	ctx.NameUnnamedErrors = args.NameErrors
+	ctx.ErrorKindsDoc = args.ErrorKindsDoc
+	if args.Backend != "" {
+		ctx.BackendPackage = args.Backend
+	}
+
+	if args.Check {
+		check(ctx, args)
+		return
+	}
+
+	if len(args.Packages) > 0 {
+		if err := generate.TransformPackages(ctx, "", args.Packages...); err != nil {
+			log.Fatalf("error transforming %v:\n%s", args.Packages, err)
+		}
+		return
+	}
 
 	if err := generate.TransformFile(ctx, args.FileName, args.ModuleName); err != nil {
 		log.Fatalf("error transforming %s: %s", args.FileName, err)
 	}
 }
+
+// check runs the generator without writing any file, and exits with a non-zero
+// status after printing the diffs of all the files that are not up to date.
+func check(ctx internal.GeneratorContext, args args) {
+	var err error
+	if len(args.Packages) > 0 {
+		err = generate.CheckPackages(ctx, "", args.Packages...)
+	} else {
+		err = generate.CheckFile(ctx, args.FileName, args.ModuleName)
+	}
+
+	if err == nil {
+		return
+	}
+
+	var errs []error
+	var transformErrs generate.TransformErrors
+	if errors.As(err, &transformErrs) {
+		for _, transformErr := range transformErrs {
+			errs = append(errs, transformErr.Detail)
+		}
+	} else {
+		errs = append(errs, err)
+	}
+
+	for _, err := range errs {
+		var staleErr *generate.StaleFileError
+		if errors.As(err, &staleErr) {
+			fmt.Print(staleErr.Diff)
+		}
+		log.Printf("error checking: %s", err)
+	}
+
+	os.Exit(1)
+}
@@ -0,0 +1,335 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+
+	"go.opentelemetry.io/otel/attribute"
+	instruments "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// errNotInitialized is the cause of the inactivity of the default instance before [Init] is called.
+var errNotInitialized = errors.New("autometrics: Init has not been called")
+
+// errShutdown is the cause of the inactivity of an instance after [Autometrics.Shutdown] is called.
+var errShutdown = errors.New("autometrics: Shutdown has been called")
+
+// defaultInstance is the instance used by the package-level functions, set by [Init].
+var defaultInstance atomic.Pointer[Autometrics]
+
+func init() {
+	inactiveCtx, cancel := context.WithCancelCause(context.Background())
+	cancel(errNotInitialized)
+	defaultInstance.Store(&Autometrics{ctx: inactiveCtx, cancel: cancel, config: am.DefaultConfig()})
+}
+
+// Autometrics is an instance of autometrics, with its own configuration and metrics.
+//
+// The package-level functions (like [PreInstrument] and [Instrument]) use the instance
+// created by [Init].
+type Autometrics struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	config *am.Config
+
+	functionCallsCount      instruments.Int64Counter
+	functionCallsDuration   instruments.Float64Histogram
+	functionCallsConcurrent instruments.Int64UpDownCounter
+	buildInfo               instruments.Int64UpDownCounter
+
+	exporterLock       sync.Mutex
+	pushExporter       *spoolingExporter
+	pushPeriodicReader *metric.PeriodicReader
+
+	provider *metric.MeterProvider
+	// registerer is set when the metrics are exposed with the Prometheus exporter, to unregister
+	// the exporter at shutdown.
+	registerer *exporterRegisterer
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// New creates an instance of autometrics, with its own meter provider and metrics.
+//
+// Unlike [Init], New does not change the instance used by the package-level functions, so
+// the functions to instrument must use the methods of the returned instance instead.
+//
+// Make sure that all the latency targets you want to use for SLOs are
+// present in the histogramBuckets array, otherwise the alerts will fail
+// to work (they will never trigger).
+func New(initOpts ...InitOption) (_ *Autometrics, err error) {
+	initArgs := defaultInitArguments()
+	for _, initOpt := range initOpts {
+		if err := initOpt.Apply(&initArgs); err != nil {
+			return nil, fmt.Errorf("initializing options: %w", err)
+		}
+	}
+
+	err = initArgs.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("init options validation: %w", err)
+	}
+
+	newCtx, cancelFunc := context.WithCancelCause(context.Background())
+	a := &Autometrics{
+		ctx:    newCtx,
+		cancel: cancelFunc,
+		config: &am.Config{
+			Version:          initArgs.version,
+			Commit:           initArgs.commit,
+			Branch:           initArgs.branch,
+			Logger:           initArgs.logger,
+			ResultClassifier: initArgs.resultClassifier,
+			ExtraResults:     initArgs.extraResults,
+			ErrorKinds:       initArgs.errorKinds,
+			TraceIDExtractor: initArgs.traceIDExtractor,
+			Recorders:        initArgs.recorders,
+		},
+	}
+	if initArgs.tracerProvider != nil {
+		a.config.Tracer = initArgs.tracerProvider.Tracer(completeMeterName(initArgs.meterName))
+	}
+
+	var pushExporter metric.Exporter
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Release the exporters and the meter provider set up before the failure, so that
+		// the Prometheus exporter does not stay registered.
+		if a.provider == nil && pushExporter != nil {
+			_ = pushExporter.Shutdown(context.Background())
+		}
+		_ = a.Shutdown(context.Background())
+	}()
+
+	if initArgs.HasPushEnabled() {
+		pushExporter, err = a.initPushExporter(initArgs)
+		if err != nil {
+			return nil, fmt.Errorf("impossible to initialize OTLP exporter: %w", err)
+		}
+	}
+
+	if serviceName, ok := os.LookupEnv(am.AutometricsServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else if serviceName, ok := os.LookupEnv(am.OTelServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else {
+		a.config.Service = initArgs.service
+	}
+
+	if repoURL, ok := os.LookupEnv(am.AutometricsRepoURLEnv); ok {
+		a.config.RepositoryURL = repoURL
+	} else {
+		a.config.RepositoryURL = initArgs.repoURL
+	}
+	if repoProvider, ok := os.LookupEnv(am.AutometricsRepoProviderEnv); ok {
+		a.config.RepositoryProvider = repoProvider
+	} else {
+		a.config.RepositoryProvider = initArgs.repoProvider
+	}
+
+	a.provider, err = a.initProvider(pushExporter, initArgs)
+	if err != nil {
+		return nil, err
+	}
+	meter := a.provider.Meter(completeMeterName(initArgs.meterName))
+
+	a.functionCallsCount, err = meter.Int64Counter(FunctionCallsCountName, instruments.WithDescription("The number of times the function has been called"))
+	if err != nil {
+		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsCountName, err)
+	}
+
+	a.functionCallsDuration, err = meter.Float64Histogram(FunctionCallsDurationName, instruments.WithDescription("The duration of each function call, in seconds"))
+	if err != nil {
+		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsDurationName, err)
+	}
+
+	a.functionCallsConcurrent, err = meter.Int64UpDownCounter(FunctionCallsConcurrentName, instruments.WithDescription("The number of simultaneous calls of the function"))
+	if err != nil {
+		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsConcurrentName, err)
+	}
+
+	a.buildInfo, err = meter.Int64UpDownCounter(BuildInfoName, instruments.WithDescription("The information of the current build."))
+	if err != nil {
+		return nil, fmt.Errorf("error initializing %v metric: %w", BuildInfoName, err)
+	}
+
+	if a.pushExporter != nil {
+		_, err = meter.Int64ObservableCounter(PushesDroppedName,
+			instruments.WithDescription("The number of metrics snapshots dropped without being exported"),
+			instruments.WithInt64Callback(func(_ context.Context, observer instruments.Int64Observer) error {
+				observer.Observe(int64(a.pushExporter.Dropped()))
+				return nil
+			}))
+		if err != nil {
+			return nil, fmt.Errorf("error initializing %v metric: %w", PushesDroppedName, err)
+		}
+	}
+
+	a.buildInfo.Add(a.ctx, 1,
+		instruments.WithAttributes(
+			[]attribute.KeyValue{
+				attribute.Key(CommitLabel).String(a.config.Commit),
+				attribute.Key(VersionLabel).String(a.config.Version),
+				attribute.Key(BranchLabel).String(a.config.Branch),
+				attribute.Key(ServiceNameLabel).String(a.config.Service),
+				attribute.Key(RepositoryProviderLabel).String(a.config.RepositoryProvider),
+				attribute.Key(RepositoryURLLabel).String(a.config.RepositoryURL),
+				attribute.Key(JobNameLabel).String(a.config.PushJobName),
+				attribute.Key(AutometricsVersionLabel).String(AutometricsSpecVersion),
+			}...))
+
+	return a, nil
+}
+
+// Init sets up the metrics required for autometrics' decorated functions and registers
+// them to the Prometheus exporter.
+//
+// The created instance is used by the package-level functions (like [PreInstrument] and
+// [Instrument]), and its configuration becomes the default configuration of autometrics.
+//
+// After initialization, use the returned [context.CancelCauseFunc] to flush the last
+// results and turn off metric collection for the remainder of the program's lifetime.
+// It is a good candidate to be deferred in the usual case. To also release the meter
+// provider and the Prometheus exporter, so that Init can be called again, use [Shutdown] instead.
+//
+// Make sure that all the latency targets you want to use for SLOs are
+// present in the histogramBuckets array, otherwise the alerts will fail
+// to work (they will never trigger).
+func Init(initOpts ...InitOption) (context.CancelCauseFunc, error) {
+	a, err := New(initOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	am.SetDefaultConfig(a.config)
+	defaultInstance.Store(a)
+
+	return a.Cancel, nil
+}
+
+// Default returns the instance used by the package-level functions.
+//
+// Before [Init] is called, the default instance is inactive and does not record anything.
+func Default() *Autometrics {
+	return defaultInstance.Load()
+}
+
+// Config returns the configuration of the instance.
+func (a *Autometrics) Config() *am.Config {
+	return a.config
+}
+
+// Cancel turns off metric collection for the instance, for the remainder of the program's lifetime.
+//
+// It is the equivalent of the function returned by [Init]. When the instance pushes its metrics
+// to an OTLP collector, Cancel returns once the metrics have been pushed a last time. Unlike
+// [Autometrics.Shutdown], it does not release the meter provider and the Prometheus exporter.
+func (a *Autometrics) Cancel(cause error) {
+	if a.ctx.Err() != nil {
+		return
+	}
+	a.cancel(cause)
+
+	if a.provider != nil {
+		a.exporterLock.Lock()
+		defer a.exporterLock.Unlock()
+		// The context of the instance is over, so the last push only uses the timeout of the reader.
+		if err := a.provider.ForceFlush(context.Background()); err != nil {
+			a.config.GetLogger().Error("autometrics: opentelemetry: flushing the meter provider: %s", err)
+		}
+	}
+}
+
+// Shutdown turns off metric collection for the instance used by the package-level functions,
+// and releases its resources, so that [Init] can be called again.
+//
+// See [Autometrics.Shutdown] for the details.
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
+
+// Shutdown turns off metric collection for the instance, and shuts its meter provider down,
+// which exports the metrics a last time when the instance pushes them. The Prometheus exporter
+// is unregistered from the default Prometheus registry, so that another instance can register it again.
+//
+// The last export is abandoned when ctx is done, and its error is returned. Calling Shutdown
+// more than once, or after [Autometrics.Cancel], is safe.
+func (a *Autometrics) Shutdown(ctx context.Context) error {
+	a.cancel(errShutdown)
+
+	a.shutdownOnce.Do(func() {
+		if a.provider != nil {
+			if err := a.provider.Shutdown(ctx); err != nil {
+				a.shutdownErr = fmt.Errorf("autometrics: opentelemetry: shutting down the meter provider: %w", err)
+			}
+		}
+		if a.registerer != nil {
+			a.registerer.unregisterAll()
+		}
+	})
+
+	return a.shutdownErr
+}
+
+// ForceFlush forces a flush of the metrics, in the case autometrics is pushing metrics to an OTLP collector.
+//
+// This function is a no-op if no push configuration has been setup in [Init], but will return an error if
+// autometrics is not active (because this function is called before [Init] or after its shutdown function
+// has been called).
+func ForceFlush() error {
+	return Default().ForceFlush()
+}
+
+// ForceFlush forces a flush of the metrics of the instance, in the case it is pushing metrics to an
+// OTLP collector.
+//
+// This function is a no-op if no push configuration has been setup in [New], but will return an error if
+// the instance is not active (because [Autometrics.Cancel] or [Autometrics.Shutdown] has been called).
+func (a *Autometrics) ForceFlush() error {
+	if a.ctx.Err() != nil {
+		return fmt.Errorf("autometrics is not currently active: %w", context.Cause(a.ctx))
+	}
+
+	if a.pushPeriodicReader != nil {
+		ctx, cancel := context.WithCancel(a.ctx)
+		defer cancel()
+		if a.exporterLock.TryLock() {
+			defer a.exporterLock.Unlock()
+			if err := a.pushPeriodicReader.ForceFlush(ctx); err != nil {
+				return fmt.Errorf("autometrics: opentelemetry: periodicReader: issue while flushing: %w\n", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Middleware wraps a handler to record each request as a function call with the instance.
+//
+// See the midhttp package for the options.
+func (a *Autometrics) Middleware(next http.HandlerFunc, opts ...am.Option) http.HandlerFunc {
+	return mid.Middleware(a.instrumenter(), next, opts...)
+}
+
+// Transport wraps a RoundTripper to record each outgoing request as a function call with the instance.
+//
+// A nil base uses [http.DefaultTransport]. See the midhttp package for the options.
+func (a *Autometrics) Transport(base http.RoundTripper, opts ...am.Option) http.RoundTripper {
+	return mid.Transport(a.instrumenter(), base, opts...)
+}
+
+func (a *Autometrics) instrumenter() mid.Instrumenter {
+	return mid.Instrumenter{PreInstrument: a.PreInstrument, Instrument: a.Instrument}
+}
@@ -0,0 +1,135 @@
+package autometrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collector is a fake OTLP/HTTP collector keeping the bodies of the export requests.
+type collector struct {
+	lock    sync.Mutex
+	exports [][]byte
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.exports = append(c.exports, body)
+}
+
+// exported returns the number of exports that contain the metrics of function.
+func (c *collector) exported(function string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	count := 0
+	for _, export := range c.exports {
+		if bytes.Contains(export, []byte(function)) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func flushedOnShutdown(ctx context.Context, a *Autometrics) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	return nil
+}
+
+// TestShutdownFlushes makes sure that Shutdown pushes the metrics recorded since the last
+// periodic push.
+func TestShutdownFlushes(t *testing.T) {
+	receiver := &collector{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	a, err := New(
+		WithPushCollectorURL(strings.TrimPrefix(server.URL, "http://")),
+		WithPushHTTP(),
+		WithPushInsecure(),
+		WithPushPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	_ = flushedOnShutdown(context.Background(), a)
+	assert.Equal(t, 0, receiver.exported("flushedOnShutdown"), "the metrics should not be pushed before the end of the period")
+
+	assert.NoError(t, a.Shutdown(context.Background()))
+	assert.Equal(t, 1, receiver.exported("flushedOnShutdown"), "the metrics should be pushed on shutdown")
+}
+
+// TestCancelFlushes makes sure that Cancel pushes the metrics recorded since the last periodic
+// push, like the function returned by Init is documented to do.
+func TestCancelFlushes(t *testing.T) {
+	receiver := &collector{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	a, err := New(
+		WithPushCollectorURL(strings.TrimPrefix(server.URL, "http://")),
+		WithPushHTTP(),
+		WithPushInsecure(),
+		WithPushPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer func() { _ = a.Shutdown(context.Background()) }()
+
+	_ = flushedOnShutdown(context.Background(), a)
+	assert.Equal(t, 0, receiver.exported("flushedOnShutdown"), "the metrics should not be pushed before the end of the period")
+
+	a.Cancel(nil)
+	assert.Equal(t, 1, receiver.exported("flushedOnShutdown"), "the metrics should be pushed on cancel")
+	assert.Error(t, a.ForceFlush(), "the instance should not be active after cancel")
+
+	a.Cancel(nil)
+	assert.Equal(t, 1, receiver.exported("flushedOnShutdown"), "the metrics should only be pushed by the first cancel")
+}
+
+// TestShutdownTwice makes sure that Shutdown can be called again, and that the instance is not
+// active anymore after it.
+func TestShutdownTwice(t *testing.T) {
+	a, err := New()
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	assert.NoError(t, a.Shutdown(context.Background()))
+	assert.NoError(t, a.Shutdown(context.Background()))
+	assert.Error(t, a.ForceFlush(), "the instance should not be active after shutdown")
+}
+
+// TestShutdownAllowsInitAgain makes sure that Shutdown releases the Prometheus exporter, so
+// that the next Init exports the metrics of the new instance.
+func TestShutdownAllowsInitAgain(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		if _, err := Init(); err != nil {
+			t.Fatalf("initializing autometrics (round %d): %s", i, err)
+		}
+
+		_ = flushedOnShutdown(context.Background(), Default())
+		assert.Equal(t, map[string]float64{"function_calls_total/ok": 1, "function_calls_concurrent/": 0},
+			exportedValues(t, "flushedOnShutdown"),
+			"only the metrics of the current instance should be exported (round %d)", i)
+
+		assert.NoError(t, Shutdown(context.Background()))
+		assert.Empty(t, exportedValues(t, "flushedOnShutdown"), "the metrics should not be exported after shutdown (round %d)", i)
+	}
+}
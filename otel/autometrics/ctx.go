@@ -9,6 +9,65 @@ import (
 
 type ValidHttpRange = autometrics.InclusiveIntRange
 
+// Result is the outcome of a function call, as reported in the result label.
+//
+// This is a reexport to allow using only the current package at call site.
+type Result = autometrics.Result
+
+// ResultClassifier decides the result of a function call that returned a non-nil error.
+//
+// This is a reexport to allow using only the current package at call site.
+type ResultClassifier = autometrics.ResultClassifier
+
+// This is a reexport to allow using only the current package at call site.
+const (
+	ResultOk    = autometrics.ResultOk
+	ResultError = autometrics.ResultError
+
+	ErrorKindOther = autometrics.ErrorKindOther
+	ErrorKindPanic = autometrics.ErrorKindPanic
+)
+
+// ErrorKind is a named family of errors, used to fill the error kind label.
+//
+// This is a reexport to allow using only the current package at call site.
+type ErrorKind = autometrics.ErrorKind
+
+// ErrorKindIs returns an [ErrorKind] matching all the errors that wrap target, according to [errors.Is].
+func ErrorKindIs(name string, target error) ErrorKind {
+	return autometrics.ErrorKindIs(name, target)
+}
+
+// ErrorKindAs returns an [ErrorKind] matching all the errors that wrap an error of type T, according to [errors.As].
+func ErrorKindAs[T error](name string) ErrorKind {
+	return autometrics.ErrorKindAs[T](name)
+}
+
+// TraceID is an OpenTelemetry-compatible trace ID.
+//
+// This is a reexport to allow using only the current package at call site.
+type TraceID = autometrics.TraceID
+
+// SpanID is an OpenTelemetry-compatible span ID.
+//
+// This is a reexport to allow using only the current package at call site.
+type SpanID = autometrics.SpanID
+
+// TraceIDExtractor reads the identifiers of the current trace and span from a context.
+//
+// This is a reexport to allow using only the current package at call site.
+type TraceIDExtractor = autometrics.TraceIDExtractor
+
+// TraceIDExtractorFunc is an adapter to use ordinary functions as [TraceIDExtractor].
+//
+// This is a reexport to allow using only the current package at call site.
+type TraceIDExtractorFunc = autometrics.TraceIDExtractorFunc
+
+// OpenTelemetryTraceIDExtractor is a [TraceIDExtractor] reading the OpenTelemetry span context stored in the context.
+//
+// This is a reexport to allow using only the current package at call site.
+type OpenTelemetryTraceIDExtractor = autometrics.OpenTelemetryTraceIDExtractor
+
 func NewContext(ctx context.Context, opts ...autometrics.Option) context.Context {
 	return autometrics.NewContextWithOpts(ctx, opts...)
 }
@@ -21,6 +80,10 @@ func WithSpanID(sid []byte) autometrics.Option {
 	return autometrics.WithSpanID(sid)
 }
 
+func WithFunctionName(name string) autometrics.Option {
+	return autometrics.WithFunctionName(name)
+}
+
 func WithAlertLatency(target time.Duration, objective float64) autometrics.Option {
 	return autometrics.WithAlertLatency(target, objective)
 }
@@ -2,11 +2,14 @@ package autometrics // import "github.com/autometrics-dev/autometrics-go/prometh
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type initArguments struct {
@@ -22,10 +25,18 @@ type initArguments struct {
 	pushCollectorURL string
 	pushPeriod       time.Duration
 	pushTimeout      time.Duration
+	pushRetry        am.RetryPolicy
+	pushSpoolSize    int
 	pushUseHTTP      bool
 	pushHeaders      map[string]string
 	pushInsecure     bool
 	pushJobName      string
+	resultClassifier am.ResultClassifier
+	extraResults     []am.Result
+	errorKinds       []am.ErrorKind
+	traceIDExtractor am.TraceIDExtractor
+	tracerProvider   trace.TracerProvider
+	recorders        []am.Recorder
 }
 
 func defaultInitArguments() initArguments {
@@ -33,8 +44,11 @@ func defaultInitArguments() initArguments {
 		histogramBuckets: am.DefBuckets,
 		logger:           log.NoOpLogger{},
 		pushJobName:      am.DefaultJobName(),
+		traceIDExtractor: am.OpenTelemetryTraceIDExtractor{},
 		pushPeriod:       defaultPushPeriod,
 		pushTimeout:      defaultPushTimeout,
+		pushRetry:        am.DefaultRetryPolicy(),
+		pushSpoolSize:    defaultPushSpoolSize,
 		pushUseHTTP:      false,
 		pushInsecure:     false,
 	}
@@ -199,6 +213,35 @@ func WithPushTimeout(pushTimeout time.Duration) InitOption {
 	})
 }
 
+// WithPushRetry sets the policy to retry the exports that failed, with an exponential backoff.
+// It replaces the retry mechanism of the OTLP exporters.
+//
+// The default value is [DefaultRetryPolicy]. Use [NoRetry] to disable the retries.
+func WithPushRetry(policy RetryPolicy) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("setting push retry policy: %w", err)
+		}
+		initArgs.pushRetry = policy
+		return nil
+	})
+}
+
+// WithPushSpool sets the maximum number of snapshots of the metrics kept in memory while the
+// collector is unavailable, to export them once it is back. When the spool is full, the oldest
+// snapshot is dropped and counted in the [PushesDroppedName] counter.
+//
+// The default value is 10.
+func WithPushSpool(maxSnapshots int) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if maxSnapshots < 1 {
+			return errors.New("setting push spool: the spool must keep at least 1 snapshot")
+		}
+		initArgs.pushSpoolSize = maxSnapshots
+		return nil
+	})
+}
+
 // WlthPushHTTP sets the metrics pushing mechanism to use the HTTP format over gRPC
 //
 // The default value is to use gRPC.
@@ -246,3 +289,103 @@ func WithHistogramBuckets(histogramBuckets []float64) InitOption {
 		return nil
 	})
 }
+
+// WithResultClassifier sets the classifier that decides the result of the function
+// calls that returned a non-nil error.
+//
+// This allows for example to report [context.Canceled] or "not found" errors as
+// [ResultOk], so that they do not count against success rate objectives. The
+// classifier can also return a result of its own, as long as it is listed in
+// extraResults; any other returned result is reported as [ResultError] so that
+// the cardinality of the result label stays bounded.
+//
+// The default is to report all errors as [ResultError].
+func WithResultClassifier(classifier am.ResultClassifier, extraResults ...am.Result) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, extraResult := range extraResults {
+			if extraResult == "" {
+				return errors.New("setting result classifier: the allowed results cannot be empty")
+			}
+		}
+		initArgs.resultClassifier = classifier
+		initArgs.extraResults = extraResults
+		return nil
+	})
+}
+
+// WithErrorKinds enables the error kind label on the function calls counter, and sets the
+// kinds of errors it reports.
+//
+// Errors are matched against the kinds in order, and the first match gives the value of the
+// label. Errors that match no kind are reported as [ErrorKindOther], and panics as
+// [ErrorKindPanic]. Use [ErrorKindIs] and [ErrorKindAs] to build kinds from sentinel errors
+// and error types.
+//
+// The default is to not have any error kind label.
+func WithErrorKinds(kinds ...am.ErrorKind) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, kind := range kinds {
+			if kind.Name == "" || kind.Matches == nil {
+				return errors.New("setting error kinds: all error kinds must have a name and a matcher")
+			}
+			if kind.Name == am.ErrorKindOther || kind.Name == am.ErrorKindPanic {
+				return fmt.Errorf("setting error kinds: %q is a reserved error kind name", kind.Name)
+			}
+		}
+		initArgs.errorKinds = append([]am.ErrorKind{}, kinds...)
+		return nil
+	})
+}
+
+// WithTraceIDExtractor sets the extractor that reads the trace and span IDs of the current
+// span from the context given to instrumented functions. The IDs are used as exemplars, so
+// that exemplars resolve to the traces recorded by the tracer of the application.
+//
+// Passing nil disables the extraction, and autometrics always generates random IDs.
+//
+// The default is to read the OpenTelemetry span context, with [OpenTelemetryTraceIDExtractor].
+func WithTraceIDExtractor(extractor am.TraceIDExtractor) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.traceIDExtractor = extractor
+		return nil
+	})
+}
+
+// WithTracerProvider enables span creation: each call to an instrumented function starts
+// a span named after the function with a tracer of the given provider, and ends it with
+// an error status when the call fails. This gives a trace for every instrumented function,
+// and exemplars that always resolve to a span.
+//
+// Passing nil uses the global OpenTelemetry tracer provider, as returned by [otel.GetTracerProvider].
+//
+// The default is to not start any span.
+func WithTracerProvider(provider trace.TracerProvider) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+		initArgs.tracerProvider = provider
+		return nil
+	})
+}
+
+// WithRecorders sets recorders that receive the function calls on top of the metrics of autometrics.
+//
+// Other instances of autometrics are recorders too, which allows to feed several backends with
+// the same instrumented code, for example during a migration from one backend to another:
+// the calls are instrumented, classified and timed once by the instance created with this
+// option, and the other instances record the calls in their own metrics. The result classifier
+// and the error kinds of this instance decide the results and error kinds of the calls.
+//
+// The default is to not have any other recorder.
+func WithRecorders(recorders ...am.Recorder) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, recorder := range recorders {
+			if recorder == nil {
+				return errors.New("setting recorders: the recorders cannot be nil")
+			}
+		}
+		initArgs.recorders = append(initArgs.recorders, recorders...)
+		return nil
+	})
+}
@@ -2,8 +2,6 @@ package autometrics // import "github.com/autometrics-dev/autometrics-go/otel/au
 
 import (
 	"context"
-	"strconv"
-	"time"
 
 	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"go.opentelemetry.io/otel/attribute"
@@ -15,86 +13,45 @@ import (
 //
 // The first argument SHOULD be a call to PreInstrument so that
 // the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
 func Instrument(ctx context.Context, err *error) {
-	if amCtx.Err() != nil {
-		return
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
 	}
 
-	result := "ok"
+	Default().instrument(ctx, err, panicValue)
+}
 
-	if err != nil && *err != nil {
-		result = "error"
+// Instrument called in a defer statement wraps the body of a function
+// with automatic instrumentation, recorded with the instance.
+//
+// The first argument SHOULD be a call to [Autometrics.PreInstrument] so that
+// the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
+func (a *Autometrics) Instrument(ctx context.Context, err *error) {
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
 	}
 
-	var sloName, latencyTarget, latencyObjective, successObjective string
-
-	callInfo := am.GetCallInfo(ctx)
-	buildInfo := am.GetBuildInfo(ctx)
-	slo := am.GetAlertConfiguration(ctx)
-
-	if slo.ServiceName != "" {
-		sloName = slo.ServiceName
-
-		if slo.Latency != nil {
-			latencyTarget = strconv.FormatFloat(slo.Latency.Target.Seconds(), 'f', -1, 64)
-			latencyObjective = strconv.FormatFloat(slo.Latency.Objective, 'f', -1, 64)
-		}
-
-		if slo.Success != nil {
-			successObjective = strconv.FormatFloat(slo.Success.Objective, 'f', -1, 64)
-		}
-	}
+	a.instrument(ctx, err, panicValue)
+}
 
-	functionCallsCount.Add(ctx, 1,
-		metric.WithAttributes([]attribute.KeyValue{
-			attribute.Key(FunctionLabel).String(callInfo.Current.Function),
-			attribute.Key(ModuleLabel).String(callInfo.Current.Module),
-			attribute.Key(CallerFunctionLabel).String(callInfo.Parent.Function),
-			attribute.Key(CallerModuleLabel).String(callInfo.Parent.Module),
-			attribute.Key(ResultLabel).String(result),
-			attribute.Key(TargetSuccessRateLabel).String(successObjective),
-			attribute.Key(SloNameLabel).String(sloName),
-			attribute.Key(CommitLabel).String(buildInfo.Commit),
-			attribute.Key(VersionLabel).String(buildInfo.Version),
-			attribute.Key(BranchLabel).String(buildInfo.Branch),
-			attribute.Key(ServiceNameLabel).String(buildInfo.Service),
-			attribute.Key(JobNameLabel).String(am.GetPushJobName()),
-		}...))
-	functionCallsDuration.Record(ctx, time.Since(am.GetStartTime(ctx)).Seconds(),
-		metric.WithAttributes([]attribute.KeyValue{
-			attribute.Key(FunctionLabel).String(callInfo.Current.Function),
-			attribute.Key(ModuleLabel).String(callInfo.Current.Module),
-			attribute.Key(CallerFunctionLabel).String(callInfo.Parent.Function),
-			attribute.Key(CallerModuleLabel).String(callInfo.Parent.Module),
-			attribute.Key(TargetLatencyLabel).String(latencyTarget),
-			attribute.Key(TargetSuccessRateLabel).String(latencyObjective),
-			attribute.Key(SloNameLabel).String(sloName),
-			attribute.Key(CommitLabel).String(buildInfo.Commit),
-			attribute.Key(VersionLabel).String(buildInfo.Version),
-			attribute.Key(BranchLabel).String(buildInfo.Branch),
-			attribute.Key(ServiceNameLabel).String(buildInfo.Service),
-			attribute.Key(JobNameLabel).String(am.GetPushJobName()),
-		}...))
-
-	if am.GetTrackConcurrentCalls(ctx) {
-		functionCallsConcurrent.Add(ctx, -1,
-			metric.WithAttributes([]attribute.KeyValue{
-				attribute.Key(FunctionLabel).String(callInfo.Current.Function),
-				attribute.Key(ModuleLabel).String(callInfo.Current.Module),
-				attribute.Key(CallerFunctionLabel).String(callInfo.Parent.Function),
-				attribute.Key(CallerModuleLabel).String(callInfo.Parent.Module),
-				attribute.Key(CommitLabel).String(buildInfo.Commit),
-				attribute.Key(VersionLabel).String(buildInfo.Version),
-				attribute.Key(BranchLabel).String(buildInfo.Branch),
-				attribute.Key(ServiceNameLabel).String(buildInfo.Service),
-				attribute.Key(JobNameLabel).String(am.GetPushJobName()),
-			}...))
+func (a *Autometrics) instrument(ctx context.Context, err *error, panicValue any) {
+	if a.ctx.Err() != nil {
+		return
 	}
 
-	// NOTE: This call means that goroutines that outlive this function as the caller will not have access to parent
-	// caller information, but hopefully by that point we got all the necessary accesses done.
-	// If not, it is a convenience we accept to give up to prevent memory usage from exploding
-	_ = am.PopFunctionName(ctx)
+	am.EndCall(ctx, err, panicValue, a)
 }
 
 // PreInstrument runs the "before wrappee" part of instrumentation.
@@ -102,32 +59,63 @@ func Instrument(ctx context.Context, err *error) {
 // It is meant to be called as the first argument to Instrument in a
 // defer call.
 func PreInstrument(ctx context.Context) context.Context {
-	if amCtx.Err() != nil {
+	return Default().PreInstrument(ctx)
+}
+
+// PreInstrument runs the "before wrappee" part of instrumentation, recorded with the instance.
+//
+// It is meant to be called as the first argument to [Autometrics.Instrument] in a
+// defer call. It returns nil when the instance is not active.
+func (a *Autometrics) PreInstrument(ctx context.Context) context.Context {
+	if a.ctx.Err() != nil {
 		return nil
 	}
 
-	ctx = am.FillTracingAndCallerInfo(ctx)
-	ctx = am.FillBuildInfo(ctx)
-
-	callInfo := am.GetCallInfo(ctx)
-
-	if am.GetTrackConcurrentCalls(ctx) {
-		buildInfo := am.GetBuildInfo(ctx)
-		functionCallsConcurrent.Add(ctx, 1,
-			metric.WithAttributes([]attribute.KeyValue{
-				attribute.Key(FunctionLabel).String(callInfo.Current.Function),
-				attribute.Key(ModuleLabel).String(callInfo.Current.Module),
-				attribute.Key(CallerFunctionLabel).String(callInfo.Parent.Function),
-				attribute.Key(CallerModuleLabel).String(callInfo.Parent.Module),
-				attribute.Key(CommitLabel).String(buildInfo.Commit),
-				attribute.Key(VersionLabel).String(buildInfo.Version),
-				attribute.Key(BranchLabel).String(buildInfo.Branch),
-				attribute.Key(ServiceNameLabel).String(buildInfo.Service),
-				attribute.Key(JobNameLabel).String(am.GetPushJobName()),
-			}...))
+	return am.StartCall(ctx, a.config, a)
+}
+
+// RecordStart increments the concurrent calls gauge of the function if needed.
+//
+// It is called by [Autometrics.PreInstrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordStart(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	if call.TrackConcurrentCalls {
+		a.functionCallsConcurrent.Add(ctx, 1,
+			metric.WithAttributes(attributes(labelNames.CallsConcurrentLabels(a.config.Snapshot(ctx), call))...))
+	}
+}
+
+// RecordEnd records the finished call in the metrics of the instance.
+//
+// It is called by [Autometrics.Instrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordEnd(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	config := a.config.Snapshot(ctx)
+	a.functionCallsCount.Add(ctx, 1,
+		metric.WithAttributes(attributes(labelNames.CallsCountLabels(config, call))...))
+	a.functionCallsDuration.Record(ctx, call.Duration.Seconds(),
+		metric.WithAttributes(attributes(labelNames.CallsDurationLabels(config, call))...))
+
+	if call.TrackConcurrentCalls {
+		a.functionCallsConcurrent.Add(ctx, -1,
+			metric.WithAttributes(attributes(labelNames.CallsConcurrentLabels(config, call))...))
 	}
+}
 
-	ctx = am.SetStartTime(ctx, time.Now())
+// attributes converts labels to OpenTelemetry attributes.
+func attributes(labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for name, value := range labels {
+		attrs = append(attrs, attribute.Key(name).String(value))
+	}
 
-	return ctx
+	return attrs
 }
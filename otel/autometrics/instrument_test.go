@@ -0,0 +1,108 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCrash = errors.New("crash")
+
+func panicking(ctx context.Context) (err error) {
+	amCtx := PreInstrument(NewContext(ctx))
+	defer Instrument(amCtx, &err)
+
+	panic(errCrash)
+}
+
+// exportedValues returns the values of the metrics of function exported to the default
+// Prometheus registry, by metric name and result.
+func exportedValues(t *testing.T, function string) map[string]float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[FunctionLabel] == function && metric.GetHistogram() == nil {
+				values[family.GetName()+"/"+labels[ResultLabel]] += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return values
+}
+
+// TestPanic makes sure that Instrument records a panicking call as an error that is not running
+// anymore, and then panics again with the original value.
+func TestPanic(t *testing.T) {
+	if _, err := Init(); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	defer func() { _ = Shutdown(context.Background()) }()
+
+	assert.PanicsWithValue(t, errCrash, func() { _ = panicking(context.Background()) })
+
+	assert.Equal(t,
+		map[string]float64{"function_calls_total/error": 1, "function_calls_concurrent/": 0},
+		exportedValues(t, "panicking"))
+}
+
+var errNotFound = errors.New("not found")
+
+// classify reports the canceled calls as successful, and the not found errors with their
+// own result. The other errors get an undeclared result, which is reported as an error.
+func classify(_ context.Context, err error) am.Result {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return am.ResultOk
+	case errors.Is(err, errNotFound):
+		return "not_found"
+	default:
+		return "teapot"
+	}
+}
+
+// classifiedErrors are the errors returned by the calls of the result classifier tests.
+var classifiedErrors = []error{nil, context.Canceled, errNotFound, errNotFound, errors.New("failure")}
+
+func classified(ctx context.Context, a *Autometrics, returned error) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	return returned
+}
+
+// TestResultClassifier makes sure that the result attribute has the value returned by the classifier.
+func TestResultClassifier(t *testing.T) {
+	a, err := New(WithResultClassifier(classify, "not_found"))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer func() { _ = a.Shutdown(context.Background()) }()
+
+	for _, returned := range classifiedErrors {
+		_ = classified(context.Background(), a, returned)
+	}
+
+	assert.Equal(t,
+		map[string]float64{
+			"function_calls_total/ok":        2,
+			"function_calls_total/not_found": 2,
+			"function_calls_total/error":     1,
+			"function_calls_concurrent/":     0,
+		},
+		exportedValues(t, "classified"))
+}
@@ -1,39 +1,26 @@
 package autometrics // import "github.com/autometrics-dev/autometrics-go/otel/autometrics"
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	promclient "github.com/prometheus/client_golang/prometheus"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
-	instruments "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
-var (
-	functionCallsCount      instruments.Int64Counter
-	functionCallsDuration   instruments.Float64Histogram
-	functionCallsConcurrent instruments.Int64UpDownCounter
-	buildInfo               instruments.Int64UpDownCounter
-	DefBuckets              = autometrics.DefBuckets
-
-	amCtx              context.Context
-	exporterLock       sync.Mutex
-	pushPeriodicReader *metric.PeriodicReader
-)
+var DefBuckets = autometrics.DefBuckets
 
 const (
 	// AutometricsSpecVersion is the version of the specification the library follows
@@ -48,6 +35,9 @@ const (
 	FunctionCallsConcurrentName = "function.calls.concurrent"
 	// BuildInfo is the name of the openTelemetry metric for the version of the monitored codebase.
 	BuildInfoName = "build_info"
+	// PushesDroppedName is the name of the openTelemetry metric for the counter of metrics snapshots that were
+	// dropped without being exported, because the collector was unavailable for too long.
+	PushesDroppedName = "autometrics.pushes.dropped"
 
 	// FunctionLabel is the openTelemetry attribute that describes the function name.
 	//
@@ -67,6 +57,10 @@ const (
 	CallerModuleLabel = "caller.module"
 	// ResultLabel is the openTelemetry attribute that describes whether a function call is successful.
 	ResultLabel = "result"
+	// ErrorKindLabel is the openTelemetry attribute that describes the kind of error a function call returned.
+	//
+	// The attribute is only present when error kinds are enabled with [WithErrorKinds].
+	ErrorKindLabel = "error.kind"
 	// TargetLatencyLabel is the openTelemetry attribute that describes the latency to respect to match
 	// the Service Level Objective.
 	TargetLatencyLabel = "objective.latency_threshold"
@@ -107,10 +101,29 @@ const (
 	// used when pushing OTLP metrics.
 	JobNameLabel = "job"
 
-	defaultPushPeriod  = 10 * time.Second
-	defaultPushTimeout = 5 * time.Second
+	defaultPushPeriod    = 10 * time.Second
+	defaultPushTimeout   = 5 * time.Second
+	defaultPushSpoolSize = 10
 )
 
+// labelNames are the names of the labels of the function calls metrics.
+var labelNames = autometrics.LabelNames{
+	Function:          FunctionLabel,
+	Module:            ModuleLabel,
+	CallerFunction:    CallerFunctionLabel,
+	CallerModule:      CallerModuleLabel,
+	Result:            ResultLabel,
+	ErrorKind:         ErrorKindLabel,
+	TargetLatency:     TargetLatencyLabel,
+	TargetSuccessRate: TargetSuccessRateLabel,
+	SloName:           SloNameLabel,
+	Commit:            CommitLabel,
+	Version:           VersionLabel,
+	Branch:            BranchLabel,
+	Service:           ServiceNameLabel,
+	JobName:           JobNameLabel,
+}
+
 func completeMeterName(meterName string) string {
 	return fmt.Sprintf("autometrics/%v", meterName)
 }
@@ -126,132 +139,22 @@ type PrintLogger = log.PrintLogger
 // This is a reexport to allow using only the current package at call site.
 type NoOpLogger = log.NoOpLogger
 
-// Init sets up the metrics required for autometrics' decorated functions and registers
-// them to the Prometheus exporter.
-//
-// After initialization, use the returned [context.CancelCauseFunc] to flush the last
-// results and turn off metric collection for the remainder of the program's lifetime.
-// It is a good candidate to be deferred in the usual case.
+// RetryPolicy decides how a failed push of metrics is retried.
 //
-// Make sure that all the latency targets you want to use for SLOs are
-// present in the histogramBuckets array, otherwise the alerts will fail
-// to work (they will never trigger).
-func Init(initOpts ...InitOption) (context.CancelCauseFunc, error) {
-	var err error
-	newCtx, cancelFunc := context.WithCancelCause(context.Background())
-	amCtx = newCtx
-
-	initArgs := defaultInitArguments()
-	for _, initOpt := range initOpts {
-		if err := initOpt.Apply(&initArgs); err != nil {
-			return nil, fmt.Errorf("initializing options: %w", err)
-		}
-	}
-
-	err = initArgs.Validate()
-	if err != nil {
-		return nil, fmt.Errorf("init options validation: %w", err)
-	}
-
-	autometrics.SetCommit(initArgs.commit)
-	autometrics.SetVersion(initArgs.version)
-	autometrics.SetBranch(initArgs.branch)
-	autometrics.SetLogger(initArgs.logger)
-
-	var pushExporter metric.Exporter
-	if initArgs.HasPushEnabled() {
-		pushExporter, err = initPushExporter(initArgs)
-		if err != nil {
-			return nil, fmt.Errorf("impossible to initialize OTLP exporter: %w", err)
-		}
-	}
-
-	if serviceName, ok := os.LookupEnv(autometrics.AutometricsServiceNameEnv); ok {
-		autometrics.SetService(serviceName)
-	} else if serviceName, ok := os.LookupEnv(autometrics.OTelServiceNameEnv); ok {
-		autometrics.SetService(serviceName)
-	} else {
-		autometrics.SetService(initArgs.service)
-	}
-
-	if repoURL, ok := os.LookupEnv(autometrics.AutometricsRepoURLEnv); ok {
-		autometrics.SetRepositoryURL(repoURL)
-	} else {
-		autometrics.SetRepositoryURL(initArgs.repoURL)
-	}
-	if repoProvider, ok := os.LookupEnv(autometrics.AutometricsRepoProviderEnv); ok {
-		autometrics.SetRepositoryProvider(repoProvider)
-	} else {
-		autometrics.SetRepositoryProvider(initArgs.repoProvider)
-	}
-
-	provider, err := initProvider(pushExporter, initArgs)
-	if err != nil {
-		return nil, err
-	}
-	meter := provider.Meter(completeMeterName(initArgs.meterName))
-
-	functionCallsCount, err = meter.Int64Counter(FunctionCallsCountName, instruments.WithDescription("The number of times the function has been called"))
-	if err != nil {
-		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsCountName, err)
-	}
-
-	functionCallsDuration, err = meter.Float64Histogram(FunctionCallsDurationName, instruments.WithDescription("The duration of each function call, in seconds"))
-	if err != nil {
-		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsDurationName, err)
-	}
-
-	functionCallsConcurrent, err = meter.Int64UpDownCounter(FunctionCallsConcurrentName, instruments.WithDescription("The number of simultaneous calls of the function"))
-	if err != nil {
-		return nil, fmt.Errorf("error initializing %v metric: %w", FunctionCallsConcurrentName, err)
-	}
-
-	buildInfo, err = meter.Int64UpDownCounter(BuildInfoName, instruments.WithDescription("The information of the current build."))
-	if err != nil {
-		return nil, fmt.Errorf("error initializing %v metric: %w", BuildInfoName, err)
-	}
+// This is a reexport to allow using only the current package at call site.
+type RetryPolicy = autometrics.RetryPolicy
 
-	buildInfo.Add(amCtx, 1,
-		instruments.WithAttributes(
-			[]attribute.KeyValue{
-				attribute.Key(CommitLabel).String(autometrics.GetCommit()),
-				attribute.Key(VersionLabel).String(autometrics.GetVersion()),
-				attribute.Key(BranchLabel).String(autometrics.GetBranch()),
-				attribute.Key(ServiceNameLabel).String(autometrics.GetService()),
-				attribute.Key(RepositoryProviderLabel).String(autometrics.GetRepositoryProvider()),
-				attribute.Key(RepositoryURLLabel).String(autometrics.GetRepositoryURL()),
-				attribute.Key(JobNameLabel).String(autometrics.GetPushJobName()),
-				attribute.Key(AutometricsVersionLabel).String(AutometricsSpecVersion),
-			}...))
-
-	return cancelFunc, nil
+// DefaultRetryPolicy returns the policy used when none is set with [WithPushRetry].
+func DefaultRetryPolicy() RetryPolicy {
+	return autometrics.DefaultRetryPolicy()
 }
 
-// ForceFlush forces a flush of the metrics, in the case autometrics is pushing metrics to an OTLP collector.
-//
-// This function is a no-op if no push configuration has been setup in [Init], but will return an error if
-// autometrics is not active (because this function is called before [Init] or after its shutdown function
-// has been called).
-func ForceFlush() error {
-	if amCtx.Err() != nil {
-		return fmt.Errorf("autometrics is not currently active: %w", amCtx.Err())
-	}
-
-	if pushPeriodicReader != nil {
-		ctx, cancel := context.WithCancel(amCtx)
-		defer cancel()
-		if exporterLock.TryLock() {
-			defer exporterLock.Unlock()
-			if err := pushPeriodicReader.ForceFlush(ctx); err != nil {
-				return fmt.Errorf("autometrics: opentelemetry: periodicReader: issue while flushing: %w\n", err)
-			}
-		}
-	}
-
-	return nil
+// NoRetry returns a policy that never retries failed pushes.
+func NoRetry() RetryPolicy {
+	return autometrics.NoRetry()
 }
 
-func initProvider(pushExporter metric.Exporter, initArgs initArguments) (*metric.MeterProvider, error) {
+func (a *Autometrics) initProvider(pushExporter metric.Exporter, initArgs initArguments) (*metric.MeterProvider, error) {
 	instrumentView := metric.Instrument{
 		Name:  FunctionCallsDurationName,
 		Scope: instrumentation.Scope{Name: completeMeterName(initArgs.meterName)},
@@ -275,9 +178,9 @@ func initProvider(pushExporter metric.Exporter, initArgs initArguments) (*metric
 			semconv.SchemaURL,
 			[]attribute.KeyValue{
 				attribute.Key(semconv.ServiceNameKey).
-					String(autometrics.GetService()),
+					String(a.config.Service),
 				attribute.Key(semconv.ServiceInstanceIDKey).
-					String(autometrics.GetPushJobName()),
+					String(a.config.PushJobName),
 			}...),
 	)
 	if err != nil {
@@ -285,7 +188,8 @@ func initProvider(pushExporter metric.Exporter, initArgs initArguments) (*metric
 	}
 
 	if pushExporter == nil {
-		exporter, err := prometheus.New()
+		a.registerer = &exporterRegisterer{}
+		exporter, err := prometheus.New(prometheus.WithRegisterer(a.registerer))
 		if err != nil {
 			return nil, fmt.Errorf("error initializing prometheus exporter: %w", err)
 		}
@@ -303,72 +207,157 @@ func initProvider(pushExporter metric.Exporter, initArgs initArguments) (*metric
 			metric.WithResource(autometricsSrc),
 		), nil
 	} else {
-		autometrics.GetLogger().Debug("opentelemetry: setting up OTLP push configuration, pushing %s to %s\n",
-			autometrics.GetPushJobName(),
-			autometrics.GetPushJobURL(),
+		a.config.GetLogger().Debug("opentelemetry: setting up OTLP push configuration, pushing %s to %s\n",
+			a.config.PushJobName,
+			a.config.PushJobURL,
 		)
 		metricView := metric.NewView(
 			instrumentView,
 			streamView,
 		)
 
-		timeout := defaultPushTimeout
-		interval := defaultPushPeriod
-
-		readInitArgs := false
-		if pushPeriod, ok := os.LookupEnv(autometrics.OTelPushPeriodEnv); ok {
-			pushPeriodMs, err := strconv.ParseInt(pushPeriod, 10, 32)
-			if err != nil {
-				autometrics.GetLogger().Warn("opentelemetry: the push period environment variable has non-integer value, ignoring: %s", err)
-				readInitArgs = true
-			} else {
-				interval = time.Duration(pushPeriodMs) * time.Millisecond
-			}
-		}
-		if readInitArgs && initArgs.pushPeriod > 0 {
-			interval = initArgs.pushPeriod
-		}
-
-		readInitArgs = false
-		if pushTimeout, ok := os.LookupEnv(autometrics.OTelPushTimeoutEnv); ok {
-			pushTimeoutMs, err := strconv.ParseInt(pushTimeout, 10, 32)
-			if err != nil {
-				autometrics.GetLogger().Warn("opentelemetry: the push timeout environment variable has non-integer value, ignoring: %s", err)
-				readInitArgs = true
-			} else {
-				timeout = time.Duration(pushTimeoutMs) * time.Millisecond
-			}
-		}
-		if readInitArgs && initArgs.pushTimeout > 0 {
-			timeout = initArgs.pushTimeout
-		}
+		interval := autometrics.PushPeriod(a.config.GetLogger(), initArgs.pushPeriod, defaultPushPeriod)
+		timeout := autometrics.PushTimeout(a.config.GetLogger(), initArgs.pushTimeout, defaultPushTimeout)
 
-		pushPeriodicReader = metric.NewPeriodicReader(
-			pushExporter,
+		// The timeout of the reader covers all the retries of an export, each attempt having its own timeout.
+		a.pushExporter = newSpoolingExporter(pushExporter, initArgs.pushRetry, initArgs.pushSpoolSize, timeout)
+		a.pushPeriodicReader = metric.NewPeriodicReader(
+			a.pushExporter,
 			metric.WithInterval(interval),
-			metric.WithTimeout(timeout),
+			metric.WithTimeout(initArgs.pushRetry.MaxDuration(timeout)),
 		)
 
 		return metric.NewMeterProvider(
-			metric.WithReader(pushPeriodicReader),
+			metric.WithReader(a.pushPeriodicReader),
 			metric.WithView(metricView),
 			metric.WithResource(autometricsSrc),
 		), nil
 	}
 }
 
-func initPushExporter(initArgs initArguments) (metric.Exporter, error) {
-	autometrics.GetLogger().Debug("opentelemetry: Init: detected push configuration")
+// exporterCollectors forwards the collection of the metrics to the collectors of the Prometheus
+// exporters of the instances.
+//
+// The collectors of the exporters are unchecked, and a Prometheus registry cannot unregister
+// unchecked collectors, so exporterCollectors is registered once to the default registry in their
+// place, and the collector of an instance is removed from it when the instance shuts down.
+var exporterCollectors = &collectorSet{}
+
+var (
+	registerExporterCollectorsOnce sync.Once
+	registerExporterCollectorsErr  error
+)
+
+// collectorSet is an unchecked Prometheus collector collecting the metrics of a set of collectors.
+type collectorSet struct {
+	lock       sync.RWMutex
+	collectors []promclient.Collector
+}
+
+// Describe describes nothing, which makes the set an unchecked collector.
+func (s *collectorSet) Describe(chan<- *promclient.Desc) {}
+
+func (s *collectorSet) Collect(ch chan<- promclient.Metric) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, collector := range s.collectors {
+		collector.Collect(ch)
+	}
+}
+
+func (s *collectorSet) add(collector promclient.Collector) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.collectors = append(s.collectors, collector)
+}
+
+func (s *collectorSet) remove(collector promclient.Collector) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, c := range s.collectors {
+		if c == collector {
+			s.collectors = append(s.collectors[:i], s.collectors[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// exporterRegisterer is the Prometheus registerer of the Prometheus exporter of an instance,
+// adding the collectors to [exporterCollectors] so that they can be removed at shutdown.
+type exporterRegisterer struct {
+	lock       sync.Mutex
+	collectors []promclient.Collector
+}
+
+func (r *exporterRegisterer) Register(collector promclient.Collector) error {
+	registerExporterCollectorsOnce.Do(func() {
+		registerExporterCollectorsErr = promclient.DefaultRegisterer.Register(exporterCollectors)
+	})
+	if registerExporterCollectorsErr != nil {
+		return registerExporterCollectorsErr
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	exporterCollectors.add(collector)
+	r.collectors = append(r.collectors, collector)
+
+	return nil
+}
+
+func (r *exporterRegisterer) MustRegister(collectors ...promclient.Collector) {
+	for _, collector := range collectors {
+		if err := r.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *exporterRegisterer) Unregister(collector promclient.Collector) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, c := range r.collectors {
+		if c == collector {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return exporterCollectors.remove(collector)
+		}
+	}
+
+	return false
+}
+
+// unregisterAll removes all the collectors registered through r.
+func (r *exporterRegisterer) unregisterAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, collector := range r.collectors {
+		exporterCollectors.remove(collector)
+	}
+	r.collectors = nil
+}
+
+func (a *Autometrics) initPushExporter(initArgs initArguments) (metric.Exporter, error) {
+	a.config.GetLogger().Debug("opentelemetry: Init: detected push configuration")
 	if initArgs.pushCollectorURL == "" {
 		return nil, errors.New("invalid Push Configuration: the CollectorURL must be set.")
 	}
-	autometrics.SetPushJobURL(initArgs.pushCollectorURL)
+	a.config.PushJobURL = initArgs.pushCollectorURL
 
-	autometrics.SetPushJobName(initArgs.pushJobName)
+	a.config.PushJobName = initArgs.pushJobName
 
+	// The retries are done by the spooling exporter wrapping the OTLP exporter, with the retry policy of autometrics.
 	if initArgs.pushUseHTTP {
 		options := []otlpmetrichttp.Option{
-			otlpmetrichttp.WithEndpoint(autometrics.GetPushJobURL()),
+			otlpmetrichttp.WithEndpoint(a.config.PushJobURL),
+			otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{Enabled: false}),
 		}
 
 		if initArgs.pushInsecure {
@@ -380,7 +369,7 @@ func initPushExporter(initArgs initArguments) (metric.Exporter, error) {
 		}
 
 		return otlpmetrichttp.New(
-			amCtx,
+			a.ctx,
 			options...,
 		)
 
@@ -389,7 +378,8 @@ func initPushExporter(initArgs initArguments) (metric.Exporter, error) {
 	// If we are here, we are using a gRPC exporter
 
 	options := []otlpmetricgrpc.Option{
-		otlpmetricgrpc.WithEndpoint(autometrics.GetPushJobURL()),
+		otlpmetricgrpc.WithEndpoint(a.config.PushJobURL),
+		otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{Enabled: false}),
 	}
 
 	if initArgs.pushInsecure {
@@ -401,7 +391,7 @@ func initPushExporter(initArgs initArguments) (metric.Exporter, error) {
 	}
 
 	return otlpmetricgrpc.New(
-		amCtx,
+		a.ctx,
 		options...,
 	)
 }
@@ -0,0 +1,135 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+
+import (
+	"context"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// spoolingExporter is a [metric.Exporter] retrying the failed exports of the wrapped exporter,
+// and keeping the snapshots that could not be exported in a spool until the next export.
+type spoolingExporter struct {
+	metric.Exporter
+	queue *am.PushQueue[*metricdata.ResourceMetrics]
+}
+
+func newSpoolingExporter(exporter metric.Exporter, retry am.RetryPolicy, spoolSize int, timeout time.Duration) *spoolingExporter {
+	return &spoolingExporter{
+		Exporter: exporter,
+		queue:    am.NewPushQueue(am.NewMemorySpool[*metricdata.ResourceMetrics](spoolSize), retry, timeout, exporter.Export),
+	}
+}
+
+// Export exports the snapshot along with the snapshots waiting in the spool.
+//
+// The snapshot is copied, as the reader reuses it once Export returns.
+func (e *spoolingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.queue.Push(ctx, copyResourceMetrics(rm))
+}
+
+// ForceFlush exports the snapshots waiting in the spool, and flushes the wrapped exporter.
+func (e *spoolingExporter) ForceFlush(ctx context.Context) error {
+	if err := e.queue.Flush(ctx); err != nil {
+		return err
+	}
+
+	return e.Exporter.ForceFlush(ctx)
+}
+
+// Dropped returns the number of snapshots that have been dropped without being exported.
+func (e *spoolingExporter) Dropped() uint64 {
+	return e.queue.Dropped()
+}
+
+func copyResourceMetrics(rm *metricdata.ResourceMetrics) *metricdata.ResourceMetrics {
+	copied := &metricdata.ResourceMetrics{
+		Resource:     rm.Resource,
+		ScopeMetrics: make([]metricdata.ScopeMetrics, len(rm.ScopeMetrics)),
+	}
+
+	for i, scope := range rm.ScopeMetrics {
+		copied.ScopeMetrics[i] = metricdata.ScopeMetrics{
+			Scope:   scope.Scope,
+			Metrics: make([]metricdata.Metrics, len(scope.Metrics)),
+		}
+		for j, m := range scope.Metrics {
+			copied.ScopeMetrics[i].Metrics[j] = metricdata.Metrics{
+				Name:        m.Name,
+				Description: m.Description,
+				Unit:        m.Unit,
+				Data:        copyAggregation(m.Data),
+			}
+		}
+	}
+
+	return copied
+}
+
+// copyAggregation copies the data points of the aggregations autometrics uses. Other aggregations
+// are kept as they are.
+func copyAggregation(data metricdata.Aggregation) metricdata.Aggregation {
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		data.DataPoints = copyDataPoints(data.DataPoints)
+		return data
+	case metricdata.Sum[float64]:
+		data.DataPoints = copyDataPoints(data.DataPoints)
+		return data
+	case metricdata.Gauge[int64]:
+		data.DataPoints = copyDataPoints(data.DataPoints)
+		return data
+	case metricdata.Gauge[float64]:
+		data.DataPoints = copyDataPoints(data.DataPoints)
+		return data
+	case metricdata.Histogram[int64]:
+		data.DataPoints = copyHistogramDataPoints(data.DataPoints)
+		return data
+	case metricdata.Histogram[float64]:
+		data.DataPoints = copyHistogramDataPoints(data.DataPoints)
+		return data
+	default:
+		return data
+	}
+}
+
+func copyDataPoints[N int64 | float64](points []metricdata.DataPoint[N]) []metricdata.DataPoint[N] {
+	copied := make([]metricdata.DataPoint[N], len(points))
+	for i, point := range points {
+		point.Exemplars = copyExemplars(point.Exemplars)
+		copied[i] = point
+	}
+
+	return copied
+}
+
+func copyHistogramDataPoints[N int64 | float64](points []metricdata.HistogramDataPoint[N]) []metricdata.HistogramDataPoint[N] {
+	copied := make([]metricdata.HistogramDataPoint[N], len(points))
+	for i, point := range points {
+		point.Bounds = append([]float64(nil), point.Bounds...)
+		point.BucketCounts = append([]uint64(nil), point.BucketCounts...)
+		point.Exemplars = copyExemplars(point.Exemplars)
+		copied[i] = point
+	}
+
+	return copied
+}
+
+func copyExemplars[N int64 | float64](exemplars []metricdata.Exemplar[N]) []metricdata.Exemplar[N] {
+	if exemplars == nil {
+		return nil
+	}
+
+	copied := make([]metricdata.Exemplar[N], len(exemplars))
+	for i, exemplar := range exemplars {
+		exemplar.FilteredAttributes = append([]attribute.KeyValue(nil), exemplar.FilteredAttributes...)
+		exemplar.SpanID = append([]byte(nil), exemplar.SpanID...)
+		exemplar.TraceID = append([]byte(nil), exemplar.TraceID...)
+		copied[i] = exemplar
+	}
+
+	return copied
+}
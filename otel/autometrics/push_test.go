@@ -0,0 +1,154 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// fakeExporter records the snapshots it exports, and fails while it is down.
+type fakeExporter struct {
+	down     bool
+	attempts int
+	exported []*metricdata.ResourceMetrics
+	flushes  int
+}
+
+func (e *fakeExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return metric.DefaultTemporalitySelector(kind)
+}
+
+func (e *fakeExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (e *fakeExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	e.attempts++
+	if e.down {
+		return errUnavailable
+	}
+	e.exported = append(e.exported, rm)
+	return nil
+}
+
+func (e *fakeExporter) ForceFlush(context.Context) error {
+	e.flushes++
+	return nil
+}
+
+func (e *fakeExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// snapshot returns metrics with all the aggregations autometrics uses, like the ones the
+// periodic reader collects, where every value is n.
+func snapshot(n int64) *metricdata.ResourceMetrics {
+	exemplars := func() []metricdata.Exemplar[int64] {
+		return []metricdata.Exemplar[int64]{{
+			FilteredAttributes: []attribute.KeyValue{attribute.Int64("n", n)},
+			Value:              n,
+			TraceID:            []byte{byte(n)},
+			SpanID:             []byte{byte(n)},
+		}}
+	}
+
+	return &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Metrics: []metricdata.Metrics{
+				{
+					Name: FunctionCallsCountName,
+					Data: metricdata.Sum[int64]{
+						DataPoints: []metricdata.DataPoint[int64]{{Value: n, Exemplars: exemplars()}},
+					},
+				},
+				{
+					Name: FunctionCallsDurationName,
+					Data: metricdata.Histogram[float64]{
+						DataPoints: []metricdata.HistogramDataPoint[float64]{{
+							Count:        uint64(n),
+							Bounds:       []float64{float64(n)},
+							BucketCounts: []uint64{uint64(n), uint64(n)},
+						}},
+					},
+				},
+				{
+					Name: FunctionCallsConcurrentName,
+					Data: metricdata.Gauge[int64]{
+						DataPoints: []metricdata.DataPoint[int64]{{Value: n}},
+					},
+				},
+			},
+		}},
+	}
+}
+
+// overwrite changes all the values of rm to n in place, like the periodic reader does with the
+// snapshot it gave to the exporter once the export returns.
+func overwrite(rm *metricdata.ResourceMetrics, n int64) {
+	metrics := rm.ScopeMetrics[0].Metrics
+
+	count := metrics[0].Data.(metricdata.Sum[int64])
+	count.DataPoints[0].Value = n
+	count.DataPoints[0].Exemplars[0].Value = n
+	count.DataPoints[0].Exemplars[0].TraceID[0] = byte(n)
+	count.DataPoints[0].Exemplars[0].SpanID[0] = byte(n)
+	count.DataPoints[0].Exemplars[0].FilteredAttributes[0] = attribute.Int64("n", n)
+
+	duration := metrics[1].Data.(metricdata.Histogram[float64])
+	duration.DataPoints[0].Count = uint64(n)
+	duration.DataPoints[0].Bounds[0] = float64(n)
+	duration.DataPoints[0].BucketCounts[0] = uint64(n)
+
+	metrics[2].Data.(metricdata.Gauge[int64]).DataPoints[0].Value = n
+}
+
+func TestCopyResourceMetrics(t *testing.T) {
+	original := snapshot(1)
+	copied := copyResourceMetrics(original)
+	assert.Equal(t, snapshot(1), copied)
+
+	overwrite(original, 2)
+	assert.Equal(t, snapshot(1), copied, "The copy must not share the data points of the original.")
+}
+
+func TestSpoolingExporterSpoolsWhileDown(t *testing.T) {
+	inner := &fakeExporter{down: true}
+	exporter := newSpoolingExporter(inner, NoRetry(), 2, time.Second)
+
+	for n := int64(1); n <= 3; n++ {
+		rm := snapshot(n)
+		assert.ErrorIs(t, exporter.Export(context.Background(), rm), errUnavailable)
+		// The reader reuses the snapshot once Export returns.
+		overwrite(rm, 0)
+	}
+	assert.Equal(t, uint64(1), exporter.Dropped(), "The oldest snapshot must be dropped when the spool is full.")
+
+	inner.down = false
+	assert.NoError(t, exporter.ForceFlush(context.Background()))
+	assert.Equal(t, []*metricdata.ResourceMetrics{snapshot(2), snapshot(3)}, inner.exported)
+	assert.Equal(t, 1, inner.flushes, "The wrapped exporter must be flushed too.")
+
+	assert.NoError(t, exporter.Export(context.Background(), snapshot(4)))
+	assert.Equal(t, snapshot(4), inner.exported[2])
+	assert.Equal(t, uint64(1), exporter.Dropped())
+}
+
+func TestSpoolingExporterRetries(t *testing.T) {
+	inner := &fakeExporter{down: true}
+	retry := am.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2}
+	exporter := newSpoolingExporter(inner, retry, 10, time.Second)
+
+	assert.ErrorIs(t, exporter.Export(context.Background(), snapshot(1)), errUnavailable)
+	assert.Equal(t, 3, inner.attempts, "The export must be retried.")
+	assert.Equal(t, uint64(0), exporter.Dropped(), "A failed export must stay in the spool.")
+}
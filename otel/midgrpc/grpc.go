@@ -0,0 +1,152 @@
+// Package midgrpc contains gRPC interceptors that record every RPC as an autometrics function call.
+package midgrpc // import "github.com/autometrics-dev/autometrics-go/otel/midgrpc"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	otel "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midgrpc"
+)
+
+// WithValidCodes sets the gRPC status codes that Autometrics should consider as "ok" results on calls.
+//
+// This is a reexport to allow using only the current package at call site.
+func WithValidCodes(validCodes ...codes.Code) am.Option {
+	return mid.WithValidCodes(validCodes...)
+}
+
+// UnaryServerInterceptor records each unary RPC served as a function call named after
+// the full method name of the RPC.
+//
+// The trace of the caller is read from the incoming metadata, and the result of the
+// call depends on the status code returned by the handler (see [WithValidCodes]).
+func UnaryServerInterceptor(opts ...am.Option) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		amCtx := otel.PreInstrument(mid.NewServerContext(ctx, info.FullMethod, opts...))
+		if amCtx == nil {
+			// Autometrics is not active
+			return handler(ctx, req)
+		}
+
+		var callErr error
+		defer otel.Instrument(amCtx, &callErr)
+
+		resp, err := handler(amCtx, req)
+		callErr = mid.CodeError(amCtx, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records each streaming RPC served as a function call named
+// after the full method name of the RPC.
+//
+// The trace of the caller is read from the incoming metadata, and the result of the
+// call depends on the status code returned by the handler (see [WithValidCodes]).
+func StreamServerInterceptor(opts ...am.Option) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		amCtx := otel.PreInstrument(mid.NewServerContext(ss.Context(), info.FullMethod, opts...))
+		if amCtx == nil {
+			// Autometrics is not active
+			return handler(srv, ss)
+		}
+
+		var callErr error
+		defer otel.Instrument(amCtx, &callErr)
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: amCtx})
+		callErr = mid.CodeError(amCtx, err)
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor records each unary RPC made as a function call named after the
+// full method name of the RPC, called by the instrumented function found in the context.
+//
+// The trace is propagated in the outgoing metadata, and the result of the call depends
+// on the status code of the response (see [WithValidCodes]).
+func UnaryClientInterceptor(opts ...am.Option) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		amCtx := otel.PreInstrument(mid.NewClientContext(ctx, method, opts...))
+		if amCtx == nil {
+			// Autometrics is not active
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		var callErr error
+		defer otel.Instrument(amCtx, &callErr)
+
+		err := invoker(mid.InjectTraceMetadata(amCtx), method, req, reply, cc, callOpts...)
+		callErr = mid.CodeError(amCtx, err)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor records each streaming RPC made as a function call named after
+// the full method name of the RPC, called by the instrumented function found in the context.
+//
+// The call is recorded when the stream ends, that is when receiving a message returns an
+// error (including [io.EOF]), so the streams must be consumed until then to be recorded.
+// RPCs where only the client streams end with their single response.
+// The trace is propagated in the outgoing metadata, and the result of the call depends on
+// the status code of the response (see [WithValidCodes]).
+func StreamClientInterceptor(opts ...am.Option) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		amCtx := otel.PreInstrument(mid.NewClientContext(ctx, method, opts...))
+		if amCtx == nil {
+			// Autometrics is not active
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+
+		cs, err := streamer(mid.InjectTraceMetadata(amCtx), desc, cc, method, callOpts...)
+		if err != nil {
+			callErr := mid.CodeError(amCtx, err)
+			otel.Instrument(amCtx, &callErr)
+			return cs, err
+		}
+
+		return &clientStream{ClientStream: cs, ctx: amCtx, desc: desc}, nil
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	desc *grpc.StreamDesc
+	once sync.Once
+}
+
+func (cs *clientStream) RecvMsg(m any) error {
+	err := cs.ClientStream.RecvMsg(m)
+	// Without server streaming, the first message received is the response that ends the RPC.
+	if err != nil || !cs.desc.ServerStreams {
+		cs.once.Do(func() {
+			statusErr := err
+			if errors.Is(err, io.EOF) {
+				statusErr = nil
+			}
+			callErr := mid.CodeError(cs.ctx, statusErr)
+			otel.Instrument(cs.ctx, &callErr)
+		})
+	}
+
+	return err
+}
@@ -0,0 +1,170 @@
+package midgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+
+	otel "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+)
+
+// uploadDesc describes a client-streaming RPC, where the server answers the requests it received
+// with a single response once the client closes the stream.
+var uploadDesc = grpc.StreamDesc{
+	StreamName:    "Upload",
+	ClientStreams: true,
+	Handler: func(_ any, stream grpc.ServerStream) error {
+		for {
+			err := stream.RecvMsg(&healthpb.HealthCheckRequest{})
+			if errors.Is(err, io.EOF) {
+				return stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	},
+}
+
+const uploadMethod = "/autometrics.test.Uploader/Upload"
+
+func startServer(t *testing.T, serverOpts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(serverOpts...)
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthSrv)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "autometrics.test.Uploader",
+		HandlerType: (*any)(nil),
+		Streams:     []grpc.StreamDesc{uploadDesc},
+	}, struct{}{})
+
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatalf("dialing the test server: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func initRecorder(t *testing.T) *autometricstest.Recorder {
+	t.Helper()
+
+	recorder := autometricstest.NewRecorder()
+	if _, err := otel.Init(otel.WithRecorders(recorder)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	t.Cleanup(func() { _ = otel.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+var grpcModule = autometricstest.Module("google.golang.org/grpc")
+
+// TestUnaryInterceptors makes sure that both sides of a unary RPC are recorded with the
+// full method name, and that the status codes are mapped to results.
+func TestUnaryInterceptors(t *testing.T) {
+	recorder := initRecorder(t)
+	conn := startServer(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(WithValidCodes(codes.OK, codes.NotFound))),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "serving"})
+	assert.NoError(t, err)
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	check := autometricstest.Function("/grpc.health.v1.Health/Check")
+	assert.Equal(t, 3, recorder.Count(grpcModule, check, autometricstest.Result(am.ResultOk)))
+	assert.Equal(t, 1, recorder.Count(grpcModule, check, autometricstest.Result(am.ResultError)),
+		"the not found error is only valid on the server side")
+}
+
+// TestStreamInterceptors makes sure that server-streaming RPCs are recorded once they end.
+func TestStreamInterceptors(t *testing.T) {
+	recorder := initRecorder(t)
+	conn := startServer(t, grpc.StreamInterceptor(StreamServerInterceptor()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: "serving"})
+	if err != nil {
+		t.Fatalf("starting the watch stream: %s", err)
+	}
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	watch := autometricstest.Function("/grpc.health.v1.Health/Watch")
+	assert.Eventually(t, func() bool {
+		return recorder.Count(grpcModule, watch) == 2
+	}, time.Second, 10*time.Millisecond, "both sides of the stream should be recorded")
+}
+
+// TestClientStreamInterceptor makes sure that client-streaming RPCs are recorded when
+// their single response is received.
+func TestClientStreamInterceptor(t *testing.T) {
+	recorder := initRecorder(t)
+	conn := startServer(t)
+
+	stream, err := conn.NewStream(context.Background(), &uploadDesc, uploadMethod)
+	if err != nil {
+		t.Fatalf("starting the upload stream: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: "serving"}))
+	}
+	// This is what the generated CloseAndRecv methods do.
+	assert.NoError(t, stream.CloseSend())
+	assert.NoError(t, stream.RecvMsg(&healthpb.HealthCheckResponse{}))
+
+	upload := am.FunctionID{Function: uploadMethod, Module: "google.golang.org/grpc"}
+	assert.Equal(t, 1, recorder.Count(grpcModule, autometricstest.Function(uploadMethod), autometricstest.Result(am.ResultOk)))
+	assert.Equal(t, 0, recorder.InFlight(upload), "the RPC should not be running anymore")
+}
+
+// TestValidCodesWithoutOK makes sure that successful RPCs are errors when OK is not a valid code.
+func TestValidCodesWithoutOK(t *testing.T) {
+	recorder := initRecorder(t)
+	conn := startServer(t, grpc.UnaryInterceptor(UnaryServerInterceptor(WithValidCodes(codes.NotFound))))
+
+	_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "serving"})
+	assert.NoError(t, err)
+
+	check := autometricstest.Function("/grpc.health.v1.Health/Check")
+	assert.Equal(t, 1, recorder.Count(grpcModule, check, autometricstest.Result(am.ResultOk)))
+	assert.Equal(t, 1, recorder.Count(grpcModule, check, autometricstest.Result(am.ResultError)),
+		"only the server side should report an error")
+}
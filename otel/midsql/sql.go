@@ -0,0 +1,48 @@
+// Package midsql contains database/sql/driver wrappers that record every database call as an autometrics function call.
+package midsql // import "github.com/autometrics-dev/autometrics-go/otel/midsql"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	otel "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midsql"
+)
+
+func instrumenter(opts []am.Option) mid.Instrumenter {
+	return mid.Instrumenter{
+		PreInstrument: otel.PreInstrument,
+		Instrument:    otel.Instrument,
+		Options:       opts,
+	}
+}
+
+// Wrap returns a driver recording the Exec, Query, Begin, Commit and Rollback calls of
+// the connections it opens as function calls.
+//
+// Exec and Query calls are named after the query name of their context (see [WithQueryName]),
+// and the caller is the instrumented function found in the context. The duration of Query
+// calls does not include reading the returned rows.
+func Wrap(d driver.Driver, opts ...am.Option) driver.Driver {
+	return mid.WrapDriver(d, instrumenter(opts))
+}
+
+// WrapConnector is the equivalent of [Wrap] for connectors, to use with [sql.OpenDB].
+func WrapConnector(c driver.Connector, opts ...am.Option) driver.Connector {
+	return mid.WrapConnector(c, instrumenter(opts))
+}
+
+// Register registers a wrapped version of the driver under a new name, to use with [sql.Open].
+func Register(name string, d driver.Driver, opts ...am.Option) {
+	sql.Register(name, Wrap(d, opts...))
+}
+
+// WithQueryName returns a copy of ctx where the queries are reported as calls to a function
+// named after name.
+//
+// The name must come from a bounded set (like "get_user"), because it is used as a label.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return mid.SetQueryName(ctx, name)
+}
@@ -0,0 +1,158 @@
+package midsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+
+	otel "github.com/autometrics-dev/autometrics-go/otel/autometrics"
+)
+
+var errFake = errors.New("fake failure")
+
+// fakeDriver is an in-memory driver where the "fail" queries return an error, and where the
+// connections skip the "skip" queries, like drivers that only run queries with arguments as
+// prepared statements.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case "fail":
+		return nil, errFake
+	case "skip":
+		return nil, driver.ErrSkip
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	switch query {
+	case "fail":
+		return nil, errFake
+	case "skip":
+		return nil, driver.ErrSkip
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "skip" {
+		return driver.RowsAffected(1), nil
+	}
+	return fakeConn{}.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.query == "skip" {
+		return &fakeRows{}, nil
+	}
+	return fakeConn{}.QueryContext(context.Background(), s.query, nil)
+}
+
+// fakeConnector is a connector of fakeDriver connections, that must be closed.
+type fakeConnector struct{ closed bool }
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+func (c *fakeConnector) Close() error                                 { c.closed = true; return nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Columns() []string { return []string{"id"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+func init() {
+	Register("autometrics-otel-fake", fakeDriver{})
+}
+
+func getUser(ctx context.Context, db *sql.DB) (err error) {
+	amCtx := otel.PreInstrument(otel.NewContext(ctx))
+	defer otel.Instrument(amCtx, &err)
+
+	var id int64
+	return db.QueryRowContext(WithQueryName(amCtx, "get_user"), "SELECT id FROM users").Scan(&id)
+}
+
+// TestDriverWrapper makes sure that every database call is recorded once, with its query
+// name and the instrumented function that made it as caller.
+func TestDriverWrapper(t *testing.T) {
+	recorder := autometricstest.NewRecorder()
+	if _, err := otel.Init(otel.WithRecorders(recorder)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	defer func() { _ = otel.Shutdown(context.Background()) }()
+
+	db, err := sql.Open("autometrics-otel-fake", "")
+	if err != nil {
+		t.Fatalf("opening the database: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	assert.NoError(t, getUser(ctx, db))
+
+	_, err = db.ExecContext(WithQueryName(ctx, "delete_user"), "DELETE FROM users")
+	assert.NoError(t, err)
+	_, err = db.ExecContext(ctx, "fail")
+	assert.ErrorIs(t, err, errFake)
+	_, err = db.ExecContext(WithQueryName(ctx, "skipped_exec"), "skip")
+	assert.NoError(t, err)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if assert.NoError(t, err) {
+		assert.NoError(t, tx.Commit())
+	}
+
+	database := autometricstest.Module("database/sql")
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("get_user"), autometricstest.Caller("getUser")))
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("delete_user"), autometricstest.Result(am.ResultOk)))
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("Exec"), autometricstest.Result(am.ResultError)))
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("skipped_exec"), autometricstest.Result(am.ResultOk)),
+		"a query skipped by the connection should be recorded once")
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("Begin")))
+	assert.Equal(t, 1, recorder.Count(database, autometricstest.Function("Commit")))
+}
+
+func TestConnectorClose(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(WrapConnector(connector))
+
+	assert.NoError(t, db.Close())
+	assert.True(t, connector.closed, "closing the database should close the wrapped connector")
+}
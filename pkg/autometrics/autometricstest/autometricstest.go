@@ -0,0 +1,248 @@
+// Package autometricstest provides utilities to test the instrumentation of functions with autometrics.
+//
+// [Install] adds an in-memory [Recorder] to the default configuration of autometrics, so that
+// unit tests can assert which instrumented functions were called, with which results and by
+// which callers, without scraping metrics. [InstallClock] replaces the clock used to measure
+// the duration of the calls, so that durations are deterministic.
+//
+// As they change the default configuration, which is shared by all the tests of the package,
+// [Install] and [InstallClock] cannot be used in parallel tests (see [testing.T.Parallel]).
+// Parallel tests can instead give their own [Recorder] to a new instance of the backend (with
+// its WithRecorders Init option), and set a [NewClock] as the Clock of the configuration of
+// that instance with [am.Config.Update].
+//
+// The calls are recorded by the default instance of the backend, so Init must have been
+// called before (for example in TestMain, with a private registry):
+//
+//	func TestMain(m *testing.M) {
+//		_, _ = autometrics.Init(autometrics.WithRegistry(prometheus.NewRegistry()))
+//		os.Exit(m.Run())
+//	}
+//
+//	func TestCheckout(t *testing.T) {
+//		recorder := autometricstest.Install(t)
+//
+//		_ = HandleCheckout(context.Background())
+//
+//		calls := recorder.Calls(autometricstest.Function("CreateOrder"))
+//		// calls has 2 elements, and
+//		// recorder.Count(autometricstest.Function("CreateOrder"), autometricstest.Result(autometrics.ResultError),
+//		//	autometricstest.Caller("HandleCheckout")) == 1
+//	}
+package autometricstest // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// Recorder is an [am.Recorder] keeping the function calls in memory.
+//
+// All methods are safe for concurrent use.
+type Recorder struct {
+	lock     sync.Mutex
+	calls    []am.FunctionCall
+	inFlight map[am.FunctionID]int
+}
+
+var _ am.Recorder = (*Recorder)(nil)
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{inFlight: make(map[am.FunctionID]int)}
+}
+
+// Install adds a new Recorder to the default configuration of autometrics, and removes it
+// when the test ends.
+//
+// Install must not be used in parallel tests, as the recorder would receive the calls of the
+// other tests running at the same time.
+func Install(t testing.TB) *Recorder {
+	t.Helper()
+
+	recorder := NewRecorder()
+	config := am.DefaultConfig()
+	var previous []am.Recorder
+	config.Update(func(config *am.Config) {
+		previous = config.Recorders
+		config.Recorders = append(append([]am.Recorder(nil), previous...), recorder)
+	})
+	t.Cleanup(func() {
+		config.Update(func(config *am.Config) {
+			config.Recorders = previous
+		})
+	})
+
+	return recorder
+}
+
+// RecordStart records the start of a call.
+func (r *Recorder) RecordStart(_ context.Context, call am.FunctionCall) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.inFlight[call.CallInfo.Current]++
+}
+
+// RecordEnd records a finished call.
+func (r *Recorder) RecordEnd(_ context.Context, call am.FunctionCall) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.inFlight[call.CallInfo.Current] > 0 {
+		r.inFlight[call.CallInfo.Current]--
+	}
+	r.calls = append(r.calls, call)
+}
+
+// Calls returns the finished calls matching all the filters, in the order they ended.
+func (r *Recorder) Calls(filters ...Filter) []am.FunctionCall {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var calls []am.FunctionCall
+	for _, call := range r.calls {
+		if matches(call, filters) {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Count returns the number of finished calls matching all the filters.
+func (r *Recorder) Count(filters ...Filter) int {
+	return len(r.Calls(filters...))
+}
+
+// InFlight returns the number of running calls of the function.
+func (r *Recorder) InFlight(function am.FunctionID) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.inFlight[function]
+}
+
+// Reset forgets all the recorded calls.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.calls = nil
+	r.inFlight = make(map[am.FunctionID]int)
+}
+
+// Filter selects function calls in [Recorder.Calls] and [Recorder.Count].
+type Filter func(call am.FunctionCall) bool
+
+// Function selects the calls to the functions with the given name.
+func Function(name string) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.CallInfo.Current.Function == name
+	}
+}
+
+// Module selects the calls to the functions of the given module.
+func Module(module string) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.CallInfo.Current.Module == module
+	}
+}
+
+// Caller selects the calls made by the functions with the given name.
+func Caller(name string) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.CallInfo.Parent.Function == name
+	}
+}
+
+// CallerModule selects the calls made by the functions of the given module.
+func CallerModule(module string) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.CallInfo.Parent.Module == module
+	}
+}
+
+// Result selects the calls with the given result.
+func Result(result am.Result) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.Result == result
+	}
+}
+
+// ErrorKind selects the calls with the given error kind.
+func ErrorKind(kind string) Filter {
+	return func(call am.FunctionCall) bool {
+		return call.ErrorKind == kind
+	}
+}
+
+func matches(call am.FunctionCall, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter(call) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clock is a manual clock, that only moves forward when told to.
+//
+// All methods are safe for concurrent use.
+type Clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewClock returns a Clock set at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// InstallClock sets a new Clock, starting at start, as the clock of the default configuration
+// of autometrics, and restores the previous clock when the test ends.
+//
+// The durations of the calls are then the sum of the durations given to [Clock.Advance]
+// while the calls were running.
+//
+// InstallClock must not be used in parallel tests, as the clock would also measure the calls
+// of the other tests running at the same time.
+func InstallClock(t testing.TB, start time.Time) *Clock {
+	t.Helper()
+
+	clock := NewClock(start)
+	config := am.DefaultConfig()
+	var previous func() time.Time
+	config.Update(func(config *am.Config) {
+		previous = config.Clock
+		config.Clock = clock.Now
+	})
+	t.Cleanup(func() {
+		config.Update(func(config *am.Config) {
+			config.Clock = previous
+		})
+	})
+
+	return clock
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,139 @@
+package autometricstest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+var clock *autometricstest.Clock
+
+func TestMain(m *testing.M) {
+	if _, err := prom.Init(prom.WithRegistry(prometheus.NewRegistry())); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func CreateOrder(ctx context.Context, fail bool) (err error) {
+	amCtx := prom.PreInstrument(prom.NewContext(ctx))
+	defer prom.Instrument(amCtx, &err)
+
+	if clock != nil {
+		clock.Advance(250 * time.Millisecond)
+	}
+
+	if fail {
+		return errors.New("out of stock")
+	}
+
+	return nil
+}
+
+func HandleCheckout(ctx context.Context) (err error) {
+	amCtx := prom.PreInstrument(prom.NewContext(ctx))
+	defer prom.Instrument(amCtx, &err)
+
+	_ = CreateOrder(amCtx, false)
+	return CreateOrder(amCtx, true)
+}
+
+// Plugin is instrumented code with a method named like the PreInstrument functions of the
+// backends.
+type Plugin struct{}
+
+func (Plugin) PreInstrument(ctx context.Context) (err error) {
+	amCtx := prom.PreInstrument(prom.NewContext(ctx))
+	defer prom.Instrument(amCtx, &err)
+
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := autometricstest.Install(t)
+
+	_ = HandleCheckout(context.Background())
+
+	assert.Equal(t, 2, recorder.Count(autometricstest.Function("CreateOrder")))
+	assert.Equal(t, 1, recorder.Count(
+		autometricstest.Function("CreateOrder"),
+		autometricstest.Result(am.ResultError),
+		autometricstest.Caller("HandleCheckout")))
+	assert.Equal(t, 1, recorder.Count(
+		autometricstest.Function("HandleCheckout"),
+		autometricstest.Result(am.ResultError)))
+
+	calls := recorder.Calls()
+	if assert.Len(t, calls, 3) {
+		assert.Equal(t, "HandleCheckout", calls[2].CallInfo.Current.Function, "calls are recorded in the order they end")
+		assert.EqualError(t, calls[1].Err, "out of stock")
+	}
+
+	recorder.Reset()
+	assert.Empty(t, recorder.Calls())
+}
+
+func TestClock(t *testing.T) {
+	recorder := autometricstest.Install(t)
+	clock = autometricstest.InstallClock(t, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(func() { clock = nil })
+
+	_ = HandleCheckout(context.Background())
+
+	for _, call := range recorder.Calls(autometricstest.Function("CreateOrder")) {
+		assert.Equal(t, 250*time.Millisecond, call.Duration)
+	}
+	handler := recorder.Calls(autometricstest.Function("HandleCheckout"))
+	if assert.Len(t, handler, 1) {
+		assert.Equal(t, 500*time.Millisecond, handler[0].Duration)
+		assert.Equal(t, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC), handler[0].StartTime)
+	}
+}
+
+// TestPreInstrumentMethod makes sure that only the PreInstrument functions of the backends
+// are skipped when looking for the instrumented function in the call stack.
+func TestPreInstrumentMethod(t *testing.T) {
+	recorder := autometricstest.Install(t)
+
+	_ = Plugin{}.PreInstrument(context.Background())
+
+	calls := recorder.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "PreInstrument", calls[0].CallInfo.Current.Function)
+		assert.Equal(t, "github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest_test.Plugin", calls[0].CallInfo.Current.Module)
+	}
+}
+
+// TestInstallWhileCalling makes sure that installing and removing a recorder and a clock does
+// not race with the instrumented functions running in the background (with go test -race).
+func TestInstallWhileCalling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			_ = CreateOrder(context.Background(), false)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		t.Run("install", func(t *testing.T) {
+			recorder := autometricstest.Install(t)
+			_ = autometricstest.InstallClock(t, time.Now())
+			assert.Eventually(t, func() bool {
+				return recorder.Count(autometricstest.Function("CreateOrder")) > 0
+			}, time.Second, time.Millisecond)
+		})
+	}
+
+	cancel()
+	<-done
+}
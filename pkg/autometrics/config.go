@@ -0,0 +1,205 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config is the configuration of an instance of Autometrics.
+//
+// The backends attach the configuration of their instance to the context of the function
+// calls they instrument (see [SetConfig]), so that several instances with different
+// configurations can coexist in the same process. The package-level setters and getters
+// (like [SetVersion]) modify the default configuration, which applies to contexts without
+// any configuration.
+type Config struct {
+	// Version is the version of the codebase being instrumented.
+	Version string
+	// Commit is the commit of the codebase being instrumented.
+	Commit string
+	// Branch is the branch of the build of the codebase being instrumented.
+	Branch string
+	// Service is the name of the service being instrumented.
+	Service string
+	// RepositoryURL is the URL of the repo of the codebase being instrumented.
+	RepositoryURL string
+	// RepositoryProvider is the service provider of the repo of the codebase being instrumented.
+	RepositoryProvider string
+	// PushJobName is the job name to use when pushing metrics.
+	PushJobName string
+	// PushJobURL is the URL to push metrics to.
+	PushJobURL string
+	// Logger is the logging interface, and a nil Logger does not log anything.
+	Logger log.Logger
+	// ResultClassifier is the classifier for the results of function calls that returned an error.
+	//
+	// When it is nil, all errors are [ResultError].
+	ResultClassifier ResultClassifier
+	// ExtraResults is the exhaustive list of the results the ResultClassifier is allowed to return
+	// on top of [ResultOk] and [ResultError].
+	ExtraResults []Result
+	// ErrorKinds are the registered kinds of errors to report in the error kind label.
+	//
+	// When it is nil, the error kind label is disabled.
+	ErrorKinds []ErrorKind
+	// TraceIDExtractor reads the trace and span IDs of a tracer from contexts.
+	//
+	// When it is nil, autometrics does not read IDs from any tracer.
+	TraceIDExtractor TraceIDExtractor
+	// Tracer starts a span for each instrumented function call.
+	//
+	// When it is nil, autometrics does not start any span.
+	Tracer trace.Tracer
+	// Clock returns the current time, to measure the duration of function calls.
+	//
+	// When it is nil, [time.Now] is used.
+	Clock func() time.Time
+	// Recorders receive the function calls of the instance, on top of its metrics.
+	Recorders []Recorder
+
+	// source is the configuration this one is a snapshot of, and is nil when the configuration
+	// is not a snapshot.
+	source *Config
+}
+
+// configLock guards the fields of the configurations that can change while function calls
+// read them (see [Config.Update] and the package-level setters like [SetVersion]), and the
+// default configuration itself.
+//
+// The snapshots of the configurations never change, so they are read without the lock.
+var configLock sync.RWMutex
+
+// Update calls update to change the fields of the configuration, while no function call
+// reads them. This is only needed once the configuration is in use by an instance.
+//
+// The function calls that already started keep the configuration they started with, and
+// snapshots (see [Config.Snapshot]) must not be updated.
+//
+// update must not call the functions of this package, as they wait for it to return.
+func (config *Config) Update(update func(config *Config)) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	update(config)
+}
+
+// Snapshot returns a copy of the configuration that does not change anymore, to read
+// consistent fields while the configuration may be updated (see [Config.Update]).
+//
+// [StartCall] takes one snapshot for each function call and attaches it to the context of the
+// call, so the snapshot in ctx is returned when it comes from this configuration.
+func (config *Config) Snapshot(ctx context.Context) *Config {
+	if ctx != nil {
+		if current, ok := ctx.Value(currentConfigKey).(*Config); ok && current != nil && current.source == config {
+			return current
+		}
+	}
+
+	return config.snapshot()
+}
+
+// snapshot returns a copy of the configuration that does not change anymore, which is the
+// configuration itself when it is already a snapshot.
+func (config *Config) snapshot() *Config {
+	if config.source != nil {
+		return config
+	}
+
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	snapshot := *config
+	snapshot.source = config
+	return &snapshot
+}
+
+// SetConfig returns a copy of ctx where the function calls are instrumented with the given configuration.
+func SetConfig(ctx context.Context, config *Config) context.Context {
+	return context.WithValue(ctx, currentConfigKey, config)
+}
+
+// GetConfig returns the configuration of the function calls instrumented with ctx, which is the
+// default configuration if ctx does not have any.
+//
+// For the contexts of the function calls started by [StartCall], this is the snapshot of the
+// configuration taken when the call started (see [Config.Snapshot]).
+func GetConfig(ctx context.Context) *Config {
+	if ctx != nil {
+		if config, ok := ctx.Value(currentConfigKey).(*Config); ok && config != nil {
+			return config
+		}
+	}
+
+	return DefaultConfig()
+}
+
+// GetLogger returns the logging interface of the configuration, which is never nil.
+func (config *Config) GetLogger() log.Logger {
+	logger := config.snapshot().Logger
+	if logger == nil {
+		return log.NoOpLogger{}
+	}
+
+	return logger
+}
+
+// Now returns the current time according to the Clock of the configuration.
+func (config *Config) Now() time.Time {
+	clock := config.snapshot().Clock
+	if clock == nil {
+		return time.Now()
+	}
+
+	return clock()
+}
+
+// ClassifyResult returns the result to report for a function call that returned err.
+//
+// It uses the ResultClassifier of the configuration if any. Results returned by the classifier
+// that are not allowed are reported as [ResultError].
+func (config *Config) ClassifyResult(ctx context.Context, err error) Result {
+	if err == nil {
+		return ResultOk
+	}
+
+	current := config.snapshot()
+	if current.ResultClassifier == nil {
+		return ResultError
+	}
+
+	result := current.ResultClassifier(ctx, err)
+	if result == ResultOk || result == ResultError {
+		return result
+	}
+
+	for _, extraResult := range current.ExtraResults {
+		if result == extraResult {
+			return result
+		}
+	}
+
+	config.GetLogger().Warn("autometrics: the result classifier returned %q, which is not in the allowed results %v. Using %q instead.", result, current.ExtraResults, ResultError)
+	return ResultError
+}
+
+// ErrorKindOf returns the value of the error kind label for a function call that returned err.
+//
+// The value is empty when err is nil, the name of the first registered [ErrorKind] that matches
+// otherwise, and [ErrorKindOther] when no registered kind matches.
+func (config *Config) ErrorKindOf(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	for _, kind := range config.snapshot().ErrorKinds {
+		if kind.Matches(err) {
+			return kind.Name
+		}
+	}
+
+	return ErrorKindOther
+}
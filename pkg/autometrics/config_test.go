@@ -0,0 +1,125 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSettersWhileCalling makes sure that the package-level setters do not race with the
+// function calls reading the default configuration (with go test -race).
+func TestSettersWhileCalling(t *testing.T) {
+	previous := DefaultConfig()
+	SetDefaultConfig(&Config{})
+	t.Cleanup(func() { SetDefaultConfig(previous) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ctx.Err() == nil; i++ {
+			callCtx := StartCall(NewContext(nil), DefaultConfig(), nil)
+			err := errors.New("failure")
+			EndCall(callCtx, &err, nil, nil)
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 1000; i++ {
+		SetVersion("1.0.0")
+		SetCommit("abc")
+		SetBranch("main")
+		SetService("api")
+		SetPushJobName("job")
+		SetLogger(log.NoOpLogger{})
+		SetErrorKinds([]ErrorKind{ErrorKindIs("failure", context.Canceled)})
+		SetResultClassifier(func(context.Context, error) Result { return "client_error" }, []Result{"client_error"})
+		SetTraceIDExtractor(nil)
+		SetTracer(nil)
+	}
+
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, "1.0.0", GetVersion())
+	assert.Equal(t, Result("client_error"), ClassifyResult(context.Background(), errors.New("failure")))
+}
+
+// TestSnapshot makes sure that a function call reads the configuration it started with, even
+// when the configuration is updated during the call.
+func TestSnapshot(t *testing.T) {
+	config := &Config{PushJobName: "before"}
+	other := &Config{PushJobName: "other"}
+
+	ctx := StartCall(NewContext(context.Background()), config, nil)
+	config.Update(func(config *Config) { config.PushJobName = "after" })
+
+	snapshot := config.Snapshot(ctx)
+	assert.Same(t, GetConfig(ctx), snapshot, "the snapshot taken when the call started should be reused")
+	assert.Equal(t, "before", snapshot.PushJobName)
+	assert.Same(t, snapshot, snapshot.Snapshot(context.Background()), "a snapshot should not be copied again")
+	assert.Equal(t, "after", config.Snapshot(context.Background()).PushJobName)
+	assert.Equal(t, "other", other.Snapshot(ctx).PushJobName, "the snapshot of the call should only be used for its configuration")
+
+	EndCall(ctx, nil, nil, nil)
+}
+
+func TestClassifyResult(t *testing.T) {
+	errNotFound := errors.New("not found")
+	classifier := func(_ context.Context, err error) Result {
+		switch {
+		case errors.Is(err, context.Canceled):
+			return ResultOk
+		case errors.Is(err, errNotFound):
+			return "not_found"
+		default:
+			return "teapot"
+		}
+	}
+
+	for name, test := range map[string]struct {
+		classifier ResultClassifier
+		err        error
+		result     Result
+	}{
+		"nil error": {
+			classifier: func(context.Context, error) Result { panic("the classifier should not be called") },
+			result:     ResultOk,
+		},
+		"no classifier": {
+			err:    context.Canceled,
+			result: ResultError,
+		},
+		"remapped to ok": {
+			classifier: classifier,
+			err:        fmt.Errorf("handling the request: %w", context.Canceled),
+			result:     ResultOk,
+		},
+		"declared result": {
+			classifier: classifier,
+			err:        errNotFound,
+			result:     "not_found",
+		},
+		"undeclared result": {
+			classifier: classifier,
+			err:        errors.New("failure"),
+			result:     ResultError,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{ResultClassifier: test.classifier, ExtraResults: []Result{"not_found"}, Logger: log.NoOpLogger{}}
+
+			assert.Equal(t, test.result, config.ClassifyResult(context.Background(), test.err))
+		})
+	}
+}
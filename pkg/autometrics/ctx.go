@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -21,9 +22,15 @@ const (
 	currentCallInfoKey
 	currentBuildInfoKey
 	currentValidHttpCodeRangesKey
+	currentStartedSpanKey
+	currentFunctionIDKey
+	currentConfigKey
 )
 
-var randSource *rand.Rand
+var (
+	randSource *rand.Rand
+	randLock   sync.Mutex
+)
 
 // Open Telemetry-compatible trace ID
 type TraceID [16]byte
@@ -188,6 +195,26 @@ func GetBuildInfo(c context.Context) BuildInfo {
 	return build
 }
 
+// SetFunctionID sets the identity of the function call started by the next call to
+// [FillTracingAndCallerInfo] with this context, instead of the function found in the call stack.
+//
+// The empty fields of fid are still filled from the call stack. The caller of the call is only
+// read from the context, as the call stack of a wrapper setting an identity does not contain it.
+// The identity only applies to one call, and is removed from the context returned by
+// [FillTracingAndCallerInfo].
+func SetFunctionID(ctx context.Context, fid FunctionID) context.Context {
+	return context.WithValue(ctx, currentFunctionIDKey, fid)
+}
+
+// GetFunctionID returns (_, false) if the context did not contain any function identity to use.
+func GetFunctionID(c context.Context) (FunctionID, bool) {
+	if c == nil {
+		return FunctionID{}, false
+	}
+	fid, ok := c.Value(currentFunctionIDKey).(FunctionID)
+	return fid, ok
+}
+
 // SetTraceID sets the context's [TraceID]
 func SetTraceID(ctx context.Context, tid TraceID) context.Context {
 	return context.WithValue(ctx, currentTraceIdKey, tid)
@@ -231,47 +258,68 @@ func GetParentSpanID(c context.Context) (SpanID, bool) {
 }
 
 // FillTracingAndCallerInfo ensures the context has a traceID and a spanID, and looks for relevant caller information to add in the context as well.
-// If they do not have this information, this method adds randomly
-// generated IDs in the context to be used later for exemplars
+// When the configuration of the context (see [GetConfig]) has a Tracer, it also starts a span for the current call,
+// which must be ended with [EndSpan].
+// The IDs are read from the span in the context with the TraceIDExtractor of the configuration
+// when possible. Otherwise, this method adds randomly generated IDs in the context to be used later for exemplars.
 //
 // The random generator is a PRNG, seeded with the timestamp of the first time new IDs are needed.
 func FillTracingAndCallerInfo(ctx context.Context) context.Context {
-	// We are using a PRNG because FillTracingInfo is expected to be called in PreInstrument.
-	// Therefore it can have a noticeable impact on the performance of instrumented code.
-	// Pseudo randomness should be enough for our use cases, true randomness might introduce too much latency.
-	// randSource is initialized with a timestamp from the first time it is accessed in nanoseconds, which should
-	// be enough precision to avoid accidental collisions (imagine multiple services starting "at the same time" in a deployment).
-	if randSource == nil {
-		randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
-	}
-
 	if parentSpanId, ok := GetSpanID(ctx); ok {
 		ctx = SetParentSpanID(ctx, parentSpanId)
 	}
 
-	sid := SpanID{}
-	_, _ = randSource.Read(sid[:])
+	// The caller information is computed with the IDs of the caller, before they are replaced
+	// with the ones of the current call.
+	callInfo := callerInfo(ctx)
+	if fid, ok := GetFunctionID(ctx); ok {
+		if fid.Function != "" {
+			callInfo.Current.Function = fid.Function
+		}
+		if fid.Module != "" {
+			callInfo.Current.Module = fid.Module
+		}
+		// The identity only applies to the current call, not to the instrumented functions it calls.
+		ctx = context.WithValue(ctx, currentFunctionIDKey, nil)
+	}
+	ctx = SetCallInfo(ctx, callInfo)
+	ctx = startSpan(ctx, callInfo)
+
+	var (
+		tid          TraceID
+		sid          SpanID
+		hasTracerIDs bool
+	)
+	if extractor := GetConfig(ctx).snapshot().TraceIDExtractor; extractor != nil {
+		tid, sid, hasTracerIDs = extractor.ExtractTraceID(ctx)
+	}
+
+	// The (traceID, spanID) pair identifies the current call when looking for the caller
+	// of the next instrumented functions, so the span of the tracer can only be reused if
+	// no other instrumented function used it already (for example an instrumented caller
+	// that did not start a new span in the tracer.)
+	if !hasTracerIDs || isKnownSpan(tid, sid) {
+		randomBytes(sid[:])
+	}
 	ctx = SetSpanID(ctx, sid)
 
-	if _, ok := GetTraceID(ctx); !ok {
+	if hasTracerIDs {
+		ctx = SetTraceID(ctx, tid)
+	} else if _, ok := GetTraceID(ctx); !ok {
 		tid := TraceID{}
-		_, _ = randSource.Read(tid[:])
+		randomBytes(tid[:])
 		ctx = SetTraceID(ctx, tid)
 	}
 
-	callInfo := callerInfo(ctx)
-	ctx = SetCallInfo(ctx, callInfo)
-
-	// Adds an entry in the global map from current (traceID, spanID) to the function ID
-	// NOTE: this will "leak" memory if PopFunctionName is never called for the matching (TraceId, SpanId) pair.
-	// Calling the cleanup function is the responsibility of the otel.Instrument() and prometheus.Instrument()
-	// functions as the closers.
-	// NOTE: This also means that goroutines that outlive their as the caller will not have access to parent
-	// caller information, but hopefully by that point we got all the necessary accesses done.
-	// If not, it is a convenience we accept to give up to prevent memory usage from exploding.
+	// The callees find their caller in the CallInfo of the context. The (traceID, spanID) pair is also
+	// remembered, for the callees that only receive the tracing IDs of the current call (for example
+	// through a context rebuilt from the span of a tracer.)
+	// NOTE: the entry is removed by PopFunctionName, which is the responsibility of the otel.Instrument()
+	// and prometheus.Instrument() functions as the closers. Entries that are never popped are forgotten
+	// after a while, and only a bounded number of them is kept, so memory usage cannot explode.
 	err := PushFunctionName(ctx, callInfo.Current)
 	if err != nil {
-		GetLogger().Error("adding a function name to the known spans: %s", err)
+		GetConfig(ctx).GetLogger().Error("adding a function name to the known spans: %s", err)
 	}
 
 	return ctx
@@ -281,14 +329,27 @@ func FillTracingAndCallerInfo(ctx context.Context) context.Context {
 //
 // The generator is seeded with the timestamp of the first time a new traceID is needed.
 func GenerateTraceId() TraceID {
+	tid := TraceID{}
+	randomBytes(tid[:])
+
+	return tid
+}
+
+// randomBytes fills b with pseudo-random bytes, and is safe for concurrent use.
+func randomBytes(b []byte) {
+	// We are using a PRNG because random IDs are generated in PreInstrument.
+	// Therefore it can have a noticeable impact on the performance of instrumented code.
+	// Pseudo randomness should be enough for our use cases, true randomness might introduce too much latency.
+	// randSource is initialized with a timestamp from the first time it is accessed in nanoseconds, which should
+	// be enough precision to avoid accidental collisions (imagine multiple services starting "at the same time" in a deployment).
+	randLock.Lock()
+	defer randLock.Unlock()
+
 	if randSource == nil {
 		randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 	}
 
-	tid := TraceID{}
-	randSource.Read(tid[:])
-
-	return tid
+	_, _ = randSource.Read(b)
 }
 
 // WithNewTraceId returns a copy of the passed context, with a newly generated traceID accessible for autometrics.
@@ -299,13 +360,14 @@ func WithNewTraceId(ctx context.Context) context.Context {
 	return context.WithValue(ctx, currentTraceIdKey, GenerateTraceId())
 }
 
-// FillBuildInfo adds the relevant build information to the current context.
+// FillBuildInfo adds the build information of the configuration of the context (see [GetConfig]) to the current context.
 func FillBuildInfo(ctx context.Context) context.Context {
+	config := GetConfig(ctx).snapshot()
 	b := BuildInfo{
-		Version: GetVersion(),
-		Commit:  GetCommit(),
-		Branch:  GetBranch(),
-		Service: GetService(),
+		Version: config.Version,
+		Commit:  config.Commit,
+		Branch:  config.Branch,
+		Service: config.Service,
 	}
 
 	return SetBuildInfo(ctx, b)
@@ -331,7 +393,7 @@ func (r InclusiveIntRange) Contains(value int) bool {
 //
 // This setting is only useful when used in conjunction with the [github.com/autometrics-dev/autometrics-go/pkg/middleware/http/middleware.Autometrics] wrapper.
 func SetValidHttpCodeRanges(ctx context.Context, ranges []InclusiveIntRange) context.Context {
-	return context.WithValue(ctx, currentParentSpanIdKey, ranges)
+	return context.WithValue(ctx, currentValidHttpCodeRangesKey, ranges)
 }
 
 // GetValidHttpCodeRanges returns the list of values that should be considered as "ok" by Autometrics when computing the success rate of a handler.
@@ -345,7 +407,7 @@ func GetValidHttpCodeRanges(c context.Context) []InclusiveIntRange {
 		}}
 	}
 
-	ranges, ok := c.Value(currentParentSpanIdKey).([]InclusiveIntRange)
+	ranges, ok := c.Value(currentValidHttpCodeRangesKey).([]InclusiveIntRange)
 	if !ok {
 		return []InclusiveIntRange{}
 	}
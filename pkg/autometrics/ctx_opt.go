@@ -48,6 +48,19 @@ func WithSpanID(sid []byte) Option {
 	})
 }
 
+// WithFunctionName sets the name of the function reported in the metrics of the
+// call, instead of the name of the function found in the call stack.
+//
+// This is mostly useful for wrappers like HTTP middlewares and clients, where the
+// call stack does not contain any meaningful name.
+func WithFunctionName(name string) Option {
+	return optionFunc(func(ctx context.Context) context.Context {
+		fid, _ := GetFunctionID(ctx)
+		fid.Function = name
+		return SetFunctionID(ctx, fid)
+	})
+}
+
 func WithAlertLatency(target time.Duration, objective float64) Option {
 	return optionFunc(func(ctx context.Context) context.Context {
 		latencySlo := &LatencySlo{
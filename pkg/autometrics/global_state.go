@@ -1,9 +1,11 @@
 package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // These variables are describing the state of the application being autometricized,
@@ -39,16 +41,8 @@ const (
 )
 
 var (
-	version           string
-	commit            string
-	branch            string
-	service           string
-	repoURL           string
-	repoProvider      string
-	pushJobName       string
-	pushJobURL        string
-	instrumentedSpans map[spanKey]FunctionID = make(map[spanKey]FunctionID)
-	logger            log.Logger
+	defaultConfig     = &Config{TraceIDExtractor: OpenTelemetryTraceIDExtractor{}}
+	instrumentedSpans = newKnownSpans(knownSpansCapacity, knownSpansTTL)
 )
 
 type spanKey struct {
@@ -56,99 +50,235 @@ type spanKey struct {
 	sid SpanID
 }
 
+// DefaultConfig returns the default configuration, that applies to the contexts without any
+// configuration (see [GetConfig]).
+func DefaultConfig() *Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	return defaultConfig
+}
+
+// SetDefaultConfig sets the default configuration, that applies to the contexts without any
+// configuration (see [GetConfig]).
+func SetDefaultConfig(newConfig *Config) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	defaultConfig = newConfig
+}
+
+// loadDefaultConfig returns a copy of the default configuration, to read its fields while
+// they may be changed by the setters of this file.
+func loadDefaultConfig() Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	return *defaultConfig
+}
+
+// updateDefaultConfig calls update to change the fields of the default configuration, while
+// no function call reads them.
+func updateDefaultConfig(update func(config *Config)) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	update(defaultConfig)
+}
+
 // GetLogger returns the current logging interface for Autometrics
 func GetLogger() log.Logger {
-	return logger
+	return loadDefaultConfig().Logger
 }
 
 // SetLogger sets the logging interface for Autometrics.
 func SetLogger(newLogger log.Logger) {
-	logger = newLogger
+	updateDefaultConfig(func(config *Config) {
+		config.Logger = newLogger
+	})
 }
 
 // GetVersion returns the version of the codebase being instrumented.
 func GetVersion() string {
-	return version
+	return loadDefaultConfig().Version
 }
 
 // SetVersion sets the version of the codebase being instrumented.
 func SetVersion(newVersion string) {
-	version = newVersion
+	updateDefaultConfig(func(config *Config) {
+		config.Version = newVersion
+	})
 }
 
 // GetCommit returns the commit of the codebase being instrumented.
 func GetCommit() string {
-	return commit
+	return loadDefaultConfig().Commit
 }
 
 // SetCommit sets the commit of the codebase being instrumented.
 func SetCommit(newCommit string) {
-	commit = newCommit
+	updateDefaultConfig(func(config *Config) {
+		config.Commit = newCommit
+	})
 }
 
 // GetBranch returns the branch of the build of the codebase being instrumented.
 func GetBranch() string {
-	return branch
+	return loadDefaultConfig().Branch
 }
 
 // SetBranch sets the branch of the build of the codebase being instrumented.
 func SetBranch(newBranch string) {
-	branch = newBranch
+	updateDefaultConfig(func(config *Config) {
+		config.Branch = newBranch
+	})
 }
 
 // GetService returns the service of the build of the codebase being instrumented.
 func GetService() string {
-	return service
+	return loadDefaultConfig().Service
 }
 
 // SetService sets the service name of the build of the codebase being instrumented.
 func SetService(newService string) {
-	service = newService
+	updateDefaultConfig(func(config *Config) {
+		config.Service = newService
+	})
 }
 
 // GetRepositoryURL returns the URL of the repo of the codebase being instrumented.
 func GetRepositoryURL() string {
-	return repoURL
+	return loadDefaultConfig().RepositoryURL
 }
 
 // SetRepositoryURL sets the URL of the repo of the codebase being instrumented.
 func SetRepositoryURL(newRepositoryURL string) {
-	repoURL = newRepositoryURL
-
+	updateDefaultConfig(func(config *Config) {
+		config.RepositoryURL = newRepositoryURL
+	})
 }
 
 // GetRepositoryProvider returns the service provider of the repo for the codebase being instrumented.
 func GetRepositoryProvider() string {
-	return repoProvider
+	return loadDefaultConfig().RepositoryProvider
 }
 
 // SetRepositoryProvider sets the service provider of the repo for the codebase being instrumented.
 func SetRepositoryProvider(newRepositoryProvider string) {
-	repoProvider = newRepositoryProvider
+	updateDefaultConfig(func(config *Config) {
+		config.RepositoryProvider = newRepositoryProvider
+	})
 }
 
 // GetPushJobName returns the job name to use when the codebase being instrumented is pushing metrics to an OTEL Collector.
 func GetPushJobName() string {
-	return pushJobName
+	return loadDefaultConfig().PushJobName
 }
 
 // SetPushJobName sets the job name to use when the codebase being instrumented is pushing metrics to an OTEL Collector.
 func SetPushJobName(newPushJobName string) {
-	pushJobName = newPushJobName
+	updateDefaultConfig(func(config *Config) {
+		config.PushJobName = newPushJobName
+	})
 }
 
 // GetPushJobURL returns the job url to use when the codebase being instrumented is pushing metrics to an OTEL Collector.
 func GetPushJobURL() string {
-	return pushJobURL
+	return loadDefaultConfig().PushJobURL
 }
 
 // SetPushJobURL sets the job url to use when the codebase being instrumented is pushing metrics to an OTEL Collector.
 func SetPushJobURL(newPushJobURL string) {
-	pushJobURL = newPushJobURL
+	updateDefaultConfig(func(config *Config) {
+		config.PushJobURL = newPushJobURL
+	})
+}
+
+// GetResultClassifier returns the classifier for the results of function calls that returned an error.
+//
+// The returned classifier is nil if none has been set, in which case all errors are [ResultError].
+func GetResultClassifier() ResultClassifier {
+	return loadDefaultConfig().ResultClassifier
+}
+
+// SetResultClassifier sets the classifier for the results of function calls that returned an error.
+//
+// extraResults is the exhaustive list of the results the classifier is allowed to return on top of
+// [ResultOk] and [ResultError]. Keeping this list short ensures the cardinality of the result label
+// stays bounded.
+func SetResultClassifier(newResultClassifier ResultClassifier, newExtraResults []Result) {
+	updateDefaultConfig(func(config *Config) {
+		config.ResultClassifier = newResultClassifier
+		config.ExtraResults = newExtraResults
+	})
+}
+
+// ClassifyResult returns the result to report for a function call that returned err.
+//
+// It uses the classifier of the configuration of ctx (see [GetConfig]) if any. Results returned
+// by the classifier that are not allowed are reported as [ResultError].
+func ClassifyResult(ctx context.Context, err error) Result {
+	return GetConfig(ctx).ClassifyResult(ctx, err)
+}
+
+// GetErrorKinds returns the registered kinds of errors to report in the error kind label.
+//
+// A nil return value means the error kind label is disabled.
+func GetErrorKinds() []ErrorKind {
+	return loadDefaultConfig().ErrorKinds
+}
+
+// SetErrorKinds sets the registered kinds of errors to report in the error kind label.
+func SetErrorKinds(newErrorKinds []ErrorKind) {
+	updateDefaultConfig(func(config *Config) {
+		config.ErrorKinds = newErrorKinds
+	})
+}
+
+// ErrorKindOf returns the value of the error kind label for a function call that returned err,
+// with the error kinds of the default configuration.
+//
+// The value is empty when err is nil, the name of the first registered [ErrorKind] that matches
+// otherwise, and [ErrorKindOther] when no registered kind matches.
+func ErrorKindOf(err error) string {
+	return DefaultConfig().ErrorKindOf(err)
+}
+
+// GetTraceIDExtractor returns the extractor used to read trace and span IDs from contexts.
+//
+// A nil return value means that autometrics does not read IDs from any tracer.
+func GetTraceIDExtractor() TraceIDExtractor {
+	return loadDefaultConfig().TraceIDExtractor
+}
+
+// SetTraceIDExtractor sets the extractor used to read trace and span IDs from contexts.
+func SetTraceIDExtractor(newTraceIDExtractor TraceIDExtractor) {
+	updateDefaultConfig(func(config *Config) {
+		config.TraceIDExtractor = newTraceIDExtractor
+	})
+}
+
+// GetTracer returns the tracer used to start a span for each instrumented function call.
+//
+// A nil return value means that autometrics does not start any span.
+func GetTracer() trace.Tracer {
+	return loadDefaultConfig().Tracer
+}
+
+// SetTracer sets the tracer used to start a span for each instrumented function call.
+func SetTracer(newTracer trace.Tracer) {
+	updateDefaultConfig(func(config *Config) {
+		config.Tracer = newTracer
+	})
+}
+
+func isKnownSpan(traceID TraceID, spanID SpanID) bool {
+	_, ok := instrumentedSpans.fetch(spanKey{tid: traceID, sid: spanID})
+	return ok
 }
 
 func fetchFunctionName(traceID TraceID, spanID SpanID) (FunctionID, error) {
-	fid, ok := instrumentedSpans[spanKey{tid: traceID, sid: spanID}]
+	fid, ok := instrumentedSpans.fetch(spanKey{tid: traceID, sid: spanID})
 	if !ok {
 		return FunctionID{}, fmt.Errorf("%v,%v is not a known traceID/spanID pair now", traceID, spanID)
 	}
@@ -157,9 +287,9 @@ func fetchFunctionName(traceID TraceID, spanID SpanID) (FunctionID, error) {
 }
 
 func popFunctionName(traceID TraceID, spanID SpanID) {
-	delete(instrumentedSpans, spanKey{tid: traceID, sid: spanID})
+	instrumentedSpans.pop(spanKey{tid: traceID, sid: spanID})
 }
 
 func pushFunctionName(traceID TraceID, spanID SpanID, functionID FunctionID) {
-	instrumentedSpans[spanKey{tid: traceID, sid: spanID}] = functionID
+	instrumentedSpans.push(spanKey{tid: traceID, sid: spanID}, functionID)
 }
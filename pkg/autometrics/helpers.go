@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
 	"github.com/oklog/ulid/v2"
 )
 
@@ -37,3 +41,37 @@ func GetOutboundIP() (net.IP, error) {
 func DefaultJobName() string {
 	return ulid.Make().String()
 }
+
+// PushPeriod returns the duration between consecutive metrics pushes.
+//
+// The [OTelPushPeriodEnv] environment variable has precedence over initPeriod, which has
+// precedence over defaultPeriod. Invalid values of the environment variable are logged
+// and ignored, as well as non-positive values of initPeriod.
+func PushPeriod(logger log.Logger, initPeriod, defaultPeriod time.Duration) time.Duration {
+	return envMilliseconds(logger, OTelPushPeriodEnv, initPeriod, defaultPeriod)
+}
+
+// PushTimeout returns the timeout duration of a single metrics push.
+//
+// The [OTelPushTimeoutEnv] environment variable has precedence over initTimeout, which has
+// precedence over defaultTimeout. Invalid values of the environment variable are logged
+// and ignored, as well as non-positive values of initTimeout.
+func PushTimeout(logger log.Logger, initTimeout, defaultTimeout time.Duration) time.Duration {
+	return envMilliseconds(logger, OTelPushTimeoutEnv, initTimeout, defaultTimeout)
+}
+
+func envMilliseconds(logger log.Logger, name string, initValue, defaultValue time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(name); ok {
+		milliseconds, err := strconv.ParseInt(value, 10, 32)
+		if err == nil && milliseconds > 0 {
+			return time.Duration(milliseconds) * time.Millisecond
+		}
+		logger.Warn("autometrics: the %s environment variable must be a positive number of milliseconds, ignoring %q", name, value)
+	}
+
+	if initValue > 0 {
+		return initValue
+	}
+
+	return defaultValue
+}
@@ -2,11 +2,23 @@ package autometrics
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"runtime"
 	"strings"
 )
 
+// libraryPackagePrefix is the prefix of the functions of the packages of the library.
+const libraryPackagePrefix = "github.com/autometrics-dev/autometrics-go/"
+
+// backendPackages are the packages of the backends of the library, whose PreInstrument
+// functions are not part of the instrumented code.
+var backendPackages = map[string]bool{
+	libraryPackagePrefix + "prometheus/autometrics": true,
+	libraryPackagePrefix + "otel/autometrics":       true,
+	libraryPackagePrefix + "statsd/autometrics":     true,
+}
+
 // CallerInfo returns the (method name, module name) of the function that called the function that called this function.
 //
 // It also returns the information about its autometricized grandparent.
@@ -22,13 +34,27 @@ func callerInfo(ctx context.Context) (callInfo CallInfo) {
 	programCounters := make([]uintptr, 15)
 
 	// skip 3 frames to start with:
-	// frame 0: internal function called by `runtime.Callers`
+	// frame 0: `runtime.Callers` itself
 	// frame 1: us calling `runtime.Callers` (this function)
-	// frame 2: Instrument() calling this function -- we don't really care about our own library code
+	// frame 2: FillTracingAndCallerInfo() calling this function
 	entries := runtime.Callers(3, programCounters)
 
 	frames := runtime.CallersFrames(programCounters[:entries])
 	frame, hasParent := frames.Next()
+	// StartCall and the PreInstrument functions calling FillTracingAndCallerInfo are skipped too -- we don't
+	// really care about our own library code. There can be several of them, as the package-level
+	// PreInstrument functions of the backends delegate to the one of their default instance.
+	if hasParent && frame.Function == libraryPackagePrefix+"pkg/autometrics.StartCall" {
+		frame, hasParent = frames.Next()
+	}
+	// The backend calling StartCall may live outside of the library.
+	callingBackend, _ := preInstrumentPackage(frame)
+	for hasParent {
+		if backend, ok := preInstrumentPackage(frame); !ok || (backend != callingBackend && !backendPackages[backend]) {
+			break
+		}
+		frame, hasParent = frames.Next()
+	}
 
 	functionName := frame.Function
 	index := strings.LastIndex(functionName, ".")
@@ -45,11 +71,23 @@ func callerInfo(ctx context.Context) (callInfo CallInfo) {
 		callInfo.Current.Function = functionName[index+1:]
 	}
 
+	// The context of an instrumented caller carries its own function ID
+	if parent := GetCallInfo(ctx).Current; parent.Function != "" {
+		callInfo.Parent = parent
+		return
+	}
+
 	parent, err := ParentFunctionName(ctx)
+	if err != nil {
+		parent, err = tracerParentFunctionName(ctx)
+	}
 
 	if err != nil {
-		// We try to fallback to the parent in the call stack if we don't have the info
-		if !hasParent {
+		// We try to fallback to the parent in the call stack if we don't have the info.
+		// Calls with an explicit function identity come from wrappers (like the HTTP middlewares
+		// and the gRPC interceptors) whose callers in the call stack are library internals, so
+		// they are left without a parent instead.
+		if _, hasFunctionID := GetFunctionID(ctx); hasFunctionID || !hasParent {
 			return
 		}
 
@@ -77,6 +115,40 @@ func callerInfo(ctx context.Context) (callInfo CallInfo) {
 	return
 }
 
+// preInstrumentPackage returns the import path of the package of the frame, and false if
+// the frame is not a PreInstrument function or method.
+func preInstrumentPackage(frame runtime.Frame) (string, bool) {
+	function, ok := strings.CutSuffix(frame.Function, ".PreInstrument")
+	if !ok {
+		return "", false
+	}
+
+	// Methods have their receiver between the package and the name, like in
+	// "example.com/backend.(*Autometrics).PreInstrument".
+	lastSlash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[lastSlash+1:], "."); dot != -1 {
+		function = function[:lastSlash+1+dot]
+	}
+
+	return function, true
+}
+
+// tracerParentFunctionName returns the function ID of the instrumented call that owns the
+// span of the tracer in ctx, for callers that only passed down the span of the tracer.
+func tracerParentFunctionName(ctx context.Context) (FunctionID, error) {
+	extractor := GetConfig(ctx).snapshot().TraceIDExtractor
+	if extractor == nil {
+		return FunctionID{}, errors.New("no trace ID extractor to follow the span of the context.")
+	}
+
+	tid, sid, ok := extractor.ExtractTraceID(ctx)
+	if !ok {
+		return FunctionID{}, errors.New("context does not have any span of a tracer to follow.")
+	}
+
+	return fetchFunctionName(tid, sid)
+}
+
 // ReflectFunctionModuleName takes any function and returns it's name and module split.
 //
 // There is no `caller` in this context (we just use reflection to extract the information
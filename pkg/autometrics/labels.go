@@ -0,0 +1,115 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import "strconv"
+
+// LabelNames are the names a backend gives to the labels of the function calls metrics.
+//
+// The backends only differ by the names of the labels (for example "caller_function" for
+// Prometheus and "caller.function" for OpenTelemetry), so their values are computed once from
+// the [FunctionCall] by the methods of LabelNames. Labels with an empty name are left out.
+//
+// The configuration given to the methods is best a snapshot (see [Config.Snapshot]), so that
+// it is not read again for each set of labels.
+type LabelNames struct {
+	Function          string
+	Module            string
+	CallerFunction    string
+	CallerModule      string
+	Result            string
+	ErrorKind         string
+	TargetLatency     string
+	TargetSuccessRate string
+	SloName           string
+	Commit            string
+	Version           string
+	Branch            string
+	Service           string
+	JobName           string
+}
+
+// CallsCountLabels returns the labels of the function calls counter for call.
+//
+// The error kind label is only present when config has registered error kinds.
+func (names LabelNames) CallsCountLabels(config *Config, call FunctionCall) map[string]string {
+	config = config.snapshot()
+	labels := names.callLabels(config, call)
+	slo := sloLabelValues(call.AlertConfiguration)
+
+	names.set(labels, names.Result, string(call.Result))
+	names.set(labels, names.TargetSuccessRate, slo.successObjective)
+	names.set(labels, names.SloName, slo.name)
+	if config.ErrorKinds != nil {
+		names.set(labels, names.ErrorKind, call.ErrorKind)
+	}
+
+	return labels
+}
+
+// CallsDurationLabels returns the labels of the function calls duration histogram for call.
+func (names LabelNames) CallsDurationLabels(config *Config, call FunctionCall) map[string]string {
+	labels := names.callLabels(config.snapshot(), call)
+	slo := sloLabelValues(call.AlertConfiguration)
+
+	names.set(labels, names.TargetLatency, slo.latencyTarget)
+	names.set(labels, names.TargetSuccessRate, slo.latencyObjective)
+	names.set(labels, names.SloName, slo.name)
+
+	return labels
+}
+
+// CallsConcurrentLabels returns the labels of the concurrent function calls gauge for call.
+func (names LabelNames) CallsConcurrentLabels(config *Config, call FunctionCall) map[string]string {
+	return names.callLabels(config.snapshot(), call)
+}
+
+// callLabels returns the labels shared by all the function calls metrics.
+//
+// config is read without any lock, so it must be a snapshot.
+func (names LabelNames) callLabels(config *Config, call FunctionCall) map[string]string {
+	labels := make(map[string]string, 16)
+
+	names.set(labels, names.Function, call.CallInfo.Current.Function)
+	names.set(labels, names.Module, call.CallInfo.Current.Module)
+	names.set(labels, names.CallerFunction, call.CallInfo.Parent.Function)
+	names.set(labels, names.CallerModule, call.CallInfo.Parent.Module)
+	names.set(labels, names.Commit, call.BuildInfo.Commit)
+	names.set(labels, names.Version, call.BuildInfo.Version)
+	names.set(labels, names.Branch, call.BuildInfo.Branch)
+	names.set(labels, names.Service, call.BuildInfo.Service)
+	names.set(labels, names.JobName, config.PushJobName)
+
+	return labels
+}
+
+func (names LabelNames) set(labels map[string]string, name, value string) {
+	if name != "" {
+		labels[name] = value
+	}
+}
+
+// sloLabels are the values of the labels describing the Service Level Objective of a function.
+type sloLabels struct {
+	name             string
+	latencyTarget    string
+	latencyObjective string
+	successObjective string
+}
+
+func sloLabelValues(slo AlertConfiguration) (labels sloLabels) {
+	if slo.ServiceName == "" {
+		return
+	}
+
+	labels.name = slo.ServiceName
+
+	if slo.Latency != nil {
+		labels.latencyTarget = strconv.FormatFloat(slo.Latency.Target.Seconds(), 'f', -1, 64)
+		labels.latencyObjective = strconv.FormatFloat(slo.Latency.Objective, 'f', -1, 64)
+	}
+
+	if slo.Success != nil {
+		labels.successObjective = strconv.FormatFloat(slo.Success.Objective, 'f', -1, 64)
+	}
+
+	return
+}
@@ -1,6 +1,8 @@
 package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 
 import (
+	"context"
+	"errors"
 	"time"
 )
 
@@ -22,8 +24,63 @@ type Implementation int
 const (
 	PROMETHEUS Implementation = iota
 	OTEL
+	STATSD
 )
 
+// Result is the outcome of a function call, as reported in the result label of the metrics.
+type Result string
+
+const (
+	// ResultOk is the result of a successful function call.
+	ResultOk Result = "ok"
+	// ResultError is the result of a failed function call.
+	//
+	// This is the only result that counts against success rate objectives.
+	ResultError Result = "error"
+)
+
+// ResultClassifier decides the result of a function call that returned a non-nil error.
+//
+// The classifier is never called for function calls that returned a nil error (they
+// are always [ResultOk]), nor for calls that panicked (they are always [ResultError]).
+type ResultClassifier func(ctx context.Context, err error) Result
+
+const (
+	// ErrorKindOther is the error kind of errors that do not match any registered [ErrorKind].
+	ErrorKindOther = "other"
+	// ErrorKindPanic is the error kind of function calls that panicked.
+	ErrorKindPanic = "panic"
+)
+
+// ErrorKind is a named family of errors, used to fill the error kind label of the metrics.
+type ErrorKind struct {
+	// Name is the value of the error kind label for the matching errors.
+	Name string
+	// Matches returns whether the error belongs to the kind.
+	Matches func(err error) bool
+}
+
+// ErrorKindIs returns an [ErrorKind] matching all the errors that wrap target, according to [errors.Is].
+func ErrorKindIs(name string, target error) ErrorKind {
+	return ErrorKind{
+		Name: name,
+		Matches: func(err error) bool {
+			return errors.Is(err, target)
+		},
+	}
+}
+
+// ErrorKindAs returns an [ErrorKind] matching all the errors that wrap an error of type T, according to [errors.As].
+func ErrorKindAs[T error](name string) ErrorKind {
+	return ErrorKind{
+		Name: name,
+		Matches: func(err error) bool {
+			var target T
+			return errors.As(err, &target)
+		},
+	}
+}
+
 const (
 	// MiddlewareSpanIDKey is the key to use to index context in middlewares that do not use context.Context.
 	MiddlewareSpanIDKey = "autometricsSpanID"
@@ -0,0 +1,154 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FunctionCall is the record of a call to an instrumented function.
+type FunctionCall struct {
+	// CallInfo identifies the function and its caller.
+	CallInfo CallInfo
+	// BuildInfo is the build information of the instrumented codebase.
+	BuildInfo BuildInfo
+	// AlertConfiguration is the Service Level Objective of the function, if any.
+	AlertConfiguration AlertConfiguration
+	// TrackConcurrentCalls is true when the call counts in the concurrent calls of the function.
+	TrackConcurrentCalls bool
+	// StartTime is the time at which the call started.
+	StartTime time.Time
+	// Duration is the duration of the call, which is zero while the call is running.
+	Duration time.Duration
+	// Result is the result of the call, which is empty while the call is running.
+	Result Result
+	// ErrorKind is the value of the error kind label of the call, which is empty for successful calls
+	// and when error kinds are disabled.
+	ErrorKind string
+	// Err is the error of the call. Panics are reported as errors too.
+	Err error
+	// TraceID is the trace ID of the call, to use in exemplars. It is zero when unknown.
+	TraceID TraceID
+	// SpanID is the span ID of the call, to use in exemplars. It is zero when unknown.
+	SpanID SpanID
+	// ParentSpanID is the span ID of the caller, to use in exemplars. It is zero when unknown.
+	ParentSpanID SpanID
+}
+
+// Recorder receives the function calls of an instance of Autometrics.
+//
+// The backends are Recorders turning the calls into metrics, and other Recorders can be
+// registered in the Recorders of the [Config] of an instance to receive the calls too. Their
+// methods are called synchronously by the instrumented functions, so they must be safe for
+// concurrent use and return quickly.
+type Recorder interface {
+	// RecordStart is called when a function call starts, in PreInstrument.
+	RecordStart(ctx context.Context, call FunctionCall)
+	// RecordEnd is called when a function call ends, in Instrument.
+	RecordEnd(ctx context.Context, call FunctionCall)
+}
+
+// StartCall runs the "before wrappee" part of instrumentation shared by all backends.
+//
+// It attaches a snapshot of config to ctx (see [Config.Snapshot]), fills ctx with the tracing,
+// caller and build information of the call and its start time, and then notifies recorder (the
+// backend itself) and the Recorders of config of the start of the call. It is meant to be called by the PreInstrument function of
+// a backend, which is skipped when looking for the instrumented function in the call stack.
+func StartCall(ctx context.Context, config *Config, recorder Recorder) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// The configuration is read once for the whole call, instead of each time one of its fields is needed
+	config = config.snapshot()
+	ctx = SetConfig(ctx, config)
+	ctx = FillTracingAndCallerInfo(ctx)
+	ctx = FillBuildInfo(ctx)
+	ctx = SetStartTime(ctx, config.Now())
+
+	call := StartedCall(ctx)
+	if recorder != nil {
+		recorder.RecordStart(ctx, call)
+	}
+	for _, extraRecorder := range config.Recorders {
+		extraRecorder.RecordStart(ctx, call)
+	}
+
+	return ctx
+}
+
+// EndCall runs the "after wrappee" part of instrumentation shared by all backends, for the
+// call started with ctx by [StartCall], that returned err or panicked with panicValue.
+//
+// It notifies recorder (the backend itself) and the Recorders of the configuration of ctx of the
+// end of the call, and then ends its span. It is meant to be called by the Instrument function
+// of a backend, after it recovered panicValue.
+func EndCall(ctx context.Context, err *error, panicValue any, recorder Recorder) {
+	if ctx == nil {
+		return
+	}
+
+	call := FinishedCall(ctx, err, panicValue)
+	if recorder != nil {
+		recorder.RecordEnd(ctx, call)
+	}
+	for _, extraRecorder := range GetConfig(ctx).snapshot().Recorders {
+		extraRecorder.RecordEnd(ctx, call)
+	}
+
+	EndSpan(ctx, call.Result, call.Err)
+
+	// NOTE: This call means that goroutines that outlive this function as the caller will not have access to parent
+	// caller information, but hopefully by that point we got all the necessary accesses done.
+	// If not, it is a convenience we accept to give up to prevent memory usage from exploding
+	_ = PopFunctionName(ctx)
+}
+
+// StartedCall returns the record of the function call that starts with ctx.
+//
+// It is meant to be called once the context holds all the information about the call, like
+// [StartCall] does.
+func StartedCall(ctx context.Context) FunctionCall {
+	call := FunctionCall{
+		CallInfo:             GetCallInfo(ctx),
+		BuildInfo:            GetBuildInfo(ctx),
+		AlertConfiguration:   GetAlertConfiguration(ctx),
+		TrackConcurrentCalls: GetTrackConcurrentCalls(ctx),
+		StartTime:            GetStartTime(ctx),
+	}
+
+	call.TraceID, _ = GetTraceID(ctx)
+	call.SpanID, _ = GetSpanID(ctx)
+	call.ParentSpanID, _ = GetParentSpanID(ctx)
+
+	return call
+}
+
+// FinishedCall returns the record of the function call started with ctx, that returned err
+// or panicked with panicValue.
+//
+// The result and the error kind of the call are computed with the configuration of ctx
+// (see [GetConfig]), and the duration with its clock.
+func FinishedCall(ctx context.Context, err *error, panicValue any) FunctionCall {
+	config := GetConfig(ctx).snapshot()
+	call := StartedCall(ctx)
+	call.Duration = config.Now().Sub(call.StartTime)
+
+	call.Result = ResultOk
+	if panicValue != nil {
+		call.Result = ResultError
+		call.Err = fmt.Errorf("panic: %v", panicValue)
+	} else if err != nil {
+		call.Err = *err
+		call.Result = config.ClassifyResult(ctx, call.Err)
+	}
+
+	if config.ErrorKinds != nil && call.Result != ResultOk {
+		if panicValue != nil {
+			call.ErrorKind = ErrorKindPanic
+		} else {
+			call.ErrorKind = config.ErrorKindOf(call.Err)
+		}
+	}
+
+	return call
+}
@@ -0,0 +1,146 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RetryPolicy decides how a failed push of metrics is retried, with an exponential backoff
+// between the attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a push, including the first one.
+	// A value of 1 or less disables the retries.
+	MaxAttempts int
+	// InitialBackoff is the duration to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the duration to wait between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the backoff after each retry. Values lower than 1 are
+	// treated as 1.
+	Multiplier float64
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured: 5 attempts, waiting
+// 500ms before the first retry and doubling the backoff up to 10 seconds.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// NoRetry returns a policy that never retries failed pushes.
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// Validate returns an error if the policy cannot be used.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts > 1 && p.InitialBackoff <= 0 {
+		return errors.New("the initial backoff of a retry policy must be positive")
+	}
+	if p.MaxBackoff < 0 {
+		return errors.New("the maximum backoff of a retry policy cannot be negative")
+	}
+
+	return nil
+}
+
+// Backoff returns the duration to wait before the given retry, starting at 1 for the first retry.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+// MaxDuration returns the longest duration of a push with the policy, when each attempt
+// times out after timeout.
+func (p RetryPolicy) MaxDuration(timeout time.Duration) time.Duration {
+	duration := timeout
+	for retry := 1; retry < p.MaxAttempts; retry++ {
+		duration += p.Backoff(retry) + timeout
+	}
+
+	return duration
+}
+
+// Do calls attempt until it succeeds, the attempts of the policy are exhausted or ctx is done,
+// waiting the backoff of the policy between the attempts. Each attempt gets its own timeout
+// when timeout is positive.
+//
+// It returns the error of the last attempt. Permanent errors (see [Permanent]) are not retried.
+func (p RetryPolicy) Do(ctx context.Context, timeout time.Duration, attempt func(context.Context) error) error {
+	var err error
+	for try := 1; ; try++ {
+		err = withTimeout(ctx, timeout, attempt)
+		if err == nil || IsPermanent(err) {
+			return err
+		}
+		if try >= p.MaxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(p.Backoff(try))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (retries interrupted: %s)", err, context.Cause(ctx))
+		case <-timer.C:
+		}
+	}
+
+	if p.MaxAttempts > 1 {
+		return fmt.Errorf("%w (after %d attempts)", err, p.MaxAttempts)
+	}
+	return err
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration, attempt func(context.Context) error) error {
+	if timeout <= 0 {
+		return attempt(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return attempt(ctx)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error of a push that must not be retried, like the rejection of invalid data.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+// IsPermanent returns true if the error of a push has been marked with [Permanent].
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,94 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// knownSpansCapacity is the maximum number of instrumented calls remembered at once.
+	//
+	// Older entries are overwritten when more calls are in flight, which only matters for
+	// callers that lost the autometrics context (see [FillTracingAndCallerInfo].)
+	knownSpansCapacity = 4096
+	// knownSpansTTL is the duration after which an instrumented call is forgotten, even if
+	// its Instrument function has not been called (for example because of a missing defer.)
+	knownSpansTTL = 5 * time.Minute
+)
+
+type knownSpan struct {
+	key       spanKey
+	function  FunctionID
+	expiresAt time.Time
+}
+
+// knownSpans remembers the function IDs of the in-flight instrumented calls, by (traceID, spanID) pair.
+//
+// The entries are stored in a fixed-size ring, so memory usage is bounded no matter how many
+// calls are never popped, and the oldest entries are overwritten first.
+// All methods are safe for concurrent use.
+type knownSpans struct {
+	lock  sync.Mutex
+	index map[spanKey]int
+	ring  []knownSpan
+	next  int
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func newKnownSpans(capacity int, ttl time.Duration) *knownSpans {
+	return &knownSpans{
+		index: make(map[spanKey]int, capacity),
+		ring:  make([]knownSpan, capacity),
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+func (s *knownSpans) push(key spanKey, functionID FunctionID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if slot, ok := s.index[key]; ok {
+		s.ring[slot].function = functionID
+		s.ring[slot].expiresAt = s.now().Add(s.ttl)
+		return
+	}
+
+	slot := s.next
+	if oldSlot, ok := s.index[s.ring[slot].key]; ok && oldSlot == slot {
+		delete(s.index, s.ring[slot].key)
+	}
+	s.ring[slot] = knownSpan{key: key, function: functionID, expiresAt: s.now().Add(s.ttl)}
+	s.index[key] = slot
+	s.next = (slot + 1) % len(s.ring)
+}
+
+func (s *knownSpans) pop(key spanKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if slot, ok := s.index[key]; ok {
+		delete(s.index, key)
+		s.ring[slot] = knownSpan{}
+	}
+}
+
+func (s *knownSpans) fetch(key spanKey) (FunctionID, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	slot, ok := s.index[key]
+	if !ok {
+		return FunctionID{}, false
+	}
+
+	entry := s.ring[slot]
+	if !s.now().Before(entry.expiresAt) {
+		delete(s.index, key)
+		s.ring[slot] = knownSpan{}
+		return FunctionID{}, false
+	}
+
+	return entry.function, true
+}
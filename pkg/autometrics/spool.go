@@ -0,0 +1,291 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Spool is a bounded queue of the snapshots of metrics waiting to be pushed.
+//
+// When the spool is full, adding a snapshot drops the oldest one. Spools are not safe for
+// concurrent use: the [PushQueue] using a spool serializes the accesses.
+type Spool[T any] interface {
+	// Add queues a snapshot, and returns the number of snapshots dropped to make room for it.
+	Add(snapshot T) (dropped int, err error)
+	// Peek returns the oldest snapshot, and false when the spool is empty.
+	Peek() (snapshot T, ok bool, err error)
+	// Remove removes the oldest snapshot.
+	Remove() error
+	// Len returns the number of snapshots in the spool.
+	Len() int
+}
+
+// NewMemorySpool returns a spool keeping up to maxSize snapshots in memory.
+//
+// A maxSize lower than 1 keeps only the last snapshot.
+func NewMemorySpool[T any](maxSize int) Spool[T] {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	return &memorySpool[T]{maxSize: maxSize}
+}
+
+// NewLatestSpool returns a spool keeping only the last snapshot in memory, for targets where
+// a snapshot supersedes the previous ones (like the current values of the metrics pushed to a
+// Prometheus Push Gateway).
+//
+// Unlike a memory spool of size 1, replacing the snapshot is not counted as a drop, as the new
+// snapshot carries everything the previous one did.
+func NewLatestSpool[T any]() Spool[T] {
+	return &memorySpool[T]{maxSize: 1, replace: true}
+}
+
+type memorySpool[T any] struct {
+	maxSize int
+	// replace is true when the new snapshots supersede the ones they push out of the spool.
+	replace   bool
+	snapshots []T
+}
+
+func (s *memorySpool[T]) Add(snapshot T) (int, error) {
+	dropped := 0
+	for len(s.snapshots) >= s.maxSize {
+		s.removeOldest()
+		if !s.replace {
+			dropped++
+		}
+	}
+	s.snapshots = append(s.snapshots, snapshot)
+
+	return dropped, nil
+}
+
+func (s *memorySpool[T]) Peek() (T, bool, error) {
+	if len(s.snapshots) == 0 {
+		var zero T
+		return zero, false, nil
+	}
+
+	return s.snapshots[0], true, nil
+}
+
+func (s *memorySpool[T]) Remove() error {
+	if len(s.snapshots) > 0 {
+		s.removeOldest()
+	}
+
+	return nil
+}
+
+func (s *memorySpool[T]) Len() int {
+	return len(s.snapshots)
+}
+
+func (s *memorySpool[T]) removeOldest() {
+	var zero T
+	s.snapshots[0] = zero
+	s.snapshots = s.snapshots[1:]
+}
+
+const spoolFileSuffix = ".snapshot"
+
+// NewDiskSpool returns a spool keeping up to maxSize encoded snapshots as files in dir, so that
+// the snapshots that could not be pushed survive a restart of the program.
+//
+// The directory is created if needed, and the snapshots already in it are pushed first.
+// A maxSize lower than 1 keeps only the last snapshot.
+func NewDiskSpool(dir string, maxSize int) (Spool[[]byte], error) {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %w", err)
+	}
+
+	s := &diskSpool{dir: dir, maxSize: maxSize}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			s.files = append(s.files, entry.Name())
+		}
+	}
+	sort.Strings(s.files)
+
+	return s, nil
+}
+
+type diskSpool struct {
+	dir     string
+	maxSize int
+	// files are the names of the snapshot files, from the oldest to the newest.
+	files    []string
+	sequence uint64
+}
+
+func (s *diskSpool) Add(snapshot []byte) (int, error) {
+	dropped := 0
+	for len(s.files) >= s.maxSize {
+		if err := s.Remove(); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	// The names sort in the order the snapshots are added, even across restarts.
+	s.sequence++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.sequence%1000000, spoolFileSuffix)
+
+	// Writing to a temporary file first ensures that the spool never contains partial snapshots.
+	temporary := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(temporary, snapshot, 0o600); err != nil {
+		return dropped, fmt.Errorf("writing snapshot to spool: %w", err)
+	}
+	if err := os.Rename(temporary, filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(temporary)
+		return dropped, fmt.Errorf("writing snapshot to spool: %w", err)
+	}
+	s.files = append(s.files, name)
+
+	return dropped, nil
+}
+
+func (s *diskSpool) Peek() ([]byte, bool, error) {
+	if len(s.files) == 0 {
+		return nil, false, nil
+	}
+
+	snapshot, err := os.ReadFile(filepath.Join(s.dir, s.files[0]))
+	if err != nil {
+		return nil, true, fmt.Errorf("reading snapshot from spool: %w", err)
+	}
+
+	return snapshot, true, nil
+}
+
+func (s *diskSpool) Remove() error {
+	if len(s.files) == 0 {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(s.dir, s.files[0]))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing snapshot from spool: %w", err)
+	}
+	s.files = s.files[1:]
+
+	return nil
+}
+
+func (s *diskSpool) Len() int {
+	return len(s.files)
+}
+
+// PushQueue pushes snapshots of metrics, retrying the failed pushes with its [RetryPolicy] and
+// keeping the snapshots that could not be pushed in its [Spool] until the next push.
+//
+// The snapshots dropped because the spool is full, or because they cannot be read or pushed,
+// are counted so that backends can report them in their own metrics.
+type PushQueue[T any] struct {
+	spool   Spool[T]
+	retry   RetryPolicy
+	timeout time.Duration
+	send    func(context.Context, T) error
+
+	lock    sync.Mutex
+	dropped atomic.Uint64
+}
+
+// NewPushQueue returns a queue pushing the snapshots with send, each attempt being limited to timeout.
+func NewPushQueue[T any](spool Spool[T], retry RetryPolicy, timeout time.Duration, send func(context.Context, T) error) *PushQueue[T] {
+	return &PushQueue[T]{
+		spool:   spool,
+		retry:   retry,
+		timeout: timeout,
+		send:    send,
+	}
+}
+
+// Push adds the snapshot to the spool, and pushes all the snapshots of the spool in order.
+//
+// Pushing stops at the first snapshot that cannot be pushed after the retries, which stays
+// in the spool for the next push, and whose error is returned. The snapshots rejected with
+// a permanent error (see [Permanent]) are dropped instead.
+func (q *PushQueue[T]) Push(ctx context.Context, snapshot T) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	dropped, err := q.spool.Add(snapshot)
+	q.dropped.Add(uint64(dropped))
+	if err != nil {
+		q.dropped.Add(1)
+		return err
+	}
+
+	return q.flush(ctx)
+}
+
+// Flush pushes all the snapshots of the spool in order, like [PushQueue.Push] without adding one.
+func (q *PushQueue[T]) Flush(ctx context.Context) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.flush(ctx)
+}
+
+func (q *PushQueue[T]) flush(ctx context.Context) error {
+	for {
+		snapshot, ok, err := q.spool.Peek()
+		if !ok {
+			return nil
+		}
+		if err != nil {
+			// An unreadable snapshot would block the queue forever.
+			q.dropped.Add(1)
+			if removeErr := q.spool.Remove(); removeErr != nil {
+				return removeErr
+			}
+			return err
+		}
+
+		err = q.retry.Do(ctx, q.timeout, func(ctx context.Context) error { return q.send(ctx, snapshot) })
+		if err != nil && !IsPermanent(err) {
+			return err
+		}
+
+		if removeErr := q.spool.Remove(); removeErr != nil {
+			return removeErr
+		}
+		if err != nil {
+			// The target rejected the snapshot, pushing it again would fail the same way.
+			q.dropped.Add(1)
+			return err
+		}
+	}
+}
+
+// Dropped returns the number of snapshots that have been dropped without being pushed.
+func (q *PushQueue[T]) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Pending returns the number of snapshots waiting in the spool.
+func (q *PushQueue[T]) Pending() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.spool.Len()
+}
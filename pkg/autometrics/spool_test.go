@@ -0,0 +1,121 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// fakeTarget records the snapshots it receives, and fails while it is down.
+type fakeTarget struct {
+	down     bool
+	attempts int
+	received []string
+}
+
+func (f *fakeTarget) send(_ context.Context, snapshot []byte) error {
+	f.attempts++
+	if f.down {
+		return errUnavailable
+	}
+	f.received = append(f.received, string(snapshot))
+	return nil
+}
+
+func fastRetries(attempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2}
+}
+
+func TestPushQueueSpoolsWhileTargetIsDown(t *testing.T) {
+	for name, newSpool := range map[string]func(t *testing.T) Spool[[]byte]{
+		"memory": func(t *testing.T) Spool[[]byte] { return NewMemorySpool[[]byte](2) },
+		"disk": func(t *testing.T) Spool[[]byte] {
+			spool, err := NewDiskSpool(t.TempDir(), 2)
+			if err != nil {
+				t.Fatalf("creating the spool: %s", err)
+			}
+			return spool
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			target := &fakeTarget{down: true}
+			queue := NewPushQueue(newSpool(t), fastRetries(3), time.Second, target.send)
+
+			assert.ErrorIs(t, queue.Push(context.Background(), []byte("1")), errUnavailable)
+			assert.Equal(t, 3, target.attempts, "The push must be retried.")
+			assert.ErrorIs(t, queue.Push(context.Background(), []byte("2")), errUnavailable)
+			assert.ErrorIs(t, queue.Push(context.Background(), []byte("3")), errUnavailable)
+			assert.Equal(t, 2, queue.Pending())
+			assert.Equal(t, uint64(1), queue.Dropped(), "The oldest snapshot must be dropped when the spool is full.")
+
+			target.down = false
+			assert.NoError(t, queue.Flush(context.Background()))
+			assert.NoError(t, queue.Push(context.Background(), []byte("4")))
+			assert.Equal(t, []string{"2", "3", "4"}, target.received)
+			assert.Equal(t, 0, queue.Pending())
+		})
+	}
+}
+
+func TestPushQueueDropsRejectedSnapshots(t *testing.T) {
+	attempts := 0
+	queue := NewPushQueue(NewMemorySpool[int](10), fastRetries(3), time.Second, func(_ context.Context, snapshot int) error {
+		attempts++
+		return Permanent(errors.New("rejected"))
+	})
+
+	err := queue.Push(context.Background(), 1)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, attempts, "Permanent errors must not be retried.")
+	assert.Equal(t, 0, queue.Pending())
+	assert.Equal(t, uint64(1), queue.Dropped())
+}
+
+func TestLatestSpoolReplacesWithoutDropping(t *testing.T) {
+	target := &fakeTarget{down: true}
+	queue := NewPushQueue(NewLatestSpool[[]byte](), NoRetry(), time.Second, target.send)
+
+	assert.ErrorIs(t, queue.Push(context.Background(), []byte("1")), errUnavailable)
+	assert.ErrorIs(t, queue.Push(context.Background(), []byte("2")), errUnavailable)
+	assert.Equal(t, 1, queue.Pending())
+	assert.Equal(t, uint64(0), queue.Dropped(), "Replaced snapshots must not be counted as dropped.")
+
+	target.down = false
+	assert.NoError(t, queue.Push(context.Background(), []byte("3")))
+	assert.Equal(t, []string{"3"}, target.received)
+}
+
+func TestDiskSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewDiskSpool(dir, 10)
+	if err != nil {
+		t.Fatalf("creating the spool: %s", err)
+	}
+	for _, snapshot := range []string{"1", "2"} {
+		if _, err := spool.Add([]byte(snapshot)); err != nil {
+			t.Fatalf("adding a snapshot: %s", err)
+		}
+	}
+
+	restarted, err := NewDiskSpool(dir, 10)
+	if err != nil {
+		t.Fatalf("creating the spool again: %s", err)
+	}
+	target := &fakeTarget{}
+	assert.NoError(t, NewPushQueue(restarted, NoRetry(), time.Second, target.send).Flush(context.Background()))
+	assert.Equal(t, []string{"1", "2"}, target.received)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 300*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 900*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, time.Second, policy.Backoff(4))
+}
@@ -0,0 +1,114 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDExtractor reads the identifiers of the current trace and span from a context.
+//
+// Autometrics uses the extracted identifiers as the exemplars of the metrics, so that
+// exemplars resolve to the traces recorded by the tracer used in the application.
+type TraceIDExtractor interface {
+	// ExtractTraceID returns the trace ID and span ID of the span in the context, and
+	// false if the context does not contain any valid span.
+	ExtractTraceID(ctx context.Context) (TraceID, SpanID, bool)
+}
+
+// TraceIDExtractorFunc is an adapter to use ordinary functions as [TraceIDExtractor].
+type TraceIDExtractorFunc func(ctx context.Context) (TraceID, SpanID, bool)
+
+// ExtractTraceID calls fn(ctx).
+func (fn TraceIDExtractorFunc) ExtractTraceID(ctx context.Context) (TraceID, SpanID, bool) {
+	return fn(ctx)
+}
+
+// OpenTelemetryTraceIDExtractor is a [TraceIDExtractor] reading the
+// OpenTelemetry span context stored in the context.
+//
+// It is the default extractor.
+type OpenTelemetryTraceIDExtractor struct{}
+
+// ExtractTraceID returns the identifiers of [trace.SpanContextFromContext].
+func (OpenTelemetryTraceIDExtractor) ExtractTraceID(ctx context.Context) (TraceID, SpanID, bool) {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsValid() {
+		return TraceID{}, SpanID{}, false
+	}
+
+	return TraceID(spanCtx.TraceID()), SpanID(spanCtx.SpanID()), true
+}
+
+// startSpan starts a span for the current function call with the tracer of the
+// configuration of ctx, and returns a context containing the span.
+//
+// When ctx does not contain any span, the span continues the trace of the IDs set
+// in the context (for example with [WithTraceID] and [WithSpanID]), as a child of
+// a sampled remote span.
+//
+// The context is returned unchanged when span creation is disabled.
+func startSpan(ctx context.Context, callInfo CallInfo) context.Context {
+	tracer := GetConfig(ctx).snapshot().Tracer
+	if tracer == nil {
+		return ctx
+	}
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		tid, hasTraceID := GetTraceID(ctx)
+		sid, hasSpanID := GetSpanID(ctx)
+		remote := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID(tid),
+			SpanID:     trace.SpanID(sid),
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		})
+		if hasTraceID && hasSpanID && remote.IsValid() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, remote)
+		}
+	}
+
+	ctx, span := tracer.Start(ctx, spanName(callInfo))
+
+	return context.WithValue(ctx, currentStartedSpanKey, span)
+}
+
+// EndSpan ends the span started for the function call in [FillTracingAndCallerInfo], if any.
+//
+// The span is renamed after the current function of the [CallInfo] of the context (to
+// account for changes made after the span started), and has an error status when the
+// result is [ResultError]. The other results (like the ones of a [ResultClassifier]) are
+// expected outcomes of the function call, and leave the status unset.
+func EndSpan(ctx context.Context, result Result, err error) {
+	if ctx == nil {
+		return
+	}
+
+	span, ok := ctx.Value(currentStartedSpanKey).(trace.Span)
+	if !ok {
+		return
+	}
+
+	span.SetName(spanName(GetCallInfo(ctx)))
+
+	if result == ResultError {
+		description := string(result)
+		if err != nil {
+			span.RecordError(err)
+			description = err.Error()
+		}
+		span.SetStatus(codes.Error, description)
+	}
+
+	span.End()
+}
+
+func spanName(callInfo CallInfo) string {
+	if callInfo.Current.Module == "" {
+		return callInfo.Current.Function
+	}
+
+	return fmt.Sprintf("%s.%s", callInfo.Current.Module, callInfo.Current.Function)
+}
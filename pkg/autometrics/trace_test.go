@@ -0,0 +1,192 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingConfig returns a configuration starting spans with a tracer that keeps them in
+// the returned recorder.
+func tracingConfig() (*Config, *tracetest.SpanRecorder) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+
+	return &Config{Tracer: provider.Tracer("autometrics-test"), TraceIDExtractor: OpenTelemetryTraceIDExtractor{}}, spans
+}
+
+// TestSpanContinuesContextIDs makes sure that the span of a call continues the trace of the
+// IDs given with WithTraceID and WithSpanID when the context has no span.
+func TestSpanContinuesContextIDs(t *testing.T) {
+	config, spans := tracingConfig()
+	tid := TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	sid := SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+
+	ctx := StartCall(NewContextWithOpts(context.Background(), WithTraceID(tid[:]), WithSpanID(sid[:])), config, nil)
+	EndCall(ctx, nil, nil, nil)
+
+	ended := spans.Ended()
+	if !assert.Len(t, ended, 1) {
+		return
+	}
+	assert.Equal(t, trace.TraceID(tid), ended[0].SpanContext().TraceID(), "the span should be in the trace of the context")
+	assert.Equal(t, trace.SpanID(sid), ended[0].Parent().SpanID(), "the span should be a child of the span of the context")
+	assert.True(t, ended[0].Parent().IsRemote())
+
+	callTid, _ := GetTraceID(ctx)
+	callSid, _ := GetSpanID(ctx)
+	assert.Equal(t, tid, callTid)
+	assert.Equal(t, SpanID(ended[0].SpanContext().SpanID()), callSid, "the IDs of the call should be the ones of its span")
+}
+
+// TestSpanOfNestedCalls makes sure that the span of a call is the child of the span of its
+// instrumented caller.
+func TestSpanOfNestedCalls(t *testing.T) {
+	config, spans := tracingConfig()
+
+	outer := StartCall(NewContextWithOpts(context.Background(), WithFunctionName("outer")), config, nil)
+	inner := StartCall(NewContextWithOpts(outer, WithFunctionName("inner")), config, nil)
+	EndCall(inner, nil, nil, nil)
+	EndCall(outer, nil, nil, nil)
+
+	ended := spans.Ended()
+	if !assert.Len(t, ended, 2) {
+		return
+	}
+	assert.Equal(t, ended[1].SpanContext().TraceID(), ended[0].SpanContext().TraceID())
+	assert.Equal(t, ended[1].SpanContext().SpanID(), ended[0].Parent().SpanID())
+	assert.False(t, ended[1].Parent().IsValid(), "the outer span should be a root span")
+}
+
+// TestSpanStatus makes sure that only the error result sets an error status on the span.
+func TestSpanStatus(t *testing.T) {
+	errNotFound := errors.New("not found")
+
+	for name, test := range map[string]struct {
+		err         error
+		panicValue  any
+		code        codes.Code
+		description string
+	}{
+		"success": {
+			code: codes.Unset,
+		},
+		"error": {
+			err:         errors.New("failure"),
+			code:        codes.Error,
+			description: "failure",
+		},
+		"classified error": {
+			err:  errNotFound,
+			code: codes.Unset,
+		},
+		"panic": {
+			panicValue:  "crash",
+			code:        codes.Error,
+			description: "panic: crash",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config, spans := tracingConfig()
+			config.ResultClassifier = func(_ context.Context, err error) Result {
+				if errors.Is(err, errNotFound) {
+					return "not_found"
+				}
+				return ResultError
+			}
+			config.ExtraResults = []Result{"not_found"}
+
+			ctx := StartCall(NewContext(context.Background()), config, nil)
+			err := test.err
+			EndCall(ctx, &err, test.panicValue, nil)
+
+			ended := spans.Ended()
+			if !assert.Len(t, ended, 1) {
+				return
+			}
+			assert.Equal(t, sdktrace.Status{Code: test.code, Description: test.description}, ended[0].Status())
+		})
+	}
+}
+
+func TestOpenTelemetryTraceIDExtractor(t *testing.T) {
+	_, _, ok := OpenTelemetryTraceIDExtractor{}.ExtractTraceID(context.Background())
+	assert.False(t, ok, "a context without span should not have IDs")
+
+	tid := TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	sid := SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID(tid),
+		SpanID:  trace.SpanID(sid),
+	}))
+
+	extractedTid, extractedSid, ok := OpenTelemetryTraceIDExtractor{}.ExtractTraceID(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, tid, extractedTid)
+	assert.Equal(t, sid, extractedSid)
+}
+
+// TestFillTracingAndCallerInfoExtractor makes sure that the IDs of a call are the ones read by
+// the extractor of the configuration, and random ones otherwise.
+func TestFillTracingAndCallerInfoExtractor(t *testing.T) {
+	spanTid := TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}
+	spanSid := SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}
+	customTid := TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	customSid := SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+
+	for name, test := range map[string]struct {
+		extractor TraceIDExtractor
+		random    bool
+		tid       TraceID
+		sid       SpanID
+	}{
+		"OpenTelemetry span": {
+			extractor: OpenTelemetryTraceIDExtractor{},
+			tid:       spanTid,
+			sid:       spanSid,
+		},
+		"custom extractor": {
+			extractor: TraceIDExtractorFunc(func(context.Context) (TraceID, SpanID, bool) { return customTid, customSid, true }),
+			tid:       customTid,
+			sid:       customSid,
+		},
+		"no IDs in the tracer": {
+			extractor: TraceIDExtractorFunc(func(context.Context) (TraceID, SpanID, bool) { return TraceID{}, SpanID{}, false }),
+			random:    true,
+		},
+		"no extractor": {
+			random: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := SetConfig(context.Background(), &Config{TraceIDExtractor: test.extractor})
+			ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: trace.TraceID(spanTid),
+				SpanID:  trace.SpanID(spanSid),
+			}))
+
+			ctx = FillTracingAndCallerInfo(ctx)
+			defer func() { _ = PopFunctionName(ctx) }()
+
+			tid, ok := GetTraceID(ctx)
+			assert.True(t, ok)
+			sid, ok := GetSpanID(ctx)
+			assert.True(t, ok)
+			if test.random {
+				assert.NotEqual(t, spanTid, tid)
+				assert.NotEqual(t, spanSid, sid)
+				assert.NotEqual(t, TraceID{}, tid)
+				assert.NotEqual(t, SpanID{}, sid)
+			} else {
+				assert.Equal(t, test.tid, tid)
+				assert.Equal(t, test.sid, sid)
+			}
+		})
+	}
+}
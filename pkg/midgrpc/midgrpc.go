@@ -0,0 +1,154 @@
+// Package midgrpc contains common types used in the downstream implementations of the interceptors for gRPC servers and clients.
+package midgrpc // import "github.com/autometrics-dev/autometrics-go/pkg/midgrpc"
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+)
+
+// Module is the module reported for the RPCs recorded by the interceptors.
+const Module = "google.golang.org/grpc"
+
+const (
+	// TraceparentMetadata is the metadata key of the W3C traceparent header.
+	TraceparentMetadata = mid.TraceparentHeader
+	// TracestateMetadata is the metadata key of the W3C tracestate header.
+	TracestateMetadata = mid.TracestateHeader
+	// RequestIdMetadata is the metadata key of the request ID header.
+	RequestIdMetadata = "x-request-id"
+)
+
+type contextKey int
+
+const (
+	validCodesKey contextKey = iota
+	traceFlagsKey
+	tracestateKey
+	requestIdKey
+)
+
+type optionFunc func(context.Context) context.Context
+
+func (fn optionFunc) Apply(ctx context.Context) context.Context {
+	return fn(ctx)
+}
+
+// WithValidCodes sets the gRPC status codes that Autometrics should consider as "ok" results on calls.
+//
+// This is the gRPC equivalent of [am.WithValidHttpCodes], and the default is to only consider
+// [codes.OK] as a success.
+func WithValidCodes(validCodes ...codes.Code) am.Option {
+	return optionFunc(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, validCodesKey, validCodes)
+	})
+}
+
+// GetValidCodes returns the gRPC status codes that should be considered as "ok" by Autometrics.
+func GetValidCodes(ctx context.Context) []codes.Code {
+	if ctx != nil {
+		if validCodes, ok := ctx.Value(validCodesKey).([]codes.Code); ok {
+			return validCodes
+		}
+	}
+
+	return []codes.Code{codes.OK}
+}
+
+// CodeError returns nil if the status code of err ([codes.OK] when err is nil) is in the
+// valid codes of the context (see [WithValidCodes]), and an error otherwise.
+func CodeError(ctx context.Context, err error) error {
+	code := status.Code(err)
+	for _, validCode := range GetValidCodes(ctx) {
+		if code == validCode {
+			return nil
+		}
+	}
+
+	if err == nil {
+		// A status error with codes.OK is nil.
+		return errors.New(code.String())
+	}
+
+	return err
+}
+
+// NewServerContext returns the autometrics context of an incoming RPC.
+//
+// The context identifies the call with the full method name of the RPC, and continues the
+// trace found in the incoming metadata.
+func NewServerContext(ctx context.Context, fullMethod string, opts ...am.Option) context.Context {
+	var traceOpts []am.Option
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if requestId := first(md.Get(RequestIdMetadata)); requestId != "" {
+			ctx = context.WithValue(ctx, requestIdKey, requestId)
+		}
+
+		if tid, sid, flags, ok := mid.ParseTraceparent(first(md.Get(TraceparentMetadata))); ok {
+			ctx = context.WithValue(ctx, traceFlagsKey, flags)
+			if tracestate := strings.Join(md.Get(TracestateMetadata), ","); tracestate != "" {
+				ctx = context.WithValue(ctx, tracestateKey, tracestate)
+			}
+			traceOpts = append(traceOpts, am.WithTraceID(tid[:]), am.WithSpanID(sid[:]))
+		}
+	}
+
+	ctx = am.SetFunctionID(ctx, am.FunctionID{Function: fullMethod, Module: Module})
+
+	// Options given explicitly have precedence over the ones read from the metadata
+	return am.NewContextWithOpts(ctx, append(traceOpts, opts...)...)
+}
+
+// NewClientContext returns the autometrics context of an outgoing RPC.
+//
+// The context identifies the call with the full method name of the RPC. The caller is the
+// instrumented function found in ctx.
+func NewClientContext(ctx context.Context, fullMethod string, opts ...am.Option) context.Context {
+	ctx = am.SetFunctionID(ctx, am.FunctionID{Function: fullMethod, Module: Module})
+	return am.NewContextWithOpts(ctx, opts...)
+}
+
+// InjectTraceMetadata returns a copy of ctx where the outgoing metadata contains the
+// trace of the autometrics context, so that the exemplars of the called service are
+// connected to the current trace.
+func InjectTraceMetadata(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var pairs []string
+
+	tid, hasTraceID := am.GetTraceID(ctx)
+	sid, hasSpanID := am.GetSpanID(ctx)
+	if hasTraceID && hasSpanID && len(md.Get(TraceparentMetadata)) == 0 {
+		flags, _ := ctx.Value(traceFlagsKey).(byte)
+		pairs = append(pairs, TraceparentMetadata, mid.FormatTraceparent(tid, sid, flags&0x01))
+
+		if tracestate, ok := ctx.Value(tracestateKey).(string); ok && len(md.Get(TracestateMetadata)) == 0 {
+			pairs = append(pairs, TracestateMetadata, tracestate)
+		}
+	}
+
+	if requestId, ok := ctx.Value(requestIdKey).(string); ok && len(md.Get(RequestIdMetadata)) == 0 {
+		pairs = append(pairs, RequestIdMetadata, requestId)
+	}
+
+	if len(pairs) == 0 {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,40 @@
+package midgrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+)
+
+func TestCodeError(t *testing.T) {
+	notFound := status.Error(codes.NotFound, "not found")
+	onlyNotFound := am.NewContextWithOpts(context.Background(), WithValidCodes(codes.NotFound))
+
+	assert.NoError(t, CodeError(context.Background(), nil))
+	assert.Equal(t, notFound, CodeError(context.Background(), notFound))
+	assert.NoError(t, CodeError(onlyNotFound, notFound))
+	assert.Error(t, CodeError(onlyNotFound, nil), "a success should be an error when OK is not a valid code")
+}
+
+// TestServerContextCaller makes sure that an incoming RPC is recorded without caller, instead of
+// the gRPC internals calling the interceptor.
+func TestServerContextCaller(t *testing.T) {
+	recorder := autometricstest.NewRecorder()
+	config := &am.Config{Recorders: []am.Recorder{recorder}}
+
+	ctx := am.StartCall(NewServerContext(context.Background(), "/users.Users/GetUser"), config, nil)
+	am.EndCall(ctx, nil, nil, nil)
+
+	calls := recorder.Calls(autometricstest.Module(Module))
+	if !assert.Len(t, calls, 1) {
+		return
+	}
+	assert.Equal(t, "/users.Users/GetUser", calls[0].CallInfo.Current.Function)
+	assert.Equal(t, am.FunctionID{}, calls[0].CallInfo.Parent, "the caller of an incoming RPC should be empty")
+}
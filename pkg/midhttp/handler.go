@@ -0,0 +1,63 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// Instrumenter holds the functions of a backend that record a function call.
+type Instrumenter struct {
+	// PreInstrument starts a function call, and returns nil if autometrics is not active.
+	PreInstrument func(ctx context.Context) context.Context
+	// Instrument ends a function call started with PreInstrument.
+	Instrument func(ctx context.Context, err *error)
+}
+
+// Middleware wraps a handler to record each request as a function call with inst.
+//
+// The W3C Trace Context headers ([TraceparentHeader] and [TracestateHeader]) of
+// the incoming request are used to continue the trace of the caller, and can be
+// propagated to outgoing requests with [InjectTraceHeaders]. The [RequestIdHeader] header
+// is only read with the [WithRequestIdHeader] option.
+//
+// The requests are identified by the name of the handler function, or by their method
+// and route pattern with the [WithRoute] option.
+func Middleware(inst Instrumenter, next http.HandlerFunc, opts ...am.Option) http.HandlerFunc {
+	fn := func(rw http.ResponseWriter, r *http.Request) {
+		arw := NewResponseWriter(rw)
+		// Options given explicitly have precedence over the ones read from the tracing headers
+		ctx, traceOpts := TraceOptions(r, opts...)
+		ctx = am.NewContextWithOpts(ctx, append(traceOpts, opts...)...)
+
+		// Compute then set the function name and module name labels
+		ctx = am.SetFunctionID(ctx, HandlerFunctionID(ctx, r, next))
+
+		ctx = inst.PreInstrument(ctx)
+		if ctx == nil {
+			// Autometrics is not active
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		err := errors.New("Unfinished handler")
+
+		defer inst.Instrument(ctx, &err)
+
+		r = r.WithContext(ctx)
+		next.ServeHTTP(arw, r)
+
+		// Check the status code of the handler to reset the error before the Instrument deferred call
+		ranges := am.GetValidHttpCodeRanges(ctx)
+		for _, codeRange := range ranges {
+			if codeRange.Contains(arw.CurrentStatusCode()) {
+				err = nil
+				break
+			}
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,107 @@
+package midhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedCall is a function call recorded by a fakeInstrumenter.
+type recordedCall struct {
+	ctx      context.Context
+	function am.FunctionID
+	err      error
+}
+
+// fakeInstrumenter records the function calls made through its Instrumenter.
+type fakeInstrumenter struct {
+	calls []recordedCall
+}
+
+func (f *fakeInstrumenter) instrumenter() Instrumenter {
+	return Instrumenter{
+		PreInstrument: func(ctx context.Context) context.Context { return ctx },
+		Instrument: func(ctx context.Context, err *error) {
+			function, _ := am.GetFunctionID(ctx)
+			f.calls = append(f.calls, recordedCall{ctx: ctx, function: function, err: *err})
+		},
+	}
+}
+
+func (f *fakeInstrumenter) functions() []string {
+	functions := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		functions[i] = call.function.Function
+	}
+
+	return functions
+}
+
+func getUser(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestWithRoute(t *testing.T) {
+	for name, test := range map[string]struct {
+		route    RouteFunc
+		opts     []am.Option
+		function string
+	}{
+		"no route": {
+			function: "getUser",
+		},
+		"pattern": {
+			route:    func(*http.Request) string { return "/users/{id}" },
+			function: "GET /users/{id}",
+		},
+		"pattern with method": {
+			route:    func(*http.Request) string { return "GET /users/{id}" },
+			function: "GET /users/{id}",
+		},
+		"unmatched": {
+			route:    func(*http.Request) string { return "" },
+			function: "getUser",
+		},
+		"explicit name": {
+			route:    func(*http.Request) string { return "/users/{id}" },
+			opts:     []am.Option{am.WithFunctionName("user")},
+			function: "user",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			inst := &fakeInstrumenter{}
+			opts := test.opts
+			if test.route != nil {
+				opts = append(opts, WithRoute(test.route))
+			}
+
+			Middleware(inst.instrumenter(), getUser, opts...)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+			assert.Equal(t, []string{test.function}, inst.functions())
+		})
+	}
+}
+
+// TestMiddlewareCaller makes sure that a request is recorded without caller, unless the
+// context of the request comes from an instrumented function.
+func TestMiddlewareCaller(t *testing.T) {
+	recorder := autometricstest.NewRecorder()
+	inst := recordingInstrumenter(recorder)
+
+	Middleware(inst, getUser)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	callerCtx := inst.PreInstrument(am.NewContextWithOpts(context.Background(), am.WithFunctionName("proxy")))
+	Middleware(inst, getUser)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil).WithContext(callerCtx))
+
+	calls := recorder.Calls(autometricstest.Function("getUser"))
+	if !assert.Len(t, calls, 2) {
+		return
+	}
+	assert.Equal(t, am.FunctionID{}, calls[0].CallInfo.Parent, "the caller of a request should be empty")
+	assert.Equal(t, "proxy", calls[1].CallInfo.Parent.Function, "the caller of a request should be the instrumented function of its context")
+}
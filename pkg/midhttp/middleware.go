@@ -2,27 +2,218 @@
 package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
 )
 
 const RequestIdHeader = "X-Request-Id"
 
+// ResponseWriter is a [http.ResponseWriter] that keeps track of the response for
+// reporting purposes.
+type ResponseWriter interface {
+	http.ResponseWriter
+	// CurrentStatusCode returns the status code of the response, which is
+	// [http.StatusOK] until the handler sets another one.
+	CurrentStatusCode() int
+	// BytesWritten returns the number of bytes of the response body written so far.
+	BytesWritten() int64
+	// Unwrap returns the wrapped ResponseWriter, for [http.ResponseController].
+	Unwrap() http.ResponseWriter
+}
+
 type autometricsResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	wroteHeader  bool
+	bytesWritten int64
 }
 
 // NewResponseWriter creates a new ResponseWriter that keeps track of the status
 // code of the query for reporting purposes.
-func NewResponseWriter(w http.ResponseWriter) *autometricsResponseWriter {
-	return &autometricsResponseWriter{w, http.StatusOK}
+//
+// The returned ResponseWriter implements exactly the optional interfaces of w
+// among [http.Flusher], [http.Hijacker], [io.ReaderFrom] and [http.Pusher], so that
+// handlers relying on them (for server-sent events or websockets for example)
+// keep working.
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	amrw := &autometricsResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+	_, isFlusher := w.(http.Flusher)
+	_, isHijacker := w.(http.Hijacker)
+	_, isReaderFrom := w.(io.ReaderFrom)
+	_, isPusher := w.(http.Pusher)
+
+	f := flusher{amrw}
+	h := hijacker{amrw}
+	r := readerFrom{amrw}
+	p := pusher{amrw}
+
+	switch {
+	case isFlusher && isHijacker && isReaderFrom && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			hijacker
+			readerFrom
+			pusher
+		}{amrw, f, h, r, p}
+	case isFlusher && isHijacker && isReaderFrom:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			hijacker
+			readerFrom
+		}{amrw, f, h, r}
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			hijacker
+			pusher
+		}{amrw, f, h, p}
+	case isFlusher && isReaderFrom && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			readerFrom
+			pusher
+		}{amrw, f, r, p}
+	case isHijacker && isReaderFrom && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			hijacker
+			readerFrom
+			pusher
+		}{amrw, h, r, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			hijacker
+		}{amrw, f, h}
+	case isFlusher && isReaderFrom:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			readerFrom
+		}{amrw, f, r}
+	case isFlusher && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+			pusher
+		}{amrw, f, p}
+	case isHijacker && isReaderFrom:
+		return struct {
+			*autometricsResponseWriter
+			hijacker
+			readerFrom
+		}{amrw, h, r}
+	case isHijacker && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			hijacker
+			pusher
+		}{amrw, h, p}
+	case isReaderFrom && isPusher:
+		return struct {
+			*autometricsResponseWriter
+			readerFrom
+			pusher
+		}{amrw, r, p}
+	case isFlusher:
+		return struct {
+			*autometricsResponseWriter
+			flusher
+		}{amrw, f}
+	case isHijacker:
+		return struct {
+			*autometricsResponseWriter
+			hijacker
+		}{amrw, h}
+	case isReaderFrom:
+		return struct {
+			*autometricsResponseWriter
+			readerFrom
+		}{amrw, r}
+	case isPusher:
+		return struct {
+			*autometricsResponseWriter
+			pusher
+		}{amrw, p}
+	default:
+		return amrw
+	}
 }
 
 func (amrw *autometricsResponseWriter) CurrentStatusCode() int {
 	return amrw.statusCode
 }
 
+func (amrw *autometricsResponseWriter) BytesWritten() int64 {
+	return amrw.bytesWritten
+}
+
+func (amrw *autometricsResponseWriter) Unwrap() http.ResponseWriter {
+	return amrw.ResponseWriter
+}
+
 func (amrw *autometricsResponseWriter) WriteHeader(code int) {
-	amrw.statusCode = code
+	// Informational responses can be sent before the final status code
+	if !amrw.wroteHeader && code >= http.StatusOK {
+		amrw.statusCode = code
+		amrw.wroteHeader = true
+	}
 	amrw.ResponseWriter.WriteHeader(code)
 }
+
+func (amrw *autometricsResponseWriter) Write(b []byte) (int, error) {
+	amrw.wroteHeader = true
+	n, err := amrw.ResponseWriter.Write(b)
+	amrw.bytesWritten += int64(n)
+	return n, err
+}
+
+type flusher struct {
+	amrw *autometricsResponseWriter
+}
+
+func (f flusher) Flush() {
+	f.amrw.wroteHeader = true
+	f.amrw.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct {
+	amrw *autometricsResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.amrw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && !h.amrw.wroteHeader {
+		// The handler takes over the connection, usually to switch protocols (like websockets)
+		h.amrw.statusCode = http.StatusSwitchingProtocols
+		h.amrw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+type readerFrom struct {
+	amrw *autometricsResponseWriter
+}
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	r.amrw.wroteHeader = true
+	n, err := r.amrw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	r.amrw.bytesWritten += n
+	return n, err
+}
+
+type pusher struct {
+	amrw *autometricsResponseWriter
+}
+
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.amrw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
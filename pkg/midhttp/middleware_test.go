@@ -0,0 +1,233 @@
+package midhttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// baseWriter is a ResponseWriter without any of the optional interfaces, that the fake
+// optional interfaces below complete.
+type baseWriter struct {
+	header   http.Header
+	codes    []int
+	body     bytes.Buffer
+	flushed  bool
+	deadline time.Time
+}
+
+func newBaseWriter() *baseWriter {
+	return &baseWriter{header: make(http.Header)}
+}
+
+func (w *baseWriter) Header() http.Header         { return w.header }
+func (w *baseWriter) WriteHeader(code int)        { w.codes = append(w.codes, code) }
+func (w *baseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+// SetWriteDeadline is only reachable through [http.ResponseController].
+func (w *baseWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+type fakeFlusher struct{ w *baseWriter }
+
+func (f fakeFlusher) Flush() { f.w.flushed = true }
+
+type fakeHijacker struct{ w *baseWriter }
+
+func (fakeHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	server, client := net.Pipe()
+	_ = client.Close()
+	return server, nil, nil
+}
+
+type fakeReaderFrom struct{ w *baseWriter }
+
+func (r fakeReaderFrom) ReadFrom(src io.Reader) (int64, error) { return r.w.body.ReadFrom(src) }
+
+type fakePusher struct{ w *baseWriter }
+
+func (fakePusher) Push(string, *http.PushOptions) error { return nil }
+
+// allInterfaces is the ResponseWriter of an HTTP/1 server with server push, which
+// implements all the optional interfaces.
+type allInterfaces struct {
+	*baseWriter
+	fakeFlusher
+	fakeHijacker
+	fakeReaderFrom
+	fakePusher
+}
+
+func newAllInterfaces() allInterfaces {
+	w := newBaseWriter()
+	return allInterfaces{w, fakeFlusher{w}, fakeHijacker{w}, fakeReaderFrom{w}, fakePusher{w}}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	w := newBaseWriter()
+
+	for name, inner := range map[string]http.ResponseWriter{
+		"none": w,
+		"flusher": struct {
+			*baseWriter
+			fakeFlusher
+		}{w, fakeFlusher{w}},
+		"hijacker": struct {
+			*baseWriter
+			fakeHijacker
+		}{w, fakeHijacker{w}},
+		"reader": struct {
+			*baseWriter
+			fakeReaderFrom
+		}{w, fakeReaderFrom{w}},
+		"pusher": struct {
+			*baseWriter
+			fakePusher
+		}{w, fakePusher{w}},
+		"http/1": struct {
+			*baseWriter
+			fakeFlusher
+			fakeHijacker
+			fakeReaderFrom
+		}{w, fakeFlusher{w}, fakeHijacker{w}, fakeReaderFrom{w}},
+		"http/2": struct {
+			*baseWriter
+			fakeFlusher
+			fakePusher
+		}{w, fakeFlusher{w}, fakePusher{w}},
+		"hijacker and pusher": struct {
+			*baseWriter
+			fakeHijacker
+			fakePusher
+		}{w, fakeHijacker{w}, fakePusher{w}},
+		"all": newAllInterfaces(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			amrw := NewResponseWriter(inner)
+
+			_, wantFlusher := inner.(http.Flusher)
+			_, wantHijacker := inner.(http.Hijacker)
+			_, wantReaderFrom := inner.(io.ReaderFrom)
+			_, wantPusher := inner.(http.Pusher)
+
+			_, isFlusher := amrw.(http.Flusher)
+			_, isHijacker := amrw.(http.Hijacker)
+			_, isReaderFrom := amrw.(io.ReaderFrom)
+			_, isPusher := amrw.(http.Pusher)
+
+			assert.Equal(t, wantFlusher, isFlusher, "http.Flusher")
+			assert.Equal(t, wantHijacker, isHijacker, "http.Hijacker")
+			assert.Equal(t, wantReaderFrom, isReaderFrom, "io.ReaderFrom")
+			assert.Equal(t, wantPusher, isPusher, "http.Pusher")
+			assert.Equal(t, inner, amrw.Unwrap())
+		})
+	}
+}
+
+func TestResponseWriterStatusCode(t *testing.T) {
+	for name, test := range map[string]struct {
+		handle     func(w http.ResponseWriter)
+		statusCode int
+		bytes      int64
+	}{
+		"implicit ok": {
+			handle:     func(w http.ResponseWriter) { _, _ = w.Write([]byte("hello")) },
+			statusCode: http.StatusOK,
+			bytes:      5,
+		},
+		"explicit status": {
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("not found"))
+			},
+			statusCode: http.StatusNotFound,
+			bytes:      9,
+		},
+		"informational response": {
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+			},
+			statusCode: http.StatusCreated,
+		},
+		"superfluous status": {
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusAccepted)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			statusCode: http.StatusAccepted,
+		},
+		"status after body": {
+			handle: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte("hello"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			statusCode: http.StatusOK,
+			bytes:      5,
+		},
+		"reader from": {
+			handle: func(w http.ResponseWriter) {
+				_, _ = w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello world"))
+			},
+			statusCode: http.StatusOK,
+			bytes:      11,
+		},
+		"flush": {
+			handle: func(w http.ResponseWriter) {
+				w.(http.Flusher).Flush()
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			statusCode: http.StatusOK,
+		},
+		"hijack": {
+			handle: func(w http.ResponseWriter) {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			},
+			statusCode: http.StatusSwitchingProtocols,
+		},
+		"hijack after status": {
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+			},
+			statusCode: http.StatusBadRequest,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			amrw := NewResponseWriter(newAllInterfaces())
+
+			test.handle(amrw)
+
+			assert.Equal(t, test.statusCode, amrw.CurrentStatusCode())
+			assert.Equal(t, test.bytes, amrw.BytesWritten())
+		})
+	}
+}
+
+// TestResponseWriterController makes sure that the features of the wrapped ResponseWriter
+// stay reachable through http.ResponseController.
+func TestResponseWriterController(t *testing.T) {
+	inner := newAllInterfaces()
+	controller := http.NewResponseController(NewResponseWriter(inner))
+
+	deadline := time.Now().Add(time.Minute)
+	assert.NoError(t, controller.SetWriteDeadline(deadline))
+	assert.Equal(t, deadline, inner.deadline, "the deadline should be set on the wrapped ResponseWriter")
+
+	assert.NoError(t, controller.Flush())
+	assert.True(t, inner.flushed)
+
+	plain := newBaseWriter()
+	assert.ErrorIs(t, http.NewResponseController(NewResponseWriter(plain)).Flush(), http.ErrNotSupported)
+}
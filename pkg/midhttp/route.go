@@ -0,0 +1,72 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// RouteFunc returns the route pattern that matched a request, like "/users/{id}", or an
+// empty string if the request did not match any pattern.
+//
+// The router must have matched the request before the middleware runs, which is the case
+// when the middleware wraps the handler given to the router. For example, the RouteFunc
+// of the chi router is:
+//
+//	func(r *http.Request) string { return chi.RouteContext(r.Context()).RoutePattern() }
+type RouteFunc func(r *http.Request) string
+
+type routeOption struct {
+	route RouteFunc
+}
+
+func (o routeOption) Apply(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routeFuncKey, o.route)
+}
+
+// WithRoute makes the middleware identify the requests by their HTTP method and the route
+// pattern returned by route, instead of the name of the handler function. This allows to
+// have metrics and objectives per endpoint even when a single handler serves many routes.
+//
+// Requests that do not match any route pattern are still identified by the handler function.
+func WithRoute(route RouteFunc) am.Option {
+	return routeOption{route: route}
+}
+
+// HandlerFunctionID returns the function identity of a request served by the handler next.
+//
+// The function is the name of next, unless a [RouteFunc] was set in ctx with [WithRoute]
+// and returns a route pattern for the request. A function name set with [am.WithFunctionName]
+// has precedence over both.
+func HandlerFunctionID(ctx context.Context, r *http.Request, next http.HandlerFunc) am.FunctionID {
+	fid := am.ReflectFunctionModuleName(next).Current
+
+	if route, ok := ctx.Value(routeFuncKey).(RouteFunc); ok && route != nil {
+		if pattern := route(r); pattern != "" {
+			fid.Function = routeFunction(r.Method, pattern)
+		}
+	}
+
+	if override, ok := am.GetFunctionID(ctx); ok {
+		if override.Function != "" {
+			fid.Function = override.Function
+		}
+		if override.Module != "" {
+			fid.Module = override.Module
+		}
+	}
+
+	return fid
+}
+
+// routeFunction returns the function name of a route, prefixed with the method when the
+// pattern does not already contain it (like Go 1.22 patterns such as "GET /users/{id}").
+func routeFunction(method, pattern string) string {
+	if index := strings.IndexByte(pattern, ' '); index != -1 && !strings.Contains(pattern[:index], "/") {
+		return pattern
+	}
+
+	return method + " " + pattern
+}
@@ -0,0 +1,22 @@
+//go:build !go1.23
+
+package midhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeMuxRoute(t *testing.T) {
+	inst := &fakeInstrumenter{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", Middleware(inst.instrumenter(), getUser, WithRoute(ServeMuxRoute)))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	// The router does not record the pattern, so the request is identified by its handler.
+	assert.Equal(t, []string{"getUser"}, inst.functions())
+}
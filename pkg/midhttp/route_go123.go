@@ -0,0 +1,11 @@
+//go:build go1.23
+
+package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
+
+import "net/http"
+
+// ServeMuxRoute is the [RouteFunc] of the [http.ServeMux] router, that returns the pattern
+// of the request (as set by the router since Go 1.23).
+func ServeMuxRoute(r *http.Request) string {
+	return r.Pattern
+}
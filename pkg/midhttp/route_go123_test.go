@@ -0,0 +1,28 @@
+//go:build go1.23
+
+// The router only matches patterns with methods and wildcards in modules declaring Go 1.22 or later.
+//go:debug httpmuxgo121=0
+
+package midhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeMuxRoute(t *testing.T) {
+	inst := &fakeInstrumenter{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/{id}", Middleware(inst.instrumenter(), getUser, WithRoute(ServeMuxRoute)))
+	mux.HandleFunc("POST /users", Middleware(inst.instrumenter(), getUser, WithRoute(ServeMuxRoute)))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil))
+	// Outside of the router, the request has no pattern.
+	Middleware(inst.instrumenter(), getUser, WithRoute(ServeMuxRoute))(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	assert.Equal(t, []string{"GET /users/{id}", "POST /users", "getUser"}, inst.functions())
+}
@@ -0,0 +1,199 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+const (
+	// TraceparentHeader is the W3C Trace Context header carrying the trace ID and parent span ID.
+	//
+	// Reference: https://www.w3.org/TR/trace-context/#traceparent-header
+	TraceparentHeader = "traceparent"
+	// TracestateHeader is the W3C Trace Context header carrying vendor-specific trace information.
+	//
+	// Reference: https://www.w3.org/TR/trace-context/#tracestate-header
+	TracestateHeader = "tracestate"
+
+	traceparentVersion = "00"
+	// sampledFlag is the trace flag recording that the caller may have recorded the trace.
+	sampledFlag byte = 0x01
+)
+
+type contextKey int
+
+const (
+	traceFlagsKey contextKey = iota
+	tracestateKey
+	requestIdKey
+	routeTemplateKey
+	routeFuncKey
+)
+
+// ParseTraceparent parses the value of a [TraceparentHeader] header.
+//
+// It returns the trace ID, the parent span ID and the trace flags of the header, and false
+// if the value is not a valid traceparent.
+func ParseTraceparent(value string) (am.TraceID, am.SpanID, byte, bool) {
+	var (
+		tid   am.TraceID
+		sid   am.SpanID
+		flags [1]byte
+	)
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return tid, sid, 0, false
+	}
+
+	version := parts[0]
+	if len(version) != 2 || version == "ff" || !isLowerHex(version) {
+		return tid, sid, 0, false
+	}
+	// Future versions may append fields, but the version we know has exactly 4 of them.
+	if version == traceparentVersion && len(parts) != 4 {
+		return tid, sid, 0, false
+	}
+
+	if !decodeHex(tid[:], parts[1]) || tid == (am.TraceID{}) {
+		return tid, sid, 0, false
+	}
+	if !decodeHex(sid[:], parts[2]) || sid == (am.SpanID{}) {
+		return tid, sid, 0, false
+	}
+	if !decodeHex(flags[:], parts[3]) {
+		return tid, sid, 0, false
+	}
+
+	return tid, sid, flags[0], true
+}
+
+// FormatTraceparent returns the value of a [TraceparentHeader] header for the given trace.
+func FormatTraceparent(tid am.TraceID, sid am.SpanID, flags byte) string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, hex.EncodeToString(tid[:]), hex.EncodeToString(sid[:]), flags)
+}
+
+type requestIdOption struct{}
+
+// Apply does nothing, the option is only read by [TraceOptions].
+func (requestIdOption) Apply(ctx context.Context) context.Context {
+	return ctx
+}
+
+// WithRequestIdHeader makes the middleware read the [RequestIdHeader] header of the incoming
+// requests, to propagate it in outgoing requests (see [InjectTraceHeaders]) and to use it as
+// trace ID when the request does not have a valid traceparent.
+//
+// The header is ignored by default, as clients and proxies can set it to values that have
+// nothing to do with a trace.
+func WithRequestIdHeader() am.Option {
+	return requestIdOption{}
+}
+
+// TraceOptions reads the tracing headers of an incoming request.
+//
+// It returns the request context enriched with the headers to propagate in outgoing requests
+// (see [InjectTraceHeaders]), and the options to give to the autometrics context so that the
+// instrumented handler continues the trace of the caller.
+//
+// The trace is read from the [TraceparentHeader] header. When the request does not have a
+// valid traceparent and middlewareOpts contain [WithRequestIdHeader], a [RequestIdHeader]
+// header that contains a UUID (or any 32 hexadecimal digits) is used as trace ID instead.
+func TraceOptions(r *http.Request, middlewareOpts ...am.Option) (context.Context, []am.Option) {
+	ctx := r.Context()
+	var opts []am.Option
+
+	readRequestId := false
+	for _, o := range middlewareOpts {
+		if _, ok := o.(requestIdOption); ok {
+			readRequestId = true
+		}
+	}
+
+	requestId := ""
+	if readRequestId {
+		requestId = r.Header.Get(RequestIdHeader)
+	}
+	if requestId != "" {
+		ctx = context.WithValue(ctx, requestIdKey, requestId)
+	}
+
+	if tid, sid, flags, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		ctx = context.WithValue(ctx, traceFlagsKey, flags)
+		// tracestate is meaningless without the matching traceparent
+		if tracestate := strings.Join(r.Header.Values(TracestateHeader), ","); tracestate != "" {
+			ctx = context.WithValue(ctx, tracestateKey, tracestate)
+		}
+		opts = append(opts, am.WithTraceID(tid[:]), am.WithSpanID(sid[:]))
+	} else if tid, ok := requestIdTraceID(requestId); ok {
+		opts = append(opts, am.WithTraceID(tid[:]))
+	}
+
+	return ctx, opts
+}
+
+// InjectTraceHeaders sets the tracing headers of an outgoing request made from ctx, so
+// that the exemplars of the called service are connected to the current trace.
+//
+// The [TraceparentHeader] header is built from the trace and span IDs of the autometrics
+// context, and the [TracestateHeader] and [RequestIdHeader] (see [WithRequestIdHeader]) headers
+// of the incoming request are propagated as is. Headers that are already set are not overwritten.
+func InjectTraceHeaders(ctx context.Context, header http.Header) {
+	if ctx == nil {
+		return
+	}
+
+	if header.Get(TraceparentHeader) == "" {
+		tid, hasTraceID := am.GetTraceID(ctx)
+		sid, hasSpanID := am.GetSpanID(ctx)
+		if hasTraceID && hasSpanID {
+			flags, _ := ctx.Value(traceFlagsKey).(byte)
+			header.Set(TraceparentHeader, FormatTraceparent(tid, sid, flags&sampledFlag))
+
+			if tracestate, ok := ctx.Value(tracestateKey).(string); ok && header.Get(TracestateHeader) == "" {
+				header.Set(TracestateHeader, tracestate)
+			}
+		}
+	}
+
+	if requestId, ok := ctx.Value(requestIdKey).(string); ok && header.Get(RequestIdHeader) == "" {
+		header.Set(RequestIdHeader, requestId)
+	}
+}
+
+// requestIdTraceID converts a request ID made of 32 hexadecimal digits (like UUIDs) to a trace ID.
+func requestIdTraceID(requestId string) (am.TraceID, bool) {
+	var tid am.TraceID
+
+	digits := strings.ToLower(strings.ReplaceAll(requestId, "-", ""))
+	if !decodeHex(tid[:], digits) || tid == (am.TraceID{}) {
+		return tid, false
+	}
+
+	return tid, true
+}
+
+// decodeHex decodes exactly len(dst) bytes of lowercase hexadecimal from src.
+func decodeHex(dst []byte, src string) bool {
+	if len(src) != 2*len(dst) || !isLowerHex(src) {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,191 @@
+package midhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+var (
+	testTraceID = am.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	testSpanID  = am.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	for name, test := range map[string]struct {
+		value string
+		valid bool
+		flags byte
+	}{
+		"valid":                 {value: testTraceparent, valid: true, flags: 0x01},
+		"not sampled":           {value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		"surrounding spaces":    {value: " " + testTraceparent + " ", valid: true, flags: 0x01},
+		"future version":        {value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds", valid: true, flags: 0x01},
+		"empty":                 {value: ""},
+		"version ff":            {value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"extra field":           {value: testTraceparent + "-extra"},
+		"missing field":         {value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		"all-zero trace ID":     {value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		"all-zero span ID":      {value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		"uppercase":             {value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		"short trace ID":        {value: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01"},
+		"not hexadecimal":       {value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01"},
+		"not hexadecimal flags": {value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tid, sid, flags, ok := ParseTraceparent(test.value)
+
+			assert.Equal(t, test.valid, ok)
+			if test.valid {
+				assert.Equal(t, testTraceID, tid)
+				assert.Equal(t, testSpanID, sid)
+				assert.Equal(t, test.flags, flags)
+			}
+		})
+	}
+}
+
+func TestFormatTraceparent(t *testing.T) {
+	assert.Equal(t, testTraceparent, FormatTraceparent(testTraceID, testSpanID, 0x01))
+
+	tid, sid, flags, ok := ParseTraceparent(FormatTraceparent(testTraceID, testSpanID, 0x00))
+	assert.True(t, ok)
+	assert.Equal(t, testTraceID, tid)
+	assert.Equal(t, testSpanID, sid)
+	assert.Equal(t, byte(0x00), flags)
+}
+
+func TestInjectTraceHeaders(t *testing.T) {
+	sampledCtx := context.WithValue(
+		am.NewContextWithOpts(context.Background(), am.WithTraceID(testTraceID[:]), am.WithSpanID(testSpanID[:])),
+		traceFlagsKey, byte(0xff),
+	)
+
+	for name, test := range map[string]struct {
+		ctx    context.Context
+		header http.Header
+		want   http.Header
+	}{
+		"nil context": {
+			header: http.Header{},
+			want:   http.Header{},
+		},
+		"no trace": {
+			ctx:    am.NewContext(context.Background()),
+			header: http.Header{},
+			want:   http.Header{},
+		},
+		"trace": {
+			ctx:    sampledCtx,
+			header: http.Header{},
+			want:   http.Header{"Traceparent": {testTraceparent}},
+		},
+		"tracestate and request ID": {
+			ctx:    context.WithValue(context.WithValue(sampledCtx, tracestateKey, "vendor=value"), requestIdKey, "request"),
+			header: http.Header{},
+			want: http.Header{
+				"Traceparent":  {testTraceparent},
+				"Tracestate":   {"vendor=value"},
+				"X-Request-Id": {"request"},
+			},
+		},
+		"existing headers": {
+			ctx:    context.WithValue(context.WithValue(sampledCtx, tracestateKey, "vendor=value"), requestIdKey, "request"),
+			header: http.Header{"Traceparent": {"set"}, "X-Request-Id": {"set"}},
+			want:   http.Header{"Traceparent": {"set"}, "X-Request-Id": {"set"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			InjectTraceHeaders(test.ctx, test.header)
+
+			assert.Equal(t, test.want, test.header)
+		})
+	}
+}
+
+// TestMiddlewareTrace makes sure that the middleware continues the trace of the tracing
+// headers of the incoming request, and that it propagates them in outgoing requests.
+func TestMiddlewareTrace(t *testing.T) {
+	const requestId = "4bf92f35-77b3-4da6-a3ce-929d0e0e4736"
+
+	for name, test := range map[string]struct {
+		header    http.Header
+		opts      []am.Option
+		traceID   am.TraceID
+		spanID    am.SpanID
+		propagate http.Header
+	}{
+		"no headers": {
+			header:    http.Header{},
+			propagate: http.Header{},
+		},
+		"traceparent": {
+			header:    http.Header{"Traceparent": {testTraceparent}, "Tracestate": {"vendor=value"}},
+			traceID:   testTraceID,
+			spanID:    testSpanID,
+			propagate: http.Header{"Traceparent": {testTraceparent}, "Tracestate": {"vendor=value"}},
+		},
+		"malformed traceparent": {
+			header:    http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"}, "Tracestate": {"vendor=value"}},
+			propagate: http.Header{},
+		},
+		"all-zero traceparent": {
+			header:    http.Header{"Traceparent": {"00-00000000000000000000000000000000-0000000000000000-01"}},
+			propagate: http.Header{},
+		},
+		"version ff": {
+			header:    http.Header{"Traceparent": {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+			propagate: http.Header{},
+		},
+		"request ID ignored by default": {
+			header:    http.Header{"X-Request-Id": {requestId}},
+			propagate: http.Header{},
+		},
+		"request ID": {
+			header:    http.Header{"X-Request-Id": {requestId}},
+			opts:      []am.Option{WithRequestIdHeader()},
+			traceID:   testTraceID,
+			propagate: http.Header{"X-Request-Id": {requestId}},
+		},
+		"request ID that is not a UUID": {
+			header:    http.Header{"X-Request-Id": {"request"}},
+			opts:      []am.Option{WithRequestIdHeader()},
+			propagate: http.Header{"X-Request-Id": {"request"}},
+		},
+		"traceparent over request ID": {
+			header:    http.Header{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"}, "X-Request-Id": {requestId}},
+			opts:      []am.Option{WithRequestIdHeader()},
+			traceID:   am.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+			spanID:    am.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+			propagate: http.Header{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"}, "X-Request-Id": {requestId}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			inst := &fakeInstrumenter{}
+			var outgoing http.Header
+			handler := Middleware(inst.instrumenter(), func(w http.ResponseWriter, r *http.Request) {
+				outgoing = http.Header{}
+				InjectTraceHeaders(r.Context(), outgoing)
+			}, test.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+			req.Header = test.header
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if assert.Len(t, inst.calls, 1) {
+				tid, _ := am.GetTraceID(inst.calls[0].ctx)
+				sid, _ := am.GetSpanID(inst.calls[0].ctx)
+				assert.Equal(t, test.traceID, tid)
+				assert.Equal(t, test.spanID, sid)
+			}
+			assert.Equal(t, test.propagate, outgoing)
+		})
+	}
+}
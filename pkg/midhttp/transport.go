@@ -0,0 +1,115 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/pkg/middleware/midhttp"
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// TransportModule is the module reported for the outgoing requests recorded by the
+// instrumented transports.
+const TransportModule = "net/http"
+
+// SetRouteTemplate sets the route template of the outgoing requests made with ctx, like
+// "/users/{id}".
+//
+// The instrumented transports report outgoing requests as calls to a function named
+// after the host and the route template of the request. Requests without a route
+// template are only identified by their host, to keep the cardinality of the function
+// label bounded.
+func SetRouteTemplate(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, routeTemplateKey, template)
+}
+
+// GetRouteTemplate returns the route template of the outgoing requests made with ctx, or
+// an empty string if none was set.
+func GetRouteTemplate(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	template, _ := ctx.Value(routeTemplateKey).(string)
+	return template
+}
+
+// TransportFunctionID returns the function identity of an outgoing request.
+//
+// The function is the host of the request followed by its route template (see
+// [SetRouteTemplate]), and the module is [TransportModule].
+func TransportFunctionID(req *http.Request) am.FunctionID {
+	return am.FunctionID{
+		Function: req.URL.Host + GetRouteTemplate(req.Context()),
+		Module:   TransportModule,
+	}
+}
+
+// NewTransportContext returns the autometrics context of an outgoing request.
+//
+// The context identifies the call with [TransportFunctionID], unless the options
+// set another name (for example with [am.WithFunctionName]).
+func NewTransportContext(req *http.Request, opts ...am.Option) context.Context {
+	ctx := am.SetFunctionID(req.Context(), TransportFunctionID(req))
+	return am.NewContextWithOpts(ctx, opts...)
+}
+
+// StatusError returns an error if the status code of the response is not in the valid
+// ranges of the context (see [am.SetValidHttpCodeRanges]), and nil otherwise.
+func StatusError(ctx context.Context, resp *http.Response) error {
+	for _, codeRange := range am.GetValidHttpCodeRanges(ctx) {
+		if codeRange.Contains(resp.StatusCode) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected response status: %s", resp.Status)
+}
+
+type transport struct {
+	inst Instrumenter
+	base http.RoundTripper
+	opts []am.Option
+}
+
+// Transport wraps a RoundTripper to record each outgoing request as a function call with inst.
+//
+// The function is named after the host and the route template of the request (see
+// [SetRouteTemplate]), unless a name is given with [am.WithFunctionName]. The caller
+// is the instrumented function that made the request, as found in the request context.
+// A request is successful when the response status code is in the valid ranges
+// (see [am.WithValidHttpCodes]), and the trace headers are propagated to the callee.
+//
+// A nil base uses [http.DefaultTransport].
+func Transport(inst Instrumenter, base http.RoundTripper, opts ...am.Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{inst: inst, base: base, opts: opts}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := t.inst.PreInstrument(NewTransportContext(req, t.opts...))
+	if ctx == nil {
+		// Autometrics is not active
+		return t.base.RoundTrip(req)
+	}
+
+	var callErr error
+	defer t.inst.Instrument(ctx, &callErr)
+
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(ctx)
+	InjectTraceHeaders(ctx, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		callErr = err
+		return resp, err
+	}
+
+	callErr = StatusError(ctx, resp)
+
+	return resp, nil
+}
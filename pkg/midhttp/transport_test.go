@@ -0,0 +1,135 @@
+package midhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+)
+
+var errTransport = errors.New("connection refused")
+
+// failingTransport is a RoundTripper that never reaches the server.
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, errTransport }
+
+// recordingInstrumenter returns an Instrumenter that records the calls in recorder, with the
+// same shared instrumentation as the backends.
+func recordingInstrumenter(recorder *autometricstest.Recorder) Instrumenter {
+	config := &am.Config{Recorders: []am.Recorder{recorder}}
+
+	return Instrumenter{
+		PreInstrument: func(ctx context.Context) context.Context { return am.StartCall(ctx, config, nil) },
+		Instrument:    func(ctx context.Context, err *error) { am.EndCall(ctx, err, nil, nil) },
+	}
+}
+
+// traceparentServer is a test server answering the requests with the status of their
+// "status" query parameter, which keeps the traceparent header of the last request.
+type traceparentServer struct {
+	*httptest.Server
+	traceparent string
+}
+
+func newTraceparentServer(t *testing.T) *traceparentServer {
+	t.Helper()
+
+	server := &traceparentServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.traceparent = r.Header.Get(TraceparentHeader)
+		switch r.URL.Query().Get("status") {
+		case "404":
+			w.WriteHeader(http.StatusNotFound)
+		case "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// TestTransport makes sure that outgoing requests are recorded with their route and their
+// caller, that unsuccessful responses and transport errors are errors, and that the trace of
+// the request is propagated to the server.
+func TestTransport(t *testing.T) {
+	server := newTraceparentServer(t)
+
+	for name, test := range map[string]struct {
+		base   http.RoundTripper
+		opts   []am.Option
+		status string
+		result am.Result
+		err    error
+	}{
+		"success": {
+			status: "200",
+			result: am.ResultOk,
+		},
+		"not found": {
+			status: "404",
+			result: am.ResultError,
+		},
+		"server error": {
+			status: "500",
+			result: am.ResultError,
+		},
+		"valid not found": {
+			opts:   []am.Option{am.WithValidHttpCodes([]am.InclusiveIntRange{{Min: 200, Max: 299}, {Min: 404, Max: 404}})},
+			status: "404",
+			result: am.ResultOk,
+		},
+		"transport error": {
+			base:   failingTransport{},
+			status: "200",
+			result: am.ResultError,
+			err:    errTransport,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			recorder := autometricstest.NewRecorder()
+			inst := recordingInstrumenter(recorder)
+			server.traceparent = ""
+
+			callerCtx := inst.PreInstrument(am.NewContextWithOpts(context.Background(), am.WithFunctionName("getUser")))
+			req, err := http.NewRequestWithContext(SetRouteTemplate(callerCtx, "/users/{id}"), http.MethodGet, server.URL+"/users/42?status="+test.status, nil)
+			if err != nil {
+				t.Fatalf("creating the request: %s", err)
+			}
+
+			resp, err := (&http.Client{Transport: Transport(inst, test.base, test.opts...)}).Do(req)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+			} else if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+
+			calls := recorder.Calls(autometricstest.Module(TransportModule))
+			if !assert.Len(t, calls, 1) {
+				return
+			}
+			call := calls[0]
+			assert.Equal(t, server.Listener.Addr().String()+"/users/{id}", call.CallInfo.Current.Function)
+			assert.Equal(t, "getUser", call.CallInfo.Parent.Function)
+			assert.Equal(t, test.result, call.Result)
+
+			if test.base != nil {
+				return
+			}
+			tid, sid, _, ok := ParseTraceparent(server.traceparent)
+			if assert.True(t, ok, "the request should have a traceparent header: %q", server.traceparent) {
+				assert.Equal(t, call.TraceID, tid, "the server should continue the trace of the request")
+				assert.Equal(t, call.SpanID, sid, "the server should be a child of the request")
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+// Package midsql contains the common implementation of the database/sql/driver wrappers
+// used in the downstream implementations, that record database calls as autometrics function calls.
+package midsql // import "github.com/autometrics-dev/autometrics-go/pkg/midsql"
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// Module is the module reported for the database calls recorded by the wrappers.
+const Module = "database/sql"
+
+// Operations reported as function names when a call does not have any query name.
+const (
+	OperationExec     = "Exec"
+	OperationQuery    = "Query"
+	OperationBegin    = "Begin"
+	OperationCommit   = "Commit"
+	OperationRollback = "Rollback"
+)
+
+type contextKey int
+
+const (
+	queryNameKey contextKey = iota
+)
+
+// SetQueryName sets the name of the queries executed with ctx, like "get_user".
+//
+// The wrappers report Exec and Query calls as calls to a function named after the
+// query. Queries without a name are reported as [OperationExec] or [OperationQuery],
+// because the text of queries is unbounded and cannot be used as a label.
+func SetQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey, name)
+}
+
+// GetQueryName returns the name of the queries executed with ctx, or an empty
+// string if none was set.
+func GetQueryName(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	name, _ := ctx.Value(queryNameKey).(string)
+	return name
+}
+
+// Instrumenter holds the functions of a backend that record a function call.
+type Instrumenter struct {
+	// PreInstrument starts a function call, and returns nil if autometrics is not active.
+	PreInstrument func(ctx context.Context) context.Context
+	// Instrument ends a function call started with PreInstrument.
+	Instrument func(ctx context.Context, err *error)
+	// Options are applied to the context of every function call.
+	Options []am.Option
+}
+
+// start returns the context of a call to the database, or nil when the call should not be recorded.
+func (inst Instrumenter) start(ctx context.Context, function string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = am.SetFunctionID(ctx, am.FunctionID{Function: function, Module: Module})
+	return inst.PreInstrument(am.NewContextWithOpts(ctx, inst.Options...))
+}
+
+// end records the end of a call started with start.
+func (inst Instrumenter) end(ctx context.Context, err error) {
+	if ctx == nil {
+		return
+	}
+	inst.Instrument(ctx, &err)
+}
+
+// record records a call to the database that ran since begin and returned err, for the calls
+// that the driver can skip with [driver.ErrSkip]. Skipped calls are not recorded, as database/sql
+// runs them again with a prepared statement, which records them.
+//
+// As the call is only recorded once it is over, it is not counted in the concurrent calls.
+func (inst Instrumenter) record(ctx context.Context, function string, begin time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+
+	callCtx := inst.start(ctx, function)
+	if callCtx == nil {
+		return
+	}
+	// The clock of the configuration is not always the wall clock, so only the elapsed time is kept.
+	callCtx = am.SetStartTime(callCtx, am.GetConfig(callCtx).Now().Add(-time.Since(begin)))
+	// ErrBadConn is retried by database/sql as well, but reporting it shows connection issues.
+	inst.Instrument(callCtx, &err)
+}
+
+func queryFunction(ctx context.Context, operation string) string {
+	if name := GetQueryName(ctx); name != "" {
+		return name
+	}
+
+	return operation
+}
+
+// WrapDriver returns a driver recording all the Exec, Query, Begin, Commit and Rollback
+// calls of the connections it opens.
+func WrapDriver(d driver.Driver, inst Instrumenter) driver.Driver {
+	if dc, ok := d.(driver.DriverContext); ok {
+		return &wrappedDriverContext{wrappedDriver: wrappedDriver{Driver: d, inst: inst}, dc: dc}
+	}
+
+	return &wrappedDriver{Driver: d, inst: inst}
+}
+
+// WrapConnector returns a connector recording all the Exec, Query, Begin, Commit and
+// Rollback calls of the connections it opens.
+func WrapConnector(c driver.Connector, inst Instrumenter) driver.Connector {
+	return &wrappedConnector{Connector: c, inst: inst}
+}
+
+type wrappedDriver struct {
+	driver.Driver
+	inst Instrumenter
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrappedConn{Conn: conn, inst: d.inst}, nil
+}
+
+type wrappedDriverContext struct {
+	wrappedDriver
+	dc driver.DriverContext
+}
+
+func (d *wrappedDriverContext) OpenConnector(name string) (driver.Connector, error) {
+	connector, err := d.dc.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrappedConnector{Connector: connector, inst: d.inst, driver: d}, nil
+}
+
+type wrappedConnector struct {
+	driver.Connector
+	inst   Instrumenter
+	driver driver.Driver
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrappedConn{Conn: conn, inst: c.inst}, nil
+}
+
+// Close closes the wrapped connector if it can be closed, as [sql.DB.Close] only closes
+// the connectors implementing [io.Closer].
+func (c *wrappedConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (c *wrappedConnector) Driver() driver.Driver {
+	if c.driver != nil {
+		return c.driver
+	}
+
+	return &wrappedDriver{Driver: c.Connector.Driver(), inst: c.inst}
+}
+
+type wrappedConn struct {
+	driver.Conn
+	inst Instrumenter
+}
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &wrappedStmt{Stmt: stmt, inst: c.inst, conn: c.Conn}, nil
+}
+
+func (c *wrappedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	callCtx := c.inst.start(ctx, OperationBegin)
+	defer func() { c.inst.end(callCtx, err) }()
+
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// driver.Tx methods do not have a context, so the one of the transaction is kept
+	// to find the caller of Commit and Rollback.
+	return &wrappedTx{Tx: tx, inst: c.inst, ctx: ctx}, nil
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	begin := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	c.inst.record(ctx, queryFunction(ctx, OperationExec), begin, err)
+
+	return res, err
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	begin := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.inst.record(ctx, queryFunction(ctx, OperationQuery), begin, err)
+
+	return rows, err
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	return driver.ErrSkip
+}
+
+type wrappedStmt struct {
+	driver.Stmt
+	inst Instrumenter
+	conn driver.Conn
+}
+
+func (s *wrappedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	callCtx := s.inst.start(ctx, queryFunction(ctx, OperationExec))
+	defer func() { s.inst.end(callCtx, err) }()
+
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+
+	values, err := driverValues(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Stmt.Exec(values)
+}
+
+func (s *wrappedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	callCtx := s.inst.start(ctx, queryFunction(ctx, OperationQuery))
+	defer func() { s.inst.end(callCtx, err) }()
+
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+
+	values, err := driverValues(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Stmt.Query(values)
+}
+
+// CheckNamedValue uses the checker of the statement, or the one of the connection, as
+// database/sql only looks for the connection checker when the statement does not have one.
+func (s *wrappedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	if checker, ok := s.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	return driver.ErrSkip
+}
+
+type wrappedTx struct {
+	driver.Tx
+	inst Instrumenter
+	ctx  context.Context
+}
+
+func (tx *wrappedTx) Commit() (err error) {
+	callCtx := tx.inst.start(tx.ctx, OperationCommit)
+	defer func() { tx.inst.end(callCtx, err) }()
+
+	return tx.Tx.Commit()
+}
+
+func (tx *wrappedTx) Rollback() (err error) {
+	callCtx := tx.inst.start(tx.ctx, OperationRollback)
+	defer func() { tx.inst.end(callCtx, err) }()
+
+	return tx.Tx.Rollback()
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+
+	return named
+}
+
+func driverValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("midsql: the driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,424 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+)
+
+// errNotInitialized is the cause of the inactivity of the default instance before [Init] is called.
+var errNotInitialized = errors.New("autometrics: Init has not been called")
+
+// errShutdown is the cause of the inactivity of an instance after [Autometrics.Shutdown] is called.
+var errShutdown = errors.New("autometrics: Shutdown has been called")
+
+// defaultInstance is the instance used by the package-level functions, set by [Init].
+var defaultInstance atomic.Pointer[Autometrics]
+
+func init() {
+	inactiveCtx, cancel := context.WithCancelCause(context.Background())
+	cancel(errNotInitialized)
+	defaultInstance.Store(&Autometrics{ctx: inactiveCtx, cancel: cancel, config: am.DefaultConfig()})
+}
+
+// Autometrics is an instance of autometrics, with its own configuration and metrics.
+//
+// Several instances can be used in the same process, as long as they register their metrics
+// to different registries. The package-level functions (like [PreInstrument] and [Instrument])
+// use the instance created by [Init].
+type Autometrics struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	config *am.Config
+
+	functionCallsCount      *prometheus.CounterVec
+	functionCallsDuration   *prometheus.HistogramVec
+	functionCallsConcurrent *prometheus.GaugeVec
+	buildInfo               *prometheus.GaugeVec
+
+	pusher *pusher
+
+	// registerer is the registry the collectors of the instance are registered to, so that
+	// they can be unregistered at shutdown.
+	registerer     prometheus.Registerer
+	collectorsLock sync.Mutex
+	collectors     []prometheus.Collector
+}
+
+// New creates an instance of autometrics, and registers its metrics to the registry
+// of the options (or to the default global registry if there is none).
+//
+// New fails if the metrics are already registered to the registry by another instance, which
+// must be shut down first with [Autometrics.Shutdown].
+//
+// Unlike [Init], New does not change the instance used by the package-level functions, so
+// the functions to instrument must use the methods of the returned instance instead.
+//
+// Make sure that all the latency targets you want to use for SLOs are
+// present in the histogramBuckets array, otherwise the alerts will fail
+// to work (they will never trigger.)
+func New(initOpts ...InitOption) (*Autometrics, error) {
+	initArgs := defaultInitArguments()
+	for _, initOpt := range initOpts {
+		if err := initOpt.Apply(&initArgs); err != nil {
+			return nil, fmt.Errorf("initialization argument: %w", err)
+		}
+	}
+
+	err := initArgs.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("init options validation: %w", err)
+	}
+
+	newCtx, cancelFunc := context.WithCancelCause(context.Background())
+	a := &Autometrics{
+		ctx:    newCtx,
+		cancel: cancelFunc,
+		config: &am.Config{
+			Version:          initArgs.version,
+			Commit:           initArgs.commit,
+			Branch:           initArgs.branch,
+			Logger:           initArgs.logger,
+			ResultClassifier: initArgs.resultClassifier,
+			ExtraResults:     initArgs.extraResults,
+			ErrorKinds:       initArgs.errorKinds,
+			TraceIDExtractor: initArgs.traceIDExtractor,
+			Recorders:        initArgs.recorders,
+		},
+	}
+	if initArgs.tracerProvider != nil {
+		a.config.Tracer = initArgs.tracerProvider.Tracer("autometrics")
+	}
+
+	if initArgs.HasRemoteWriteEnabled() {
+		a.config.GetLogger().Debug("Init: detected remote write configuration to %s", initArgs.remoteWriteURL)
+		a.config.PushJobURL = initArgs.remoteWriteURL
+		a.config.PushJobName = initArgs.pushJobName
+	} else if initArgs.HasPushEnabled() {
+		a.config.GetLogger().Debug("Init: detected push configuration to %s", initArgs.pushCollectorURL)
+		a.config.PushJobURL = initArgs.pushCollectorURL
+		a.config.PushJobName = initArgs.pushJobName
+	}
+
+	if serviceName, ok := os.LookupEnv(am.AutometricsServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else if serviceName, ok := os.LookupEnv(am.OTelServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else {
+		a.config.Service = initArgs.service
+	}
+
+	if repoURL, ok := os.LookupEnv(am.AutometricsRepoURLEnv); ok {
+		a.config.RepositoryURL = repoURL
+	} else {
+		a.config.RepositoryURL = initArgs.repoURL
+	}
+	if repoProvider, ok := os.LookupEnv(am.AutometricsRepoProviderEnv); ok {
+		a.config.RepositoryProvider = repoProvider
+	} else {
+		a.config.RepositoryProvider = initArgs.repoProvider
+	}
+
+	functionCallsCountLabels := []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, ResultLabel, TargetSuccessRateLabel, SloNameLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel}
+	if initArgs.errorKinds != nil {
+		functionCallsCountLabels = append(functionCallsCountLabels, ErrorKindLabel)
+	}
+
+	a.functionCallsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: FunctionCallsCountName,
+	}, functionCallsCountLabels)
+
+	a.functionCallsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    FunctionCallsDurationName,
+		Buckets: initArgs.histogramBuckets,
+	}, []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, TargetLatencyLabel, TargetSuccessRateLabel, SloNameLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel})
+
+	a.functionCallsConcurrent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: FunctionCallsConcurrentName,
+	}, []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel})
+
+	a.buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: BuildInfoName,
+	}, []string{CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel, RepositoryURLLabel, RepositoryProviderLabel, AutometricsVersionLabel})
+
+	a.registerer = prometheus.DefaultRegisterer
+	if initArgs.registry != nil {
+		a.registerer = initArgs.registry
+	}
+	if err := a.register(a.functionCallsCount, a.functionCallsDuration, a.functionCallsConcurrent, a.buildInfo); err != nil {
+		a.unregister()
+		cancelFunc(err)
+		return nil, err
+	}
+
+	a.buildInfo.With(prometheus.Labels{
+		CommitLabel:             a.config.Commit,
+		VersionLabel:            a.config.Version,
+		BranchLabel:             a.config.Branch,
+		ServiceNameLabel:        a.config.Service,
+		RepositoryURLLabel:      a.config.RepositoryURL,
+		RepositoryProviderLabel: a.config.RepositoryProvider,
+		AutometricsVersionLabel: AutometricsSpecVersion,
+	}).Set(1)
+
+	if initArgs.HasPushEnabled() {
+		pushTimeout := am.PushTimeout(a.config.GetLogger(), initArgs.pushTimeout, defaultPushTimeout)
+
+		// The dropped pushes are read from the push queue, which needs the collectors to push,
+		// so the counter is registered once the queue exists.
+		var dropped func() uint64
+		pushesDropped := prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: PushesDroppedName,
+			Help: "The number of metrics snapshots dropped without being pushed.",
+		}, func() float64 { return float64(dropped()) })
+
+		var send func(context.Context) error
+		var cleanup func() error
+		if initArgs.HasRemoteWriteEnabled() {
+			// The remote writer gathers the metrics of the instance only, whatever the registry is.
+			gatherer := prometheus.NewRegistry()
+			gatherer.MustRegister(a.functionCallsCount, a.functionCallsDuration, a.functionCallsConcurrent, a.buildInfo, pushesDropped)
+			writer := &remoteWriter{
+				client:   &http.Client{},
+				url:      a.config.PushJobURL,
+				headers:  initArgs.pushHeaders,
+				jobName:  a.config.PushJobName,
+				gatherer: gatherer,
+			}
+			if initArgs.pushBasicAuth != nil {
+				writer.username = initArgs.pushBasicAuth.username
+				writer.password = initArgs.pushBasicAuth.password
+			}
+
+			spool := am.NewMemorySpool[[]byte](initArgs.pushSpoolSize)
+			if initArgs.pushSpoolDir != "" {
+				spool, err = am.NewDiskSpool(initArgs.pushSpoolDir, initArgs.pushSpoolSize)
+				if err != nil {
+					err = fmt.Errorf("initializing push spool: %w", err)
+					a.unregister()
+					cancelFunc(err)
+					return nil, err
+				}
+			}
+			queue := am.NewPushQueue(spool, initArgs.pushRetry, pushTimeout, writer.write)
+			dropped = queue.Dropped
+			send = func(ctx context.Context) error {
+				snapshot, err := writer.snapshot()
+				if err != nil {
+					return err
+				}
+				return queue.Push(ctx, snapshot)
+			}
+		} else {
+			gateway := push.
+				New(a.config.PushJobURL, a.config.PushJobName).
+				Format(expfmt.FmtText).
+				// The timeout of the client bounds the deletion of the group, which takes no context.
+				Client(&http.Client{Timeout: pushTimeout}).
+				Collector(a.functionCallsCount).
+				Collector(a.functionCallsDuration).
+				Collector(a.functionCallsConcurrent).
+				Collector(a.buildInfo).
+				Collector(pushesDropped)
+			for name, value := range initArgs.pushGrouping {
+				gateway.Grouping(name, value)
+			}
+			if initArgs.pushHeaders != nil {
+				header := make(http.Header, len(initArgs.pushHeaders))
+				for name, value := range initArgs.pushHeaders {
+					header.Set(name, value)
+				}
+				gateway.Header(header)
+			}
+			if initArgs.pushBasicAuth != nil {
+				gateway.BasicAuth(initArgs.pushBasicAuth.username, initArgs.pushBasicAuth.password)
+			}
+			if initArgs.pushDeleteGroup {
+				cleanup = gatewayDeleter(gateway)
+			}
+
+			var queue *am.PushQueue[struct{}]
+			send, queue = gatewaySender(gateway, initArgs.pushRetry, pushTimeout)
+			dropped = queue.Dropped
+		}
+		if err := a.register(pushesDropped); err != nil {
+			a.unregister()
+			cancelFunc(err)
+			return nil, err
+		}
+
+		a.pusher = newPusher(send, cleanup,
+			am.PushPeriod(a.config.GetLogger(), initArgs.pushPeriod, defaultPushPeriod),
+			pushTimeout,
+			a.config.GetLogger())
+
+		go a.pusher.run(a.ctx)
+	}
+
+	return a, nil
+}
+
+// Init sets up the metrics required for autometrics' decorated functions and registers
+// them to the argument registry.
+//
+// If the passed registry is nil, all the metrics are registered to the
+// default global registry.
+//
+// The created instance is used by the package-level functions (like [PreInstrument] and
+// [Instrument]), and its configuration becomes the default configuration of autometrics.
+//
+// After initialization, use the returned [context.CancelCauseFunc] to flush the last
+// results and turn off metric collection for the remainder of the program's lifetime.
+// It is a good candidate to be deferred in the usual case. To also release the metrics,
+// so that Init can be called again, use [Shutdown] instead.
+//
+// Make sure that all the latency targets you want to use for SLOs are
+// present in the histogramBuckets array, otherwise the alerts will fail
+// to work (they will never trigger.)
+func Init(initOpts ...InitOption) (context.CancelCauseFunc, error) {
+	a, err := New(initOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	am.SetDefaultConfig(a.config)
+	defaultInstance.Store(a)
+
+	return a.Cancel, nil
+}
+
+// Default returns the instance used by the package-level functions.
+//
+// Before [Init] is called, the default instance is inactive and does not record anything.
+func Default() *Autometrics {
+	return defaultInstance.Load()
+}
+
+// Config returns the configuration of the instance.
+func (a *Autometrics) Config() *am.Config {
+	return a.config
+}
+
+// Cancel turns off metric collection for the instance, for the remainder of the program's lifetime.
+//
+// It is the equivalent of the function returned by [Init]. When the instance pushes its metrics
+// to a Prometheus Push Gateway, Cancel returns once the metrics have been pushed a last time.
+func (a *Autometrics) Cancel(cause error) {
+	a.cancel(cause)
+
+	if a.pusher != nil {
+		// The context of the instance is over, but the last push still deserves its full timeout.
+		ctx, cancel := context.WithTimeout(context.Background(), a.pusher.timeout)
+		defer cancel()
+		if err := a.pusher.stop(ctx); err != nil {
+			a.config.GetLogger().Error("autometrics: %s", err)
+		}
+	}
+}
+
+// Shutdown turns off metric collection for the instance used by the package-level functions,
+// and releases its resources, so that [Init] can be called again.
+//
+// See [Autometrics.Shutdown] for the details.
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
+
+// Shutdown turns off metric collection for the instance, pushes the metrics a last time when
+// the instance pushes them, and unregisters the metrics from the registry, so that another
+// instance can register them again.
+//
+// The last push is abandoned when ctx is done, and its error is returned. Calling Shutdown
+// more than once, or after [Autometrics.Cancel], is safe.
+func (a *Autometrics) Shutdown(ctx context.Context) error {
+	a.cancel(errShutdown)
+
+	var err error
+	if a.pusher != nil {
+		err = a.pusher.stop(ctx)
+	}
+	a.unregister()
+
+	return err
+}
+
+// register registers the collectors to the registerer of the instance, and remembers them
+// so that they can be unregistered at shutdown.
+func (a *Autometrics) register(collectors ...prometheus.Collector) error {
+	a.collectorsLock.Lock()
+	defer a.collectorsLock.Unlock()
+
+	for _, collector := range collectors {
+		if err := a.registerer.Register(collector); err != nil {
+			return fmt.Errorf("registering metrics (is another instance registered to the same registry?): %w", err)
+		}
+		a.collectors = append(a.collectors, collector)
+	}
+
+	return nil
+}
+
+// unregister unregisters the collectors registered by the instance.
+func (a *Autometrics) unregister() {
+	a.collectorsLock.Lock()
+	defer a.collectorsLock.Unlock()
+
+	for _, collector := range a.collectors {
+		a.registerer.Unregister(collector)
+	}
+	a.collectors = nil
+}
+
+// ForceFlush forces a flush of the metrics, in the case autometrics is pushing metrics to a Prometheus Push Gateway.
+//
+// This function is a no-op if no push configuration has been setup in [Init], but will return an error if
+// autometrics is not active (because this function is called before [Init] or after its shutdown function
+// has been called).
+func ForceFlush() error {
+	return Default().ForceFlush()
+}
+
+// ForceFlush forces a flush of the metrics of the instance, in the case it is pushing metrics to a
+// Prometheus Push Gateway.
+//
+// This function is a no-op if no push configuration has been setup in [New], but will return an error if
+// the instance is not active (because [Autometrics.Cancel] or [Autometrics.Shutdown] has been called).
+func (a *Autometrics) ForceFlush() error {
+	if a.ctx.Err() != nil {
+		return fmt.Errorf("autometrics is not currently active: %w", context.Cause(a.ctx))
+	}
+
+	if a.pusher != nil {
+		return a.pusher.push(a.ctx)
+	}
+
+	return nil
+}
+
+// Middleware wraps a handler to record each request as a function call with the instance.
+//
+// See the midhttp package for the options.
+func (a *Autometrics) Middleware(next http.HandlerFunc, opts ...am.Option) http.HandlerFunc {
+	return mid.Middleware(a.instrumenter(), next, opts...)
+}
+
+// Transport wraps a RoundTripper to record each outgoing request as a function call with the instance.
+//
+// A nil base uses [http.DefaultTransport]. See the midhttp package for the options.
+func (a *Autometrics) Transport(base http.RoundTripper, opts ...am.Option) http.RoundTripper {
+	return mid.Transport(a.instrumenter(), base, opts...)
+}
+
+func (a *Autometrics) instrumenter() mid.Instrumenter {
+	return mid.Instrumenter{PreInstrument: a.PreInstrument, Instrument: a.Instrument}
+}
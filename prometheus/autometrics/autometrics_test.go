@@ -0,0 +1,210 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// callsByLabels returns the number of recorded calls for each value of the given labels, joined with "/".
+func callsByLabels(t *testing.T, registry *prometheus.Registry, labelNames ...string) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+
+	calls := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != FunctionCallsCountName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			key := ""
+			for i, name := range labelNames {
+				if i > 0 {
+					key += "/"
+				}
+				key += labels[name]
+			}
+			calls[key] += metric.GetCounter().GetValue()
+		}
+	}
+
+	return calls
+}
+
+func instrumentedWith(ctx context.Context, a *Autometrics, fail bool) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	if fail {
+		return errors.New("failure")
+	}
+
+	return nil
+}
+
+func instrumentedPanic(ctx context.Context, a *Autometrics) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	panic("crash")
+}
+
+func TestIndependentInstances(t *testing.T) {
+	firstRegistry := prometheus.NewRegistry()
+	first, err := New(WithRegistry(firstRegistry), WithVersion("1.0.0"))
+	if err != nil {
+		t.Fatalf("creating the first instance: %s", err)
+	}
+
+	secondRegistry := prometheus.NewRegistry()
+	second, err := New(WithRegistry(secondRegistry), WithVersion("2.0.0"))
+	if err != nil {
+		t.Fatalf("creating the second instance: %s", err)
+	}
+
+	_ = instrumentedWith(context.Background(), first, false)
+	_ = instrumentedWith(context.Background(), second, true)
+	_ = instrumentedWith(context.Background(), second, false)
+
+	assert.Equal(t,
+		map[string]float64{"instrumentedWith/ok/1.0.0": 1},
+		callsByLabels(t, firstRegistry, FunctionLabel, ResultLabel, VersionLabel))
+	assert.Equal(t,
+		map[string]float64{"instrumentedWith/ok/2.0.0": 1, "instrumentedWith/error/2.0.0": 1},
+		callsByLabels(t, secondRegistry, FunctionLabel, ResultLabel, VersionLabel))
+
+	second.Cancel(nil)
+	_ = instrumentedWith(context.Background(), second, false)
+	assert.Equal(t,
+		map[string]float64{"instrumentedWith/ok/2.0.0": 1, "instrumentedWith/error/2.0.0": 1},
+		callsByLabels(t, secondRegistry, FunctionLabel, ResultLabel, VersionLabel),
+		"a cancelled instance should not record calls")
+	assert.Error(t, second.ForceFlush())
+}
+
+func TestRecorders(t *testing.T) {
+	migratedRegistry := prometheus.NewRegistry()
+	migrated, err := New(WithRegistry(migratedRegistry))
+	if err != nil {
+		t.Fatalf("creating the migrated instance: %s", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	a, err := New(WithRegistry(registry), WithVersion("1.0.0"), WithRecorders(migrated))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	_ = instrumentedWith(context.Background(), a, true)
+	_ = instrumentedWith(context.Background(), a, false)
+
+	want := map[string]float64{"instrumentedWith/ok/1.0.0": 1, "instrumentedWith/error/1.0.0": 1}
+	assert.Equal(t, want, callsByLabels(t, registry, FunctionLabel, ResultLabel, VersionLabel))
+	assert.Equal(t, want, callsByLabels(t, migratedRegistry, FunctionLabel, ResultLabel, VersionLabel),
+		"the recorder instance should record the calls of the instance")
+
+	migrated.Cancel(nil)
+	_ = instrumentedWith(context.Background(), a, false)
+	assert.Equal(t, want, callsByLabels(t, migratedRegistry, FunctionLabel, ResultLabel, VersionLabel),
+		"a cancelled recorder instance should not record calls")
+}
+
+func TestInstancePanic(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	a, err := New(WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	assert.PanicsWithValue(t, "crash", func() { _ = instrumentedPanic(context.Background(), a) })
+
+	handler := a.Middleware(func(http.ResponseWriter, *http.Request) { panic("handler crash") },
+		WithFunctionName("crashingHandler"))
+	assert.PanicsWithValue(t, "handler crash", func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	assert.Equal(t,
+		map[string]float64{"instrumentedPanic/error": 1, "crashingHandler/error": 1},
+		callsByLabels(t, registry, FunctionLabel, ResultLabel))
+}
+
+func TestShutdownAllowsInitAgain(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := Init(WithRegistry(registry), WithVersion("1.0.0")); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	_, err := Init(WithRegistry(registry))
+	assert.Error(t, err, "Init must fail while the metrics of the previous instance are registered.")
+
+	_ = instrumentedWith(context.Background(), Default(), false)
+	assert.NoError(t, Shutdown(context.Background()))
+	assert.Empty(t, callsByLabels(t, registry, VersionLabel), "Shutdown must unregister the metrics.")
+	assert.Error(t, ForceFlush())
+	assert.NoError(t, Shutdown(context.Background()), "Shutdown must be idempotent.")
+
+	if _, err := Init(WithRegistry(registry), WithVersion("2.0.0")); err != nil {
+		t.Fatalf("initializing autometrics again: %s", err)
+	}
+	defer func() { _ = Shutdown(context.Background()) }()
+
+	_ = instrumentedWith(context.Background(), Default(), false)
+	assert.Equal(t, map[string]float64{"2.0.0": 1}, callsByLabels(t, registry, VersionLabel))
+}
+
+var errNotFound = errors.New("not found")
+
+// classify reports the canceled calls as successful, and the not found errors with their
+// own result. The other errors get an undeclared result, which is reported as an error.
+func classify(_ context.Context, err error) am.Result {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return am.ResultOk
+	case errors.Is(err, errNotFound):
+		return "not_found"
+	default:
+		return "teapot"
+	}
+}
+
+// classifiedErrors are the errors returned by the calls of the result classifier tests.
+var classifiedErrors = []error{nil, context.Canceled, errNotFound, errNotFound, errors.New("failure")}
+
+func classified(ctx context.Context, a *Autometrics, returned error) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	return returned
+}
+
+// TestResultClassifier makes sure that the result label has the value returned by the classifier.
+func TestResultClassifier(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	a, err := New(WithRegistry(registry), WithResultClassifier(classify, "not_found"))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	for _, returned := range classifiedErrors {
+		_ = classified(context.Background(), a, returned)
+	}
+
+	assert.Equal(t,
+		map[string]float64{"ok": 2, "not_found": 2, "error": 1},
+		callsByLabels(t, registry, ResultLabel))
+}
@@ -2,10 +2,16 @@ package autometrics // import "github.com/autometrics-dev/autometrics-go/prometh
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type initArguments struct {
@@ -20,6 +26,22 @@ type initArguments struct {
 	repoProvider     string
 	pushCollectorURL string
 	pushJobName      string
+	pushPeriod       time.Duration
+	pushTimeout      time.Duration
+	pushRetry        am.RetryPolicy
+	pushSpoolSize    int
+	pushSpoolDir     string
+	pushHeaders      map[string]string
+	pushBasicAuth    *basicAuth
+	pushGrouping     map[string]string
+	pushDeleteGroup  bool
+	remoteWriteURL   string
+	resultClassifier am.ResultClassifier
+	extraResults     []am.Result
+	errorKinds       []am.ErrorKind
+	traceIDExtractor am.TraceIDExtractor
+	tracerProvider   trace.TracerProvider
+	recorders        []am.Recorder
 }
 
 func defaultInitArguments() initArguments {
@@ -27,15 +49,41 @@ func defaultInitArguments() initArguments {
 		histogramBuckets: am.DefBuckets,
 		logger:           log.NoOpLogger{},
 		pushJobName:      am.DefaultJobName(),
+		traceIDExtractor: am.OpenTelemetryTraceIDExtractor{},
+		pushPeriod:       defaultPushPeriod,
+		pushTimeout:      defaultPushTimeout,
+		pushRetry:        am.DefaultRetryPolicy(),
+		pushSpoolSize:    defaultPushSpoolSize,
 	}
 }
 
+type basicAuth struct {
+	username string
+	password string
+}
+
 func (initArgs initArguments) Validate() error {
+	if initArgs.pushCollectorURL != "" && initArgs.remoteWriteURL != "" {
+		return errors.New("the push collector URL and the remote write URL cannot be both set")
+	}
+
+	if initArgs.pushSpoolDir != "" && initArgs.remoteWriteURL == "" {
+		return errors.New("the push spool directory can only be used with a remote write URL")
+	}
+
+	if initArgs.remoteWriteURL != "" && (len(initArgs.pushGrouping) > 0 || initArgs.pushDeleteGroup) {
+		return errors.New("the push grouping labels and group deletion can only be used with a push collector URL")
+	}
+
 	return nil
 }
 
 func (initArgs initArguments) HasPushEnabled() bool {
-	return initArgs.pushCollectorURL != ""
+	return initArgs.pushCollectorURL != "" || initArgs.remoteWriteURL != ""
+}
+
+func (initArgs initArguments) HasRemoteWriteEnabled() bool {
+	return initArgs.remoteWriteURL != ""
 }
 
 type InitOption interface {
@@ -165,6 +213,155 @@ func WithPushJobName(pushJobName string) InitOption {
 	})
 }
 
+// WithPushPeriod sets the duration between consecutive metrics pushes.
+//
+// The standard `OTEL_METRIC_EXPORT_INTERVAL` environment variable overrides
+// this initialization argument.
+//
+// The default value is 10 seconds.
+func WithPushPeriod(pushPeriod time.Duration) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.pushPeriod = pushPeriod
+		return nil
+	})
+}
+
+// WithPushTimeout sets the timeout duration of a single metric push
+//
+// The standard `OTEL_METRIC_EXPORT_TIMEOUT` environment variable overrides
+// this initialization argument.
+//
+// The default value is 5 seconds.
+func WithPushTimeout(pushTimeout time.Duration) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.pushTimeout = pushTimeout
+		return nil
+	})
+}
+
+// WithPushRetry sets the policy to retry the pushes that failed, with an exponential backoff.
+// The retries of a push stop when the next push is due, or when autometrics is shut down.
+//
+// The default value is [DefaultRetryPolicy]. Use [NoRetry] to disable the retries.
+func WithPushRetry(policy RetryPolicy) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("setting push retry policy: %w", err)
+		}
+		initArgs.pushRetry = policy
+		return nil
+	})
+}
+
+// WithPushSpool sets the maximum number of snapshots of the metrics kept in memory while the remote
+// write endpoint is unavailable, to write them once it is back. When the spool is full, the oldest
+// snapshot is dropped and counted in the [PushesDroppedName] counter.
+//
+// Pushes to a Push Gateway always carry the current value of the metrics, so only the last
+// snapshot is ever kept for them.
+//
+// The default value is 10.
+func WithPushSpool(maxSnapshots int) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if maxSnapshots < 1 {
+			return errors.New("setting push spool: the spool must keep at least 1 snapshot")
+		}
+		initArgs.pushSpoolSize = maxSnapshots
+		return nil
+	})
+}
+
+// WithPushSpoolDirectory keeps the snapshots of the spool (see [WithPushSpool]) as files in the
+// directory instead of in memory, so that the snapshots that could not be written to the remote
+// write endpoint survive a restart of the program.
+//
+// The default is to keep the snapshots in memory.
+func WithPushSpoolDirectory(dir string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.pushSpoolDir = dir
+		return nil
+	})
+}
+
+// WithRemoteWriteURL enables writing metrics to a Prometheus remote write endpoint, like the
+// `/api/v1/write` endpoint of Prometheus, Mimir or Thanos, as an alternative to pushing them
+// to a Push Gateway with [WithPushCollectorURL].
+//
+// The metrics are written every push period (see [WithPushPeriod]), and a last time when
+// autometrics is shut down. All the series have a `job` label set to the push job name
+// (see [WithPushJobName]).
+//
+// The default value is an empty string, which also disables remote writing.
+func WithRemoteWriteURL(remoteWriteURL string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if remoteWriteURL != "" && !strings.HasPrefix(remoteWriteURL, "http://") && !strings.HasPrefix(remoteWriteURL, "https://") {
+			return errors.New("set remote write URL: the URL must start with http:// or https://")
+		}
+		initArgs.remoteWriteURL = remoteWriteURL
+		return nil
+	})
+}
+
+// WithPushHeaders adds headers to the requests made to the Push Gateway or to the remote write
+// endpoint (for tenant IDs or bearer tokens for example).
+//
+// The default value is empty.
+func WithPushHeaders(headers map[string]string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.pushHeaders = headers
+		return nil
+	})
+}
+
+// WithPushBasicAuth sets the credentials of the HTTP basic authentication of the requests made
+// to the Push Gateway or to the remote write endpoint.
+//
+// The default is to not authenticate the requests.
+func WithPushBasicAuth(username, password string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if username == "" {
+			return errors.New("set push basic auth: the username cannot be empty")
+		}
+		initArgs.pushBasicAuth = &basicAuth{username: username, password: password}
+		return nil
+	})
+}
+
+// WithPushGrouping adds labels to the grouping key of the metrics pushed to the Push Gateway,
+// on top of the job name (like the instance, pod or region), so that each group of metrics
+// replaces the previous metrics of the same group only.
+//
+// The names of the grouping labels cannot be the names of labels of the autometrics metrics.
+//
+// The default is to group the metrics by job name only.
+func WithPushGrouping(labels map[string]string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for name := range labels {
+			if !model.LabelName(name).IsValid() {
+				return fmt.Errorf("set push grouping: %q is not a valid label name", name)
+			}
+			if reservedGroupingLabels[name] {
+				return fmt.Errorf("set push grouping: %q is the name of a label of the metrics", name)
+			}
+		}
+		initArgs.pushGrouping = labels
+		return nil
+	})
+}
+
+// WithPushDeleteGroup deletes the group of metrics of the instance from the Push Gateway when
+// autometrics is shut down, after the last push. This avoids leaving stale groups in the Push
+// Gateway when instances come and go, at the cost of losing the last values of the metrics once
+// the gateway is scraped.
+//
+// The default is to leave the group in the Push Gateway.
+func WithPushDeleteGroup() InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.pushDeleteGroup = true
+		return nil
+	})
+}
+
 // WithHistogramBuckets sets the buckets to use for the latency histograms.
 //
 // WARNING: your latency SLOs should always use thresolds that are _exactly_ a bucket boundary
@@ -180,3 +377,103 @@ func WithHistogramBuckets(histogramBuckets []float64) InitOption {
 		return nil
 	})
 }
+
+// WithResultClassifier sets the classifier that decides the result of the function
+// calls that returned a non-nil error.
+//
+// This allows for example to report [context.Canceled] or "not found" errors as
+// [ResultOk], so that they do not count against success rate objectives. The
+// classifier can also return a result of its own, as long as it is listed in
+// extraResults; any other returned result is reported as [ResultError] so that
+// the cardinality of the result label stays bounded.
+//
+// The default is to report all errors as [ResultError].
+func WithResultClassifier(classifier am.ResultClassifier, extraResults ...am.Result) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, extraResult := range extraResults {
+			if extraResult == "" {
+				return errors.New("setting result classifier: the allowed results cannot be empty")
+			}
+		}
+		initArgs.resultClassifier = classifier
+		initArgs.extraResults = extraResults
+		return nil
+	})
+}
+
+// WithErrorKinds enables the error kind label on the function calls counter, and sets the
+// kinds of errors it reports.
+//
+// Errors are matched against the kinds in order, and the first match gives the value of the
+// label. Errors that match no kind are reported as [ErrorKindOther], and panics as
+// [ErrorKindPanic]. Use [ErrorKindIs] and [ErrorKindAs] to build kinds from sentinel errors
+// and error types.
+//
+// The default is to not have any error kind label.
+func WithErrorKinds(kinds ...am.ErrorKind) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, kind := range kinds {
+			if kind.Name == "" || kind.Matches == nil {
+				return errors.New("setting error kinds: all error kinds must have a name and a matcher")
+			}
+			if kind.Name == am.ErrorKindOther || kind.Name == am.ErrorKindPanic {
+				return fmt.Errorf("setting error kinds: %q is a reserved error kind name", kind.Name)
+			}
+		}
+		initArgs.errorKinds = append([]am.ErrorKind{}, kinds...)
+		return nil
+	})
+}
+
+// WithTraceIDExtractor sets the extractor that reads the trace and span IDs of the current
+// span from the context given to instrumented functions. The IDs are used as exemplars, so
+// that exemplars resolve to the traces recorded by the tracer of the application.
+//
+// Passing nil disables the extraction, and autometrics always generates random IDs.
+//
+// The default is to read the OpenTelemetry span context, with [OpenTelemetryTraceIDExtractor].
+func WithTraceIDExtractor(extractor am.TraceIDExtractor) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.traceIDExtractor = extractor
+		return nil
+	})
+}
+
+// WithTracerProvider enables span creation: each call to an instrumented function starts
+// a span named after the function with a tracer of the given provider, and ends it with
+// an error status when the call fails. This gives a trace for every instrumented function,
+// and exemplars that always resolve to a span.
+//
+// Passing nil uses the global OpenTelemetry tracer provider, as returned by [otel.GetTracerProvider].
+//
+// The default is to not start any span.
+func WithTracerProvider(provider trace.TracerProvider) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+		initArgs.tracerProvider = provider
+		return nil
+	})
+}
+
+// WithRecorders sets recorders that receive the function calls on top of the metrics of autometrics.
+//
+// Other instances of autometrics are recorders too, which allows to feed several backends with
+// the same instrumented code, for example during a migration from one backend to another:
+// the calls are instrumented, classified and timed once by the instance created with this
+// option, and the other instances record the calls in their own metrics. The result classifier
+// and the error kinds of this instance decide the results and error kinds of the calls.
+//
+// The default is to not have any other recorder.
+func WithRecorders(recorders ...am.Recorder) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, recorder := range recorders {
+			if recorder == nil {
+				return errors.New("setting recorders: the recorders cannot be nil")
+			}
+		}
+		initArgs.recorders = append(initArgs.recorders, recorders...)
+		return nil
+	})
+}
@@ -3,14 +3,9 @@ package autometrics // import "github.com/autometrics-dev/autometrics-go/prometh
 import (
 	"context"
 	"encoding/hex"
-	"log"
-	"strconv"
-	"time"
 
 	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/push"
-	"github.com/prometheus/common/expfmt"
 )
 
 // Instrument called in a defer statement wraps the body of a function
@@ -18,104 +13,45 @@ import (
 //
 // The first argument SHOULD be a call to PreInstrument so that
 // the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
 func Instrument(ctx context.Context, err *error) {
-	if amCtx.Err() != nil {
-		return
-	}
-
-	result := "ok"
-
-	if err != nil && *err != nil {
-		result = "error"
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
 	}
 
-	var sloName, latencyTarget, latencyObjective, successObjective string
-
-	callInfo := am.GetCallInfo(ctx)
-	buildInfo := am.GetBuildInfo(ctx)
-	slo := am.GetAlertConfiguration(ctx)
-
-	if slo.ServiceName != "" {
-		sloName = slo.ServiceName
-
-		if slo.Latency != nil {
-			latencyTarget = strconv.FormatFloat(slo.Latency.Target.Seconds(), 'f', -1, 64)
-			latencyObjective = strconv.FormatFloat(slo.Latency.Objective, 'f', -1, 64)
-		}
+	Default().instrument(ctx, err, panicValue)
+}
 
-		if slo.Success != nil {
-			successObjective = strconv.FormatFloat(slo.Success.Objective, 'f', -1, 64)
-		}
+// Instrument called in a defer statement wraps the body of a function
+// with automatic instrumentation, recorded with the instance.
+//
+// The first argument SHOULD be a call to [Autometrics.PreInstrument] so that
+// the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
+func (a *Autometrics) Instrument(ctx context.Context, err *error) {
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
 	}
 
-	info := exemplars(ctx)
-
-	functionCallsCount.With(prometheus.Labels{
-		FunctionLabel:          callInfo.Current.Function,
-		ModuleLabel:            callInfo.Current.Module,
-		CallerFunctionLabel:    callInfo.Parent.Function,
-		CallerModuleLabel:      callInfo.Parent.Module,
-		ResultLabel:            result,
-		TargetSuccessRateLabel: successObjective,
-		SloNameLabel:           sloName,
-		BranchLabel:            buildInfo.Branch,
-		CommitLabel:            buildInfo.Commit,
-		VersionLabel:           buildInfo.Version,
-		ServiceNameLabel:       buildInfo.Service,
-	}).(prometheus.ExemplarAdder).AddWithExemplar(1, info)
-
-	functionCallsDuration.With(prometheus.Labels{
-		FunctionLabel:          callInfo.Current.Function,
-		ModuleLabel:            callInfo.Current.Module,
-		CallerFunctionLabel:    callInfo.Parent.Function,
-		CallerModuleLabel:      callInfo.Parent.Module,
-		TargetLatencyLabel:     latencyTarget,
-		TargetSuccessRateLabel: latencyObjective,
-		SloNameLabel:           sloName,
-		BranchLabel:            buildInfo.Branch,
-		CommitLabel:            buildInfo.Commit,
-		VersionLabel:           buildInfo.Version,
-		ServiceNameLabel:       buildInfo.Service,
-	}).(prometheus.ExemplarObserver).ObserveWithExemplar(time.Since(am.GetStartTime(ctx)).Seconds(), info)
-
-	if am.GetTrackConcurrentCalls(ctx) {
-		functionCallsConcurrent.With(prometheus.Labels{
-			FunctionLabel:       callInfo.Current.Function,
-			ModuleLabel:         callInfo.Current.Module,
-			CallerFunctionLabel: callInfo.Parent.Function,
-			CallerModuleLabel:   callInfo.Parent.Module,
-			BranchLabel:         buildInfo.Branch,
-			CommitLabel:         buildInfo.Commit,
-			VersionLabel:        buildInfo.Version,
-			ServiceNameLabel:    buildInfo.Service,
-		}).Add(-1)
-	}
+	a.instrument(ctx, err, panicValue)
+}
 
-	if pusher != nil {
-		go func(parentCtx context.Context) {
-			ctx, cancel := context.WithCancel(parentCtx)
-			defer cancel()
-			// PERF: This might induce way too much contention and a growing number of goroutines
-			if pusherLock.TryLock() {
-				defer pusherLock.Unlock()
-				localPusher := push.
-					New(am.GetPushJobURL(), am.GetPushJobName()).
-					Format(expfmt.FmtText).
-					Collector(functionCallsCount).
-					Collector(functionCallsDuration).
-					Collector(functionCallsConcurrent)
-				if err := localPusher.
-					AddContext(ctx); err != nil {
-					log.Printf("failed to push metrics to gateway: %s", err)
-				}
-			}
-		}(amCtx)
+func (a *Autometrics) instrument(ctx context.Context, err *error, panicValue any) {
+	if a.ctx.Err() != nil {
+		return
 	}
 
-	// NOTE: This call means that goroutines that outlive this function as the caller will not have access to parent
-	// caller information, but hopefully by that point we got all the necessary accesses done.
-	// If not, it is a convenience we accept to give up to prevent memory usage from exploding
-	_ = am.PopFunctionName(ctx)
+	am.EndCall(ctx, err, panicValue, a)
 }
 
 // PreInstrument runs the "before wrappee" part of instrumentation.
@@ -123,65 +59,69 @@ func Instrument(ctx context.Context, err *error) {
 // It is meant to be called as the first argument to Instrument in a
 // defer call.
 func PreInstrument(ctx context.Context) context.Context {
-	if amCtx.Err() != nil {
+	return Default().PreInstrument(ctx)
+}
+
+// PreInstrument runs the "before wrappee" part of instrumentation, recorded with the instance.
+//
+// It is meant to be called as the first argument to [Autometrics.Instrument] in a
+// defer call. It returns nil when the instance is not active.
+func (a *Autometrics) PreInstrument(ctx context.Context) context.Context {
+	if a.ctx.Err() != nil {
 		return nil
 	}
 
-	ctx = am.FillTracingAndCallerInfo(ctx)
-	ctx = am.FillBuildInfo(ctx)
-	buildInfo := am.GetBuildInfo(ctx)
-	callInfo := am.GetCallInfo(ctx)
-
-	if am.GetTrackConcurrentCalls(ctx) {
-		functionCallsConcurrent.With(prometheus.Labels{
-			FunctionLabel:       callInfo.Current.Function,
-			ModuleLabel:         callInfo.Current.Module,
-			CallerFunctionLabel: callInfo.Parent.Function,
-			CallerModuleLabel:   callInfo.Parent.Module,
-			BranchLabel:         buildInfo.Branch,
-			CommitLabel:         buildInfo.Commit,
-			VersionLabel:        buildInfo.Version,
-			ServiceNameLabel:    buildInfo.Service,
-		}).Add(1)
+	return am.StartCall(ctx, a.config, a)
+}
+
+// RecordStart increments the concurrent calls gauge of the function if needed.
+//
+// It is called by [Autometrics.PreInstrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordStart(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
 	}
 
-	if pusher != nil {
-		go func(parentCtx context.Context) {
-			ctx, cancel := context.WithCancel(parentCtx)
-			defer cancel()
-			// PERF: Using Lock might induce way too much contention and a growing number of goroutines
-			if pusherLock.TryLock() {
-				defer pusherLock.Unlock()
-				localPusher := push.
-					New(am.GetPushJobURL(), am.GetPushJobName()).
-					Format(expfmt.FmtText).
-					Collector(functionCallsConcurrent)
-				if err := localPusher.AddContext(ctx); err != nil {
-					log.Printf("failed to push metrics to gateway: %s", err)
-				}
-			}
-		}(amCtx)
+	if call.TrackConcurrentCalls {
+		a.functionCallsConcurrent.With(labelNames.CallsConcurrentLabels(a.config.Snapshot(ctx), call)).Add(1)
 	}
+}
 
-	ctx = am.SetStartTime(ctx, time.Now())
+// RecordEnd records the finished call in the metrics of the instance.
+//
+// It is called by [Autometrics.Instrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordEnd(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
+	}
 
-	return ctx
+	config := a.config.Snapshot(ctx)
+	info := exemplars(call)
+
+	a.functionCallsCount.With(labelNames.CallsCountLabels(config, call)).(prometheus.ExemplarAdder).AddWithExemplar(1, info)
+	a.functionCallsDuration.With(labelNames.CallsDurationLabels(config, call)).(prometheus.ExemplarObserver).ObserveWithExemplar(call.Duration.Seconds(), info)
+
+	if call.TrackConcurrentCalls {
+		a.functionCallsConcurrent.With(labelNames.CallsConcurrentLabels(config, call)).Add(-1)
+	}
 }
 
-// Extract exemplars to add to metrics from the context
-func exemplars(ctx context.Context) prometheus.Labels {
+// Extract exemplars to add to metrics from the call
+func exemplars(call am.FunctionCall) prometheus.Labels {
 	labels := make(prometheus.Labels)
 
-	if tid, ok := am.GetTraceID(ctx); ok {
-		labels[traceIdExemplar] = hex.EncodeToString(tid[:])
+	if call.TraceID != (am.TraceID{}) {
+		labels[traceIdExemplar] = hex.EncodeToString(call.TraceID[:])
 	}
 
-	if sid, ok := am.GetSpanID(ctx); ok {
-		labels[spanIdExemplar] = hex.EncodeToString(sid[:])
+	if call.SpanID != (am.SpanID{}) {
+		labels[spanIdExemplar] = hex.EncodeToString(call.SpanID[:])
 	}
 
-	if psid, ok := am.GetParentSpanID(ctx); ok {
-		labels[parentSpanIdExemplar] = hex.EncodeToString(psid[:])
+	if call.ParentSpanID != (am.SpanID{}) {
+		labels[parentSpanIdExemplar] = hex.EncodeToString(call.ParentSpanID[:])
 	}
 
 	return labels
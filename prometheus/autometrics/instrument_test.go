@@ -0,0 +1,112 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func instrumentedParent(ctx context.Context, wg *sync.WaitGroup) (err error) {
+	amCtx := PreInstrument(NewContext(ctx))
+	defer Instrument(amCtx, &err)
+
+	// The callee outlives its caller, so only the context can tell who called it
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = instrumentedChild(amCtx)
+	}()
+
+	return nil
+}
+
+func instrumentedChild(ctx context.Context) (err error) {
+	amCtx := PreInstrument(NewContext(ctx))
+	defer Instrument(amCtx, &err)
+
+	return nil
+}
+
+func TestConcurrentCallers(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := Init(WithRegistry(registry)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+
+	const calls = 5000
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = instrumentedParent(context.Background(), &wg)
+		}()
+	}
+	wg.Wait()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+
+	callers := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != FunctionCallsCountName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[FunctionLabel] == "instrumentedChild" {
+				callers[labels[CallerFunctionLabel]] += metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{"instrumentedParent": calls}, callers)
+}
+
+var errCrash = errors.New("crash")
+
+func panicking(ctx context.Context) (err error) {
+	amCtx := PreInstrument(NewContext(ctx))
+	defer Instrument(amCtx, &err)
+
+	panic(errCrash)
+}
+
+// TestPanic makes sure that Instrument records a panicking call as an error that is not running
+// anymore, and then panics again with the original value.
+func TestPanic(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := Init(WithRegistry(registry)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	defer func() { _ = Shutdown(context.Background()) }()
+
+	assert.PanicsWithValue(t, errCrash, func() { _ = panicking(context.Background()) })
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[FunctionLabel] == "panicking" && family.GetName() != FunctionCallsDurationName {
+				values[family.GetName()+"/"+labels[ResultLabel]] += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{FunctionCallsCountName + "/error": 1, FunctionCallsConcurrentName + "/": 0}, values)
+}
@@ -1,29 +1,18 @@
 package autometrics // import "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
 
 import (
-	"context"
-	"errors"
-	"fmt"
-	"os"
-	"sync"
+	"time"
 
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
 	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/push"
-	"github.com/prometheus/common/expfmt"
 )
 
-var (
-	functionCallsCount      *prometheus.CounterVec
-	functionCallsDuration   *prometheus.HistogramVec
-	functionCallsConcurrent *prometheus.GaugeVec
-	buildInfo               *prometheus.GaugeVec
-	DefBuckets              = autometrics.DefBuckets
+var DefBuckets = autometrics.DefBuckets
 
-	amCtx      context.Context
-	pusher     *push.Pusher
-	pusherLock sync.Mutex
+const (
+	defaultPushPeriod    = 10 * time.Second
+	defaultPushTimeout   = 5 * time.Second
+	defaultPushSpoolSize = 10
 )
 
 const (
@@ -39,6 +28,9 @@ const (
 	FunctionCallsConcurrentName = "function_calls_concurrent"
 	// BuildInfo is the name of the prometheus metric for the version of the monitored codebase.
 	BuildInfoName = "build_info"
+	// PushesDroppedName is the name of the prometheus metric for the counter of metrics snapshots that were
+	// dropped without being pushed, because the push target was unavailable for too long.
+	PushesDroppedName = "autometrics_pushes_dropped_total"
 
 	// FunctionLabel is the prometheus label that describes the function name.
 	//
@@ -58,6 +50,10 @@ const (
 	CallerModuleLabel = "caller_module"
 	// ResultLabel is the prometheus label that describes whether a function call is successful.
 	ResultLabel = "result"
+	// ErrorKindLabel is the prometheus label that describes the kind of error a function call returned.
+	//
+	// The label is only present when error kinds are enabled with [WithErrorKinds].
+	ErrorKindLabel = "error_kind"
 	// TargetLatencyLabel is the prometheus label that describes the latency to respect to match
 	// the Service Level Objective.
 	TargetLatencyLabel = "objective_latency_threshold"
@@ -94,11 +90,55 @@ const (
 	// ServiceNameLabel is the prometheus label that describes the name of the service being monitored
 	ServiceNameLabel = "service_name"
 
+	// JobLabel is the prometheus label added to all the series written to a remote write endpoint,
+	// set to the push job name.
+	JobLabel = "job"
+
 	traceIdExemplar      = "trace_id"
 	spanIdExemplar       = "span_id"
 	parentSpanIdExemplar = "parent_id"
 )
 
+// labelNames are the names of the labels of the function calls metrics.
+var labelNames = autometrics.LabelNames{
+	Function:          FunctionLabel,
+	Module:            ModuleLabel,
+	CallerFunction:    CallerFunctionLabel,
+	CallerModule:      CallerModuleLabel,
+	Result:            ResultLabel,
+	ErrorKind:         ErrorKindLabel,
+	TargetLatency:     TargetLatencyLabel,
+	TargetSuccessRate: TargetSuccessRateLabel,
+	SloName:           SloNameLabel,
+	Commit:            CommitLabel,
+	Version:           VersionLabel,
+	Branch:            BranchLabel,
+	Service:           ServiceNameLabel,
+}
+
+// reservedGroupingLabels are the labels of the metrics, that cannot be used in the grouping key
+// of the pushes to a Push Gateway.
+var reservedGroupingLabels = map[string]bool{
+	JobLabel:                true,
+	FunctionLabel:           true,
+	ModuleLabel:             true,
+	CallerFunctionLabel:     true,
+	CallerModuleLabel:       true,
+	ResultLabel:             true,
+	ErrorKindLabel:          true,
+	TargetLatencyLabel:      true,
+	TargetSuccessRateLabel:  true,
+	SloNameLabel:            true,
+	CommitLabel:             true,
+	VersionLabel:            true,
+	BranchLabel:             true,
+	ServiceNameLabel:        true,
+	RepositoryURLLabel:      true,
+	RepositoryProviderLabel: true,
+	AutometricsVersionLabel: true,
+	bucketLabel:             true,
+}
+
 // Logger is an interface for logging autometrics-related events.
 //
 // This is a reexport to allow using only the current package at call site.
@@ -110,156 +150,17 @@ type PrintLogger = log.PrintLogger
 // This is a reexport to allow using only the current package at call site.
 type NoOpLogger = log.NoOpLogger
 
-// Init sets up the metrics required for autometrics' decorated functions and registers
-// them to the argument registry.
-//
-// If the passed registry is nil, all the metrics are registered to the
-// default global registry.
+// RetryPolicy decides how a failed push of metrics is retried.
 //
-// After initialization, use the returned [context.CancelCauseFunc] to flush the last
-// results and turn off metric collection for the remainder of the program's lifetime.
-// It is a good candidate to be deferred in the usual case.
-//
-// Make sure that all the latency targets you want to use for SLOs are
-// present in the histogramBuckets array, otherwise the alerts will fail
-// to work (they will never trigger.)
-func Init(initOpts ...InitOption) (context.CancelCauseFunc, error) {
-	newCtx, cancelFunc := context.WithCancelCause(context.Background())
-	amCtx = newCtx
-
-	initArgs := defaultInitArguments()
-	for _, initOpt := range initOpts {
-		if err := initOpt.Apply(&initArgs); err != nil {
-			return nil, fmt.Errorf("initialization argument: %w", err)
-		}
-	}
-
-	err := initArgs.Validate()
-	if err != nil {
-		return nil, fmt.Errorf("init options validation: %w", err)
-	}
-
-	autometrics.SetCommit(initArgs.commit)
-	autometrics.SetVersion(initArgs.version)
-	autometrics.SetBranch(initArgs.branch)
-	autometrics.SetLogger(initArgs.logger)
-
-	pusher = nil
-	if initArgs.HasPushEnabled() {
-		autometrics.GetLogger().Debug("Init: detected push configuration to %s", initArgs.pushCollectorURL)
-
-		if initArgs.pushCollectorURL == "" {
-			return nil, errors.New("invalid Push Configuration: the CollectorURL must be set.")
-		}
-		autometrics.SetPushJobURL(initArgs.pushCollectorURL)
-
-		autometrics.SetPushJobName(initArgs.pushJobName)
-
-		pusher = push.
-			New(autometrics.GetPushJobURL(), autometrics.GetPushJobName()).
-			Format(expfmt.FmtText)
-
-	}
-
-	if serviceName, ok := os.LookupEnv(autometrics.AutometricsServiceNameEnv); ok {
-		autometrics.SetService(serviceName)
-	} else if serviceName, ok := os.LookupEnv(autometrics.OTelServiceNameEnv); ok {
-		autometrics.SetService(serviceName)
-	} else {
-		autometrics.SetService(initArgs.service)
-	}
-
-	if repoURL, ok := os.LookupEnv(autometrics.AutometricsRepoURLEnv); ok {
-		autometrics.SetRepositoryURL(repoURL)
-	} else {
-		autometrics.SetRepositoryURL(initArgs.repoURL)
-	}
-	if repoProvider, ok := os.LookupEnv(autometrics.AutometricsRepoProviderEnv); ok {
-		autometrics.SetRepositoryURL(repoProvider)
-	} else {
-		autometrics.SetRepositoryURL(initArgs.repoProvider)
-	}
-
-	functionCallsCount = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: FunctionCallsCountName,
-	}, []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, ResultLabel, TargetSuccessRateLabel, SloNameLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel})
-
-	functionCallsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    FunctionCallsDurationName,
-		Buckets: initArgs.histogramBuckets,
-	}, []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, TargetLatencyLabel, TargetSuccessRateLabel, SloNameLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel})
-
-	functionCallsConcurrent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: FunctionCallsConcurrentName,
-	}, []string{FunctionLabel, ModuleLabel, CallerFunctionLabel, CallerModuleLabel, CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel})
-
-	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: BuildInfoName,
-	}, []string{CommitLabel, VersionLabel, BranchLabel, ServiceNameLabel, RepositoryURLLabel, RepositoryProviderLabel, AutometricsVersionLabel})
-
-	if initArgs.registry != nil {
-		initArgs.registry.MustRegister(functionCallsCount)
-		initArgs.registry.MustRegister(functionCallsDuration)
-		initArgs.registry.MustRegister(functionCallsConcurrent)
-		initArgs.registry.MustRegister(buildInfo)
-	} else {
-		prometheus.DefaultRegisterer.MustRegister(functionCallsCount)
-		prometheus.DefaultRegisterer.MustRegister(functionCallsDuration)
-		prometheus.DefaultRegisterer.MustRegister(functionCallsConcurrent)
-		prometheus.DefaultRegisterer.MustRegister(buildInfo)
-	}
-
-	buildInfo.With(prometheus.Labels{
-		CommitLabel:             autometrics.GetCommit(),
-		VersionLabel:            autometrics.GetVersion(),
-		BranchLabel:             autometrics.GetBranch(),
-		ServiceNameLabel:        autometrics.GetService(),
-		RepositoryURLLabel:      autometrics.GetRepositoryURL(),
-		RepositoryProviderLabel: autometrics.GetRepositoryProvider(),
-		AutometricsVersionLabel: AutometricsSpecVersion,
-	}).Set(1)
-
-	if pusher != nil {
-		pusherLock.Lock()
-		defer pusherLock.Unlock()
-
-		if err := pusher.
-			Collector(buildInfo).
-			AddContext(amCtx); err != nil {
-			return nil, fmt.Errorf("pushing metrics to gateway for initialization: %w", err)
-		}
-	}
+// This is a reexport to allow using only the current package at call site.
+type RetryPolicy = autometrics.RetryPolicy
 
-	return cancelFunc, nil
+// DefaultRetryPolicy returns the policy used when none is set with [WithPushRetry].
+func DefaultRetryPolicy() RetryPolicy {
+	return autometrics.DefaultRetryPolicy()
 }
 
-// ForceFlush forces a flush of the metrics, in the case autometrics is pushing metrics to a Prometheus Push Gateway.
-//
-// This function is a no-op if no push configuration has been setup in [Init], but will return an error if
-// autometrics is not active (because this function is called before [Init] or after its shutdown function
-// has been called).
-func ForceFlush() error {
-	if amCtx.Err() != nil {
-		return fmt.Errorf("autometrics is not currently active: %w", amCtx.Err())
-	}
-
-	if pusher != nil {
-		ctx, cancel := context.WithCancel(amCtx)
-		defer cancel()
-		if pusherLock.TryLock() {
-			defer pusherLock.Unlock()
-			localPusher := push.
-				New(autometrics.GetPushJobURL(), autometrics.GetPushJobName()).
-				Format(expfmt.FmtText).
-				Collector(functionCallsCount).
-				Collector(functionCallsDuration).
-				Collector(functionCallsConcurrent)
-			if err := localPusher.
-				AddContext(ctx); err != nil {
-				return fmt.Errorf("pushing metrics to gateway: %w", err)
-			}
-		}
-	}
-
-	return nil
+// NoRetry returns a policy that never retries failed pushes.
+func NoRetry() RetryPolicy {
+	return autometrics.NoRetry()
 }
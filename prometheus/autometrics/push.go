@@ -0,0 +1,132 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pusher pushes the metrics of an instance with its send function, periodically from a
+// single background goroutine, and a last time when the instance stops.
+type pusher struct {
+	// send pushes a new snapshot of the metrics, along with the snapshots waiting in the spool.
+	send func(context.Context) error
+	// cleanup is called after the last push, if it is set.
+	cleanup func() error
+	period  time.Duration
+	timeout time.Duration
+	logger  log.Logger
+
+	// lock serializes the pushes, so that the snapshots are taken and pushed in order.
+	lock sync.Mutex
+	// stopped is closed once the background pushes are over.
+	stopped chan struct{}
+
+	stopOnce sync.Once
+	stopErr  error
+}
+
+func newPusher(send func(context.Context) error, cleanup func() error, period, timeout time.Duration, logger log.Logger) *pusher {
+	return &pusher{
+		send:    send,
+		cleanup: cleanup,
+		period:  period,
+		timeout: timeout,
+		logger:  logger,
+		stopped: make(chan struct{}),
+	}
+}
+
+// run pushes the metrics right away and then every period until ctx is done.
+func (p *pusher) run(ctx context.Context) {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.period)
+	defer ticker.Stop()
+
+	for {
+		// The retries of a push stop when the next one is due.
+		pushCtx, cancel := context.WithTimeout(ctx, p.period)
+		if err := p.push(pushCtx); err != nil {
+			p.logger.Error("autometrics: %s", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push pushes the metrics now, waiting for the push in progress if any.
+func (p *pusher) push(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.send(ctx)
+}
+
+// stop waits for the background pushes to be over, once the context given to run is done, and
+// then pushes the metrics a last time with ctx before cleaning up.
+//
+// Only the first call pushes the metrics, the next ones return the same error.
+func (p *pusher) stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		select {
+		case <-p.stopped:
+		case <-ctx.Done():
+			p.stopErr = fmt.Errorf("waiting for the push in progress: %w", ctx.Err())
+			return
+		}
+
+		var errs []error
+		if err := p.push(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if p.cleanup != nil {
+			if err := p.cleanup(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		p.stopErr = errors.Join(errs...)
+	})
+
+	return p.stopErr
+}
+
+// gatewaySender returns the push function pushing the metrics of p to a Prometheus Push Gateway.
+//
+// Each push carries the current value of the metrics, so the spool only keeps the last push
+// that failed, and a new push replaces it without counting it as dropped.
+func gatewaySender(p *push.Pusher, retry am.RetryPolicy, timeout time.Duration) (func(context.Context) error, *am.PushQueue[struct{}]) {
+	queue := am.NewPushQueue(am.NewLatestSpool[struct{}](), retry, timeout, func(ctx context.Context, _ struct{}) error {
+		if err := p.AddContext(ctx); err != nil {
+			return fmt.Errorf("pushing metrics to gateway: %w", err)
+		}
+
+		return nil
+	})
+
+	return func(ctx context.Context) error {
+		return queue.Push(ctx, struct{}{})
+	}, queue
+}
+
+// gatewayDeleter returns the cleanup function deleting the group of metrics of p from the Push Gateway.
+func gatewayDeleter(p *push.Pusher) func() error {
+	return func() error {
+		if err := p.Delete(); err != nil {
+			return fmt.Errorf("deleting metrics group from gateway: %w", err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,236 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// pushGateway is a fake Prometheus Push Gateway that keeps the bodies of the pushes it receives.
+type pushGateway struct {
+	lock     sync.Mutex
+	bodies   []string
+	requests []*http.Request
+}
+
+func (g *pushGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.requests = append(g.requests, r)
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	g.bodies = append(g.bodies, string(body))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (g *pushGateway) pushes() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return append([]string{}, g.bodies...)
+}
+
+func TestPushOnlyFromBackgroundPusher(t *testing.T) {
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	a, err := New(WithRegistry(prometheus.NewRegistry()), WithPushCollectorURL(server.URL), WithPushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	assert.Eventually(t, func() bool { return len(gateway.pushes()) == 1 }, time.Second, time.Millisecond,
+		"The metrics must be pushed once at initialization.")
+
+	for i := 0; i < 100; i++ {
+		_ = instrumentedWith(context.Background(), a, i%2 == 0)
+	}
+	assert.Len(t, gateway.pushes(), 1, "Function calls must not push the metrics.")
+
+	assert.NoError(t, a.ForceFlush())
+	assert.Len(t, gateway.pushes(), 2)
+
+	a.Cancel(errors.New("test over"))
+	pushes := gateway.pushes()
+	if assert.Len(t, pushes, 3, "Cancel must push the metrics a last time.") {
+		assert.True(t, strings.Contains(pushes[2], FunctionCallsCountName))
+	}
+}
+
+func TestPushPeriodically(t *testing.T) {
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	a, err := New(WithRegistry(prometheus.NewRegistry()), WithPushCollectorURL(server.URL), WithPushPeriod(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	assert.Eventually(t, func() bool { return len(gateway.pushes()) >= 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestPushPeriodFromEnvironment(t *testing.T) {
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "10")
+
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	a, err := New(WithRegistry(prometheus.NewRegistry()), WithPushCollectorURL(server.URL), WithPushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	assert.Eventually(t, func() bool { return len(gateway.pushes()) >= 3 }, time.Second, 5*time.Millisecond)
+}
+
+// TestNoPushesDroppedWhileGatewayIsDown makes sure that the failed pushes to a gateway are not
+// counted as dropped, as the next push carries the current value of the metrics anyway.
+func TestNoPushesDroppedWhileGatewayIsDown(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	gateway := &pushGateway{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gateway.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	a, err := New(WithRegistry(registry), WithPushCollectorURL(server.URL), WithPushPeriod(time.Hour), WithPushRetry(NoRetry()))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	// The first flush waits for the initial push, and replaces it in the spool.
+	assert.Error(t, a.ForceFlush())
+	assert.Error(t, a.ForceFlush())
+
+	down.Store(false)
+	assert.NoError(t, a.ForceFlush())
+	assert.NotEmpty(t, gateway.pushes())
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+	dropped := -1.0
+	for _, family := range families {
+		if family.GetName() == PushesDroppedName {
+			dropped = family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	assert.Equal(t, 0.0, dropped)
+}
+
+func TestPushGroupingAndDeletion(t *testing.T) {
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	a, err := New(
+		WithRegistry(prometheus.NewRegistry()),
+		WithPushCollectorURL(server.URL),
+		WithPushJobName("worker"),
+		WithPushGrouping(map[string]string{"instance": "worker-1"}),
+		WithPushHeaders(map[string]string{"X-Scope-OrgID": "tenant"}),
+		WithPushBasicAuth("user", "secret"),
+		WithPushDeleteGroup(),
+		WithPushPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	a.Cancel(errors.New("test over"))
+
+	gateway.lock.Lock()
+	defer gateway.lock.Unlock()
+	// The initial push can be interrupted by the shutdown, but the last push cannot.
+	if assert.GreaterOrEqual(t, len(gateway.requests), 2) {
+		last := len(gateway.requests) - 1
+		assert.Equal(t, http.MethodPost, gateway.requests[last-1].Method, "The group must be pushed at shutdown.")
+		assert.Equal(t, http.MethodDelete, gateway.requests[last].Method, "The group must be deleted after the last push.")
+		for _, r := range gateway.requests {
+			assert.Equal(t, "/metrics/job/worker/instance/worker-1", r.URL.Path)
+			assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+			username, password, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "user", username)
+			assert.Equal(t, "secret", password)
+		}
+	}
+}
+
+func TestShutdownPushesLastTime(t *testing.T) {
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	a, err := New(WithRegistry(prometheus.NewRegistry()), WithPushCollectorURL(server.URL), WithPushDeleteGroup(), WithPushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	_ = instrumentedWith(context.Background(), a, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, a.Shutdown(ctx))
+
+	gateway.lock.Lock()
+	defer gateway.lock.Unlock()
+	if assert.GreaterOrEqual(t, len(gateway.requests), 2) {
+		last := len(gateway.requests) - 1
+		assert.Equal(t, http.MethodPost, gateway.requests[last-1].Method, "Shutdown must push the metrics a last time.")
+		assert.Equal(t, http.MethodDelete, gateway.requests[last].Method, "Shutdown must clean up after the last push.")
+		assert.True(t, strings.Contains(gateway.bodies[len(gateway.bodies)-1], FunctionCallsCountName))
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	a, err := New(WithRegistry(prometheus.NewRegistry()), WithPushCollectorURL(server.URL), WithPushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, a.Shutdown(ctx))
+	assert.Less(t, time.Since(start), time.Second, "Shutdown must give up on the last push at the deadline.")
+}
+
+func TestPushGroupingRejectsMetricLabels(t *testing.T) {
+	_, err := New(
+		WithRegistry(prometheus.NewRegistry()),
+		WithPushCollectorURL("http://localhost:9091"),
+		WithPushGrouping(map[string]string{ServiceNameLabel: "api"}),
+	)
+	assert.Error(t, err)
+}
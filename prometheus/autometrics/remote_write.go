@@ -0,0 +1,212 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// remoteWriteVersion is the version of the remote write protocol the writer follows.
+	// The specification can be found in https://prometheus.io/docs/concepts/remote_write_spec/
+	remoteWriteVersion = "0.1.0"
+
+	nameLabel     = "__name__"
+	bucketLabel   = "le"
+	quantileLabel = "quantile"
+)
+
+// remoteWriter writes the metrics of a gatherer to a Prometheus remote write endpoint.
+type remoteWriter struct {
+	client   *http.Client
+	url      string
+	headers  map[string]string
+	username string
+	password string
+	jobName  string
+	gatherer prometheus.Gatherer
+}
+
+// snapshot gathers the metrics and encodes them as the body of a remote write request.
+func (w *remoteWriter) snapshot() ([]byte, error) {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("gathering metrics for remote write: %w", err)
+	}
+
+	return snappy.Encode(nil, encodeWriteRequest(families, w.jobName, time.Now().UnixMilli())), nil
+}
+
+// write writes a snapshot to the endpoint.
+//
+// The snapshots rejected by the endpoint are reported as permanent errors, as the remote write
+// specification forbids to retry them.
+func (w *remoteWriter) write(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating remote write request: %w", err)
+	}
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("writing metrics to remote write endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("writing metrics to remote write endpoint: unexpected status %s: %s", resp.Status, bytes.TrimSpace(message))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return am.Permanent(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+// encodeWriteRequest encodes the metric families as the protobuf of a remote write WriteRequest,
+// with one sample per series at the given timestamp (in milliseconds) unless the metric has its own.
+func encodeWriteRequest(families []*dto.MetricFamily, jobName string, timestamp int64) []byte {
+	var request []byte
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make([]label, 0, len(metric.GetLabel())+3)
+			if jobName != "" {
+				labels = append(labels, label{JobLabel, jobName})
+			}
+			for _, pair := range metric.GetLabel() {
+				// The job name replaces the job label of the metric, as the series would
+				// have the label twice otherwise.
+				if jobName != "" && pair.GetName() == JobLabel {
+					continue
+				}
+				labels = append(labels, label{pair.GetName(), pair.GetValue()})
+			}
+
+			sampleTimestamp := timestamp
+			if metric.TimestampMs != nil {
+				sampleTimestamp = metric.GetTimestampMs()
+			}
+
+			appendSeries := func(name string, value float64, extra ...label) {
+				request = appendTimeSeries(request, name, labels, extra, value, sampleTimestamp)
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				appendSeries(family.GetName(), metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				appendSeries(family.GetName(), metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				appendSeries(family.GetName(), metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				hasInf := false
+				for _, bucket := range histogram.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), +1) {
+						hasInf = true
+					}
+					appendSeries(family.GetName()+"_bucket", float64(bucket.GetCumulativeCount()),
+						label{bucketLabel, formatFloat(bucket.GetUpperBound())})
+				}
+				if !hasInf {
+					appendSeries(family.GetName()+"_bucket", float64(histogram.GetSampleCount()),
+						label{bucketLabel, formatFloat(math.Inf(+1))})
+				}
+				appendSeries(family.GetName()+"_sum", histogram.GetSampleSum())
+				appendSeries(family.GetName()+"_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					appendSeries(family.GetName(), quantile.GetValue(),
+						label{quantileLabel, formatFloat(quantile.GetQuantile())})
+				}
+				appendSeries(family.GetName()+"_sum", summary.GetSampleSum())
+				appendSeries(family.GetName()+"_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+
+	return request
+}
+
+// appendTimeSeries appends a TimeSeries with a single sample, as field 1 of a WriteRequest.
+//
+// The labels with an empty value are left out, as they are in Prometheus, and the other labels
+// are sorted by name as the remote write specification requires.
+func appendTimeSeries(request []byte, name string, labels, extraLabels []label, value float64, timestamp int64) []byte {
+	all := make([]label, 0, len(labels)+len(extraLabels)+1)
+	all = append(all, label{nameLabel, name})
+	for _, group := range [][]label{labels, extraLabels} {
+		for _, l := range group {
+			if l.value != "" {
+				all = append(all, l)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	var series []byte
+	for _, l := range all {
+		var encodedLabel []byte
+		encodedLabel = protowire.AppendTag(encodedLabel, 1, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, l.name)
+		encodedLabel = protowire.AppendTag(encodedLabel, 2, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, l.value)
+
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, encodedLabel)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	return protowire.AppendBytes(request, series)
+}
+
+// formatFloat formats the bounds of buckets and quantiles like the Prometheus exposition format.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
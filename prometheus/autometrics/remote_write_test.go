@@ -0,0 +1,219 @@
+package autometrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// remoteWriteReceiver is a fake remote write endpoint that decodes the series it receives.
+type remoteWriteReceiver struct {
+	t *testing.T
+
+	lock     sync.Mutex
+	requests []*http.Request
+	// series holds the last value received for each series, keyed by its sorted labels.
+	series map[string]float64
+}
+
+func (rw *remoteWriteReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	compressed, err := io.ReadAll(r.Body)
+	if err != nil {
+		rw.t.Errorf("reading the request: %s", err)
+		return
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		rw.t.Errorf("decompressing the request: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	rw.requests = append(rw.requests, r)
+	forEachField(rw.t, body, func(_ protowire.Number, timeSeries []byte) {
+		var labels []string
+		var value float64
+		forEachField(rw.t, timeSeries, func(num protowire.Number, field []byte) {
+			switch num {
+			case 1:
+				var name, labelValue string
+				forEachField(rw.t, field, func(num protowire.Number, part []byte) {
+					if num == 1 {
+						name = string(part)
+					} else {
+						labelValue = string(part)
+					}
+				})
+				labels = append(labels, name+"="+labelValue)
+			case 2:
+				num, typ, n := protowire.ConsumeTag(field)
+				assert.Equal(rw.t, protowire.Number(1), num)
+				assert.Equal(rw.t, protowire.Fixed64Type, typ)
+				bits, _ := protowire.ConsumeFixed64(field[n:])
+				value = math.Float64frombits(bits)
+			}
+		})
+		assert.True(rw.t, sort.StringsAreSorted(labels), "The labels must be sorted: %v", labels)
+		rw.series[strings.Join(labels, ",")] = value
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forEachField calls fn with the content of each length-delimited field of the message.
+func forEachField(t *testing.T, message []byte, fn func(protowire.Number, []byte)) {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			t.Fatalf("decoding a tag: %s", protowire.ParseError(n))
+		}
+		message = message[n:]
+		if typ != protowire.BytesType {
+			t.Fatalf("unexpected type %d for field %d", typ, num)
+		}
+		field, n := protowire.ConsumeBytes(message)
+		if n < 0 {
+			t.Fatalf("decoding field %d: %s", num, protowire.ParseError(n))
+		}
+		message = message[n:]
+		fn(num, field)
+	}
+}
+
+// seriesWithPrefix returns the received values of the series whose labels start with prefix.
+func (rw *remoteWriteReceiver) seriesWithPrefix(prefix string) map[string]float64 {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	series := make(map[string]float64)
+	for labels, value := range rw.series {
+		if strings.HasPrefix(labels, prefix) {
+			series[labels] = value
+		}
+	}
+	return series
+}
+
+func TestRemoteWrite(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t, series: make(map[string]float64)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	a, err := New(
+		WithRegistry(prometheus.NewRegistry()),
+		WithVersion("1.0.0"),
+		WithRemoteWriteURL(server.URL+"/api/v1/write"),
+		WithPushHeaders(map[string]string{"X-Scope-OrgID": "tenant"}),
+		WithPushBasicAuth("user", "secret"),
+		WithPushJobName("worker"),
+		WithPushPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_ = instrumentedWith(context.Background(), a, i == 0)
+	}
+	assert.NoError(t, a.ForceFlush())
+	a.Cancel(errors.New("test over"))
+
+	receiver.lock.Lock()
+	if assert.Len(t, receiver.requests, 3, "The metrics must be written at initialization, when flushed and at shutdown.") {
+		r := receiver.requests[2]
+		assert.Equal(t, "/api/v1/write", r.URL.Path)
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "secret", password)
+	}
+	receiver.lock.Unlock()
+
+	calls := receiver.seriesWithPrefix("__name__=" + FunctionCallsCountName + ",")
+	if assert.Len(t, calls, 2) {
+		for labels, value := range calls {
+			assert.Contains(t, labels, "job=worker")
+			assert.Contains(t, labels, "version=1.0.0")
+			assert.Contains(t, labels, "function=instrumentedWith")
+			if strings.Contains(labels, "result=error") {
+				assert.Equal(t, 1.0, value)
+			} else {
+				assert.Equal(t, 2.0, value)
+			}
+		}
+	}
+
+	infBuckets := receiver.seriesWithPrefix("__name__=" + FunctionCallsDurationName + "_bucket,")
+	found := false
+	for labels, value := range infBuckets {
+		if strings.Contains(labels, "le=+Inf") {
+			found = true
+			assert.Equal(t, 3.0, value)
+		}
+	}
+	assert.True(t, found, "The histogram must have a +Inf bucket.")
+	assert.Len(t, receiver.seriesWithPrefix("__name__="+FunctionCallsDurationName+"_count,"), 1)
+	assert.Len(t, receiver.seriesWithPrefix("__name__="+BuildInfoName+","), 1)
+}
+
+// TestRemoteWriteJobLabel makes sure that the job name replaces the job label of the metrics.
+func TestRemoteWriteJobLabel(t *testing.T) {
+	family := &dto.MetricFamily{
+		Name: proto.String("queue_size"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{
+				{Name: proto.String(JobLabel), Value: proto.String("scraped")},
+				{Name: proto.String("queue"), Value: proto.String("emails")},
+			},
+			Gauge: &dto.Gauge{Value: proto.Float64(4)},
+		}},
+	}
+
+	for name, test := range map[string]struct {
+		jobName string
+		series  string
+	}{
+		"job name":    {jobName: "worker", series: "__name__=queue_size,job=worker,queue=emails"},
+		"no job name": {series: "__name__=queue_size,job=scraped,queue=emails"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			receiver := &remoteWriteReceiver{t: t, series: make(map[string]float64)}
+			body := snappy.Encode(nil, encodeWriteRequest([]*dto.MetricFamily{family}, test.jobName, 0))
+			receiver.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)))
+
+			assert.Equal(t, map[string]float64{test.series: 4}, receiver.series)
+		})
+	}
+}
+
+func TestRemoteWriteExclusiveWithPushGateway(t *testing.T) {
+	_, err := New(
+		WithRegistry(prometheus.NewRegistry()),
+		WithPushCollectorURL("http://localhost:9091"),
+		WithRemoteWriteURL("http://localhost:9090/api/v1/write"),
+	)
+	assert.Error(t, err)
+}
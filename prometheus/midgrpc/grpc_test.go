@@ -0,0 +1,225 @@
+package midgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+type healthServer struct {
+	*health.Server
+	tid am.TraceID
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.tid, _ = am.GetTraceID(ctx)
+	return s.Server.Check(ctx, req)
+}
+
+// uploadDesc describes a client-streaming RPC, where the server answers the requests it received
+// with a single response once the client closes the stream.
+var uploadDesc = grpc.StreamDesc{
+	StreamName:    "Upload",
+	ClientStreams: true,
+	Handler: func(_ any, stream grpc.ServerStream) error {
+		for {
+			err := stream.RecvMsg(&healthpb.HealthCheckRequest{})
+			if errors.Is(err, io.EOF) {
+				return stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	},
+}
+
+const uploadMethod = "/autometrics.test.Uploader/Upload"
+
+func startServer(t *testing.T, serverOpts ...grpc.ServerOption) (*grpc.ClientConn, *healthServer) {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(serverOpts...)
+	healthSrv := &healthServer{Server: health.NewServer()}
+	healthSrv.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthSrv)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "autometrics.test.Uploader",
+		HandlerType: (*any)(nil),
+		Streams:     []grpc.StreamDesc{uploadDesc},
+	}, struct{}{})
+
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatalf("dialing the test server: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, healthSrv
+}
+
+func initRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	if _, err := prom.Init(prom.WithRegistry(registry)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+
+	return registry
+}
+
+// callsByResult returns the number of recorded RPCs of the health service, by result.
+func callsByResult(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	return callsOf(t, registry, prom.FunctionCallsCountName, "/grpc.health.v1.Health/")
+}
+
+// callsOf returns the values of the metric for the RPCs whose method starts with prefix, by result.
+func callsOf(t *testing.T, registry *prometheus.Registry, name, prefix string) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+
+	calls := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[prom.ModuleLabel] == "google.golang.org/grpc" && strings.HasPrefix(labels[prom.FunctionLabel], prefix) {
+				calls[labels[prom.ResultLabel]] += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	return calls
+}
+
+// TestUnaryInterceptors makes sure that both sides of a unary RPC are recorded with the
+// full method name, that the status codes are mapped to results, and that the trace
+// is propagated in the metadata.
+func TestUnaryInterceptors(t *testing.T) {
+	registry := initRegistry(t)
+	conn, healthSrv := startServer(t,
+		grpc.UnaryInterceptor(UnaryServerInterceptor(WithValidCodes(codes.OK, codes.NotFound))),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	tid := am.TraceID{0x4b, 0xf9, 0x2f, 0x35}
+	ctx := prom.NewContext(context.Background(), prom.WithTraceID(tid[:]))
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "serving"})
+	assert.NoError(t, err)
+	assert.Equal(t, tid, healthSrv.tid, "the trace ID should be propagated to the server")
+
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	calls := callsByResult(t, registry)
+	assert.Equal(t, map[string]float64{"ok": 3, "error": 1}, calls, "the not found error is only valid on the server side")
+}
+
+// TestIncomingTraceparent makes sure that the server reads the trace from the
+// traceparent metadata of the incoming RPC.
+func TestIncomingTraceparent(t *testing.T) {
+	_ = initRegistry(t)
+	conn, healthSrv := startServer(t, grpc.UnaryInterceptor(UnaryServerInterceptor()))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "serving"})
+	assert.NoError(t, err)
+	assert.Equal(t, am.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}, healthSrv.tid)
+}
+
+// TestStreamInterceptors makes sure that streaming RPCs are recorded once they end.
+func TestStreamInterceptors(t *testing.T) {
+	registry := initRegistry(t)
+	conn, _ := startServer(t, grpc.StreamInterceptor(StreamServerInterceptor()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: "serving"})
+	if err != nil {
+		t.Fatalf("starting the watch stream: %s", err)
+	}
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	cancel()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	assert.Eventually(t, func() bool {
+		calls := callsByResult(t, registry)
+		return calls["ok"]+calls["error"] == 2
+	}, time.Second, 10*time.Millisecond, "both sides of the stream should be recorded")
+}
+
+// TestClientStreamInterceptor makes sure that client-streaming RPCs are recorded when
+// their single response is received.
+func TestClientStreamInterceptor(t *testing.T) {
+	registry := initRegistry(t)
+	conn, _ := startServer(t)
+
+	stream, err := conn.NewStream(context.Background(), &uploadDesc, uploadMethod)
+	if err != nil {
+		t.Fatalf("starting the upload stream: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: "serving"}))
+	}
+	// This is what the generated CloseAndRecv methods do.
+	assert.NoError(t, stream.CloseSend())
+	assert.NoError(t, stream.RecvMsg(&healthpb.HealthCheckResponse{}))
+
+	assert.Equal(t, map[string]float64{"ok": 1}, callsOf(t, registry, prom.FunctionCallsCountName, uploadMethod))
+	assert.Equal(t, map[string]float64{"": 0}, callsOf(t, registry, prom.FunctionCallsConcurrentName, uploadMethod),
+		"the RPC should not be running anymore")
+}
+
+// TestValidCodesWithoutOK makes sure that successful RPCs are errors when OK is not a valid code.
+func TestValidCodesWithoutOK(t *testing.T) {
+	registry := initRegistry(t)
+	conn, _ := startServer(t, grpc.UnaryInterceptor(UnaryServerInterceptor(WithValidCodes(codes.NotFound))))
+
+	_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "serving"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]float64{"ok": 1, "error": 1}, callsByResult(t, registry), "only the server side should report an error")
+}
@@ -0,0 +1,71 @@
+package midhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/autometricstest"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// getUser is an instrumented function calling the server through an instrumented transport.
+func getUser(ctx context.Context, url string) (err error) {
+	amCtx := prom.PreInstrument(prom.NewContext(ctx))
+	defer prom.Instrument(amCtx, &err)
+
+	req, err := http.NewRequestWithContext(mid.SetRouteTemplate(amCtx, "/users/{id}"), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// TestTransport makes sure that the outgoing requests are recorded as calls of the
+// instrumented function that made them, and propagate their trace to the server.
+func TestTransport(t *testing.T) {
+	recorder := autometricstest.NewRecorder()
+	if _, err := prom.Init(prom.WithRegistry(prometheus.NewRegistry()), prom.WithRecorders(recorder)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+	defer func() { _ = prom.Shutdown(context.Background()) }()
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(mid.TraceparentHeader)
+		if r.URL.Path == "/users/0" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, getUser(context.Background(), server.URL+"/users/42"))
+	tid, sid, _, ok := mid.ParseTraceparent(traceparent)
+	assert.True(t, ok, "the request should have a traceparent header: %q", traceparent)
+	assert.NoError(t, getUser(context.Background(), server.URL+"/users/0"))
+
+	function := autometricstest.Function(server.Listener.Addr().String() + "/users/{id}")
+	transport := autometricstest.Module(mid.TransportModule)
+	caller := autometricstest.Caller("getUser")
+	assert.Equal(t, 1, recorder.Count(function, transport, caller, autometricstest.Result(am.ResultOk)))
+	assert.Equal(t, 1, recorder.Count(function, transport, caller, autometricstest.Result(am.ResultError)),
+		"a not found response should be an error")
+
+	calls := recorder.Calls(function, transport)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, calls[0].TraceID, tid, "the server should continue the trace of the request")
+		assert.Equal(t, calls[0].SpanID, sid, "the server should be a child of the request")
+	}
+}
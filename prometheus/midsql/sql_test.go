@@ -0,0 +1,231 @@
+package midsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	prom "github.com/autometrics-dev/autometrics-go/prometheus/autometrics"
+)
+
+var errFake = errors.New("fake failure")
+
+// fakeDriver is an in-memory driver where the "fail" queries return an error, and where the
+// connections skip the "skip" queries, like drivers that only run queries with arguments as
+// prepared statements.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case "fail":
+		return nil, errFake
+	case "skip":
+		return nil, driver.ErrSkip
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	switch query {
+	case "fail":
+		return nil, errFake
+	case "skip":
+		return nil, driver.ErrSkip
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "skip" {
+		return driver.RowsAffected(1), nil
+	}
+	return fakeConn{}.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.query == "skip" {
+		return &fakeRows{}, nil
+	}
+	return fakeConn{}.QueryContext(context.Background(), s.query, nil)
+}
+
+// fakeConnector is a connector of fakeDriver connections, that must be closed.
+type fakeConnector struct{ closed bool }
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+func (c *fakeConnector) Close() error                                 { c.closed = true; return nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Columns() []string { return []string{"id"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+func init() {
+	Register("autometrics-fake", fakeDriver{})
+}
+
+// callsByFunction returns the recorded database calls, by function and result.
+func callsByFunction(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering the metrics: %s", err)
+	}
+
+	calls := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != prom.FunctionCallsCountName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[prom.ModuleLabel] == "database/sql" {
+				key := labels[prom.FunctionLabel] + "/" + labels[prom.ResultLabel] + "/" + labels[prom.CallerFunctionLabel]
+				calls[key] += metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return calls
+}
+
+func getUser(ctx context.Context, db *sql.DB) (err error) {
+	amCtx := prom.PreInstrument(prom.NewContext(ctx))
+	defer prom.Instrument(amCtx, &err)
+
+	var id int64
+	return db.QueryRowContext(WithQueryName(amCtx, "get_user"), "SELECT id FROM users").Scan(&id)
+}
+
+// TestDriverWrapper makes sure that every database call is recorded with its query
+// name, and the instrumented function that made it as caller.
+func TestDriverWrapper(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := prom.Init(prom.WithRegistry(registry)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+
+	db, err := sql.Open("autometrics-fake", "")
+	if err != nil {
+		t.Fatalf("opening the database: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	assert.NoError(t, getUser(ctx, db))
+
+	_, err = db.ExecContext(WithQueryName(ctx, "delete_user"), "DELETE FROM users")
+	assert.NoError(t, err)
+	_, err = db.ExecContext(ctx, "fail")
+	assert.ErrorIs(t, err, errFake)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if assert.NoError(t, err) {
+		_, err = tx.ExecContext(WithQueryName(ctx, "update_user"), "UPDATE users")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+	}
+
+	stmt, err := db.PrepareContext(ctx, "SELECT id FROM users")
+	if assert.NoError(t, err) {
+		rows, err := stmt.QueryContext(WithQueryName(ctx, "list_users"))
+		if assert.NoError(t, err) {
+			rows.Close()
+		}
+		stmt.Close()
+	}
+
+	calls := callsByFunction(t, registry)
+	assert.Equal(t, 1.0, calls["get_user/ok/getUser"], "the caller should be the instrumented function, got %v", calls)
+
+	for _, expected := range []string{"delete_user/ok", "Exec/error", "Begin/ok", "update_user/ok", "Commit/ok", "list_users/ok"} {
+		found := false
+		for key := range calls {
+			found = found || strings.HasPrefix(key, expected+"/")
+		}
+		assert.True(t, found, "%s should be recorded, got %v", expected, calls)
+	}
+}
+
+// TestSkippedQueries makes sure that the queries skipped by the connection, and run again
+// by database/sql with a prepared statement, are recorded once.
+func TestSkippedQueries(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := prom.Init(prom.WithRegistry(registry)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+
+	db, err := sql.Open("autometrics-fake", "")
+	if err != nil {
+		t.Fatalf("opening the database: %s", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	_, err = db.ExecContext(WithQueryName(ctx, "skipped_exec"), "skip")
+	assert.NoError(t, err)
+	rows, err := db.QueryContext(WithQueryName(ctx, "skipped_query"), "skip")
+	if assert.NoError(t, err) {
+		rows.Close()
+	}
+
+	calls := callsByFunction(t, registry)
+	for _, function := range []string{"skipped_exec", "skipped_query"} {
+		count := 0.0
+		for key, value := range calls {
+			if strings.HasPrefix(key, function+"/") {
+				assert.True(t, strings.HasPrefix(key, function+"/ok/"), "%s should succeed, got %v", function, calls)
+				count += value
+			}
+		}
+		assert.Equal(t, 1.0, count, "%s should be recorded once, got %v", function, calls)
+	}
+}
+
+func TestConnectorClose(t *testing.T) {
+	connector := &fakeConnector{}
+	db := sql.OpenDB(WrapConnector(connector))
+
+	assert.NoError(t, db.Close())
+	assert.True(t, connector.closed, "closing the database should close the wrapped connector")
+}
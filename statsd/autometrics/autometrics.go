@@ -0,0 +1,275 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+)
+
+// errNotInitialized is the cause of the inactivity of the default instance before [Init] is called.
+var errNotInitialized = errors.New("autometrics: Init has not been called")
+
+// errShutdown is the cause of the inactivity of an instance after [Autometrics.Shutdown] is called.
+var errShutdown = errors.New("autometrics: Shutdown has been called")
+
+// defaultInstance is the instance used by the package-level functions, set by [Init].
+var defaultInstance atomic.Pointer[Autometrics]
+
+func init() {
+	inactiveCtx, cancel := context.WithCancelCause(context.Background())
+	cancel(errNotInitialized)
+	defaultInstance.Store(&Autometrics{ctx: inactiveCtx, cancel: cancel, config: am.DefaultConfig()})
+}
+
+// Autometrics is an instance of autometrics, with its own configuration and connection
+// to a statsd agent.
+//
+// The package-level functions (like [PreInstrument] and [Instrument]) use the instance
+// created by [Init].
+type Autometrics struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	config *am.Config
+
+	client        *client
+	buildInfoLine string
+	// stopped is closed once the buffered metrics have been sent and the client closed, with
+	// the error in closeErr.
+	stopped  chan struct{}
+	closeErr error
+
+	// concurrentCalls counts the running calls for each set of tags of the concurrent calls
+	// gauge, as statsd gauges can only be set to absolute values with DogStatsD.
+	concurrentCalls     map[string]int64
+	concurrentCallsLock sync.Mutex
+}
+
+// New creates an instance of autometrics, sending its metrics to the statsd agent of the options.
+//
+// The metrics are buffered, and sent to the agent periodically, when the buffer is full, and
+// when the instance is cancelled.
+//
+// Unlike [Init], New does not change the instance used by the package-level functions, so
+// the functions to instrument must use the methods of the returned instance instead.
+func New(initOpts ...InitOption) (*Autometrics, error) {
+	initArgs := defaultInitArguments()
+	for _, initOpt := range initOpts {
+		if err := initOpt.Apply(&initArgs); err != nil {
+			return nil, fmt.Errorf("initialization argument: %w", err)
+		}
+	}
+
+	err := initArgs.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("init options validation: %w", err)
+	}
+
+	client, err := newClient(initArgs.address, initArgs.maxPacketSize)
+	if err != nil {
+		return nil, err
+	}
+
+	newCtx, cancelFunc := context.WithCancelCause(context.Background())
+	a := &Autometrics{
+		ctx:    newCtx,
+		cancel: cancelFunc,
+		config: &am.Config{
+			Version:          initArgs.version,
+			Commit:           initArgs.commit,
+			Branch:           initArgs.branch,
+			Logger:           initArgs.logger,
+			ResultClassifier: initArgs.resultClassifier,
+			ExtraResults:     initArgs.extraResults,
+			ErrorKinds:       initArgs.errorKinds,
+			TraceIDExtractor: initArgs.traceIDExtractor,
+			Recorders:        initArgs.recorders,
+		},
+		client:          client,
+		stopped:         make(chan struct{}),
+		concurrentCalls: make(map[string]int64),
+	}
+	if initArgs.tracerProvider != nil {
+		a.config.Tracer = initArgs.tracerProvider.Tracer("autometrics")
+	}
+
+	if serviceName, ok := os.LookupEnv(am.AutometricsServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else if serviceName, ok := os.LookupEnv(am.OTelServiceNameEnv); ok {
+		a.config.Service = serviceName
+	} else {
+		a.config.Service = initArgs.service
+	}
+
+	if repoURL, ok := os.LookupEnv(am.AutometricsRepoURLEnv); ok {
+		a.config.RepositoryURL = repoURL
+	} else {
+		a.config.RepositoryURL = initArgs.repoURL
+	}
+	if repoProvider, ok := os.LookupEnv(am.AutometricsRepoProviderEnv); ok {
+		a.config.RepositoryProvider = repoProvider
+	} else {
+		a.config.RepositoryProvider = initArgs.repoProvider
+	}
+
+	a.buildInfoLine = formatMetric(BuildInfoName, 1, gaugeType, formatTags(map[string]string{
+		CommitLabel:             a.config.Commit,
+		VersionLabel:            a.config.Version,
+		BranchLabel:             a.config.Branch,
+		ServiceNameLabel:        a.config.Service,
+		RepositoryURLLabel:      a.config.RepositoryURL,
+		RepositoryProviderLabel: a.config.RepositoryProvider,
+		AutometricsVersionLabel: AutometricsSpecVersion,
+	}))
+	a.send(a.buildInfoLine)
+
+	go a.flushPeriodically(initArgs.flushPeriod)
+
+	return a, nil
+}
+
+// Init sets up the connection to the statsd agent for autometrics' decorated functions.
+//
+// The created instance is used by the package-level functions (like [PreInstrument] and
+// [Instrument]), and its configuration becomes the default configuration of autometrics.
+//
+// After initialization, use the returned [context.CancelCauseFunc] to flush the last
+// results and turn off metric collection for the remainder of the program's lifetime.
+// It is a good candidate to be deferred in the usual case. To wait until the last metrics
+// have been sent to the agent, use [Shutdown] instead.
+func Init(initOpts ...InitOption) (context.CancelCauseFunc, error) {
+	a, err := New(initOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	am.SetDefaultConfig(a.config)
+	defaultInstance.Store(a)
+
+	return a.Cancel, nil
+}
+
+// Default returns the instance used by the package-level functions.
+//
+// Before [Init] is called, the default instance is inactive and does not record anything.
+func Default() *Autometrics {
+	return defaultInstance.Load()
+}
+
+// Config returns the configuration of the instance.
+func (a *Autometrics) Config() *am.Config {
+	return a.config
+}
+
+// Cancel turns off metric collection for the instance, for the remainder of the program's lifetime.
+//
+// It is the equivalent of the function returned by [Init]. The buffered metrics are sent to
+// the agent in the background.
+func (a *Autometrics) Cancel(cause error) {
+	a.cancel(cause)
+}
+
+// Shutdown turns off metric collection for the instance used by the package-level functions,
+// and releases its resources, so that [Init] can be called again.
+//
+// See [Autometrics.Shutdown] for the details.
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
+
+// Shutdown turns off metric collection for the instance, and waits until the buffered metrics
+// have been sent to the agent and the connection closed.
+//
+// Shutdown stops waiting when ctx is done, and returns its error. Calling Shutdown more than
+// once, or after [Autometrics.Cancel], is safe.
+func (a *Autometrics) Shutdown(ctx context.Context) error {
+	a.cancel(errShutdown)
+
+	if a.stopped == nil {
+		// The default instance is inactive before Init, and has nothing to send.
+		return nil
+	}
+
+	select {
+	case <-a.stopped:
+		return a.closeErr
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the metrics to be sent: %w", ctx.Err())
+	}
+}
+
+// ForceFlush sends the buffered metrics to the statsd agent.
+//
+// It returns an error if autometrics is not active (because this function is called before
+// [Init] or after its shutdown function has been called).
+func ForceFlush() error {
+	return Default().ForceFlush()
+}
+
+// ForceFlush sends the buffered metrics of the instance to the statsd agent.
+//
+// It returns an error if the instance is not active (because [Autometrics.Cancel] or
+// [Autometrics.Shutdown] has been called).
+func (a *Autometrics) ForceFlush() error {
+	if a.ctx.Err() != nil {
+		return fmt.Errorf("autometrics is not currently active: %w", context.Cause(a.ctx))
+	}
+
+	return a.client.flush()
+}
+
+// Middleware wraps a handler to record each request as a function call with the instance.
+//
+// See the midhttp package for the options.
+func (a *Autometrics) Middleware(next http.HandlerFunc, opts ...am.Option) http.HandlerFunc {
+	return mid.Middleware(a.instrumenter(), next, opts...)
+}
+
+// Transport wraps a RoundTripper to record each outgoing request as a function call with the instance.
+//
+// A nil base uses [http.DefaultTransport]. See the midhttp package for the options.
+func (a *Autometrics) Transport(base http.RoundTripper, opts ...am.Option) http.RoundTripper {
+	return mid.Transport(a.instrumenter(), base, opts...)
+}
+
+func (a *Autometrics) instrumenter() mid.Instrumenter {
+	return mid.Instrumenter{PreInstrument: a.PreInstrument, Instrument: a.Instrument}
+}
+
+// flushPeriodically sends the buffered metrics to the agent every period, along with the
+// build information so that it is always present, until the instance is cancelled.
+func (a *Autometrics) flushPeriodically(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			a.closeErr = a.client.close()
+			if a.closeErr != nil {
+				a.config.GetLogger().Error("autometrics: %s", a.closeErr)
+			}
+			close(a.stopped)
+			return
+		case <-ticker.C:
+			a.send(a.buildInfoLine)
+			if err := a.client.flush(); err != nil {
+				a.config.GetLogger().Error("autometrics: %s", err)
+			}
+		}
+	}
+}
+
+// send buffers a line for the agent, logging the errors of the packets sent to make room for it.
+func (a *Autometrics) send(line string) {
+	if err := a.client.send(line); err != nil {
+		a.config.GetLogger().Error("autometrics: %s", err)
+	}
+}
@@ -0,0 +1,287 @@
+package autometrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// listen starts a local UDP listener playing the role of the statsd agent.
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for statsd packets: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// receive returns the packets received by the listener until none arrives for a while.
+func receive(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func instrumentedWith(ctx context.Context, a *Autometrics, fail bool) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	if fail {
+		return errors.New("failure")
+	}
+
+	return nil
+}
+
+func TestSendMetrics(t *testing.T) {
+	agent := listen(t)
+	a, err := New(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour), WithVersion("1.0.0"))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	_ = instrumentedWith(context.Background(), a, true)
+	assert.NoError(t, a.ForceFlush())
+
+	packets := receive(t, agent)
+	if !assert.Len(t, packets, 1, "the metrics should be buffered until the flush") {
+		return
+	}
+	lines := strings.Split(packets[0], "\n")
+	if !assert.Len(t, lines, 5) {
+		return
+	}
+
+	const module = "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+	callTags := "caller_function:TestSendMetrics,caller_module:" + module + ",commit:,function:instrumentedWith,module:" + module
+	assert.Equal(t,
+		"build_info:1|g|#autometrics_version:1.0.0,branch:,commit:,repository_provider:,repository_url:,service_name:,version:1.0.0",
+		lines[0])
+	assert.Equal(t,
+		"function.calls.concurrent:1|g|#branch:,"+callTags+",service_name:,version:1.0.0",
+		lines[1])
+	assert.Equal(t,
+		"function.calls:1|c|#branch:,"+callTags+",objective_name:,objective_percentile:,result:error,service_name:,version:1.0.0",
+		lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], "function.calls.duration:"), lines[3])
+	assert.True(t, strings.HasSuffix(lines[3],
+		"|ms|#branch:,"+callTags+",objective_latency_threshold:,objective_name:,objective_percentile:,service_name:,version:1.0.0"), lines[3])
+	assert.Equal(t,
+		"function.calls.concurrent:0|g|#branch:,"+callTags+",service_name:,version:1.0.0",
+		lines[4])
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	agent := listen(t)
+	a, err := New(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour), WithMaxPacketSize(600))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		_ = instrumentedWith(context.Background(), a, false)
+	}
+	a.Cancel(nil)
+
+	packets := receive(t, agent)
+	assert.Greater(t, len(packets), 1, "the buffer should be sent when it is full")
+	calls := 0
+	for _, packet := range packets {
+		assert.LessOrEqual(t, len(packet), 600)
+		calls += strings.Count(packet, "function.calls:1|c|")
+	}
+	assert.Equal(t, 10, calls, "all the calls should be sent, the last ones when the instance is cancelled")
+	assert.Error(t, a.ForceFlush())
+}
+
+func TestShutdown(t *testing.T) {
+	agent := listen(t)
+	a, err := New(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	_ = instrumentedWith(context.Background(), a, false)
+	assert.NoError(t, a.Shutdown(context.Background()))
+	assert.NoError(t, a.Shutdown(context.Background()), "Shutdown should be idempotent")
+
+	packets := receive(t, agent)
+	if assert.Len(t, packets, 1, "the buffered metrics should be sent before Shutdown returns") {
+		assert.Contains(t, packets[0], "function.calls:1|c|")
+	}
+	assert.Error(t, a.ForceFlush())
+}
+
+// TestConcurrentCalls makes sure that the values of the concurrent calls gauge are sent in the
+// order they are computed when calls run in parallel, so that the agent keeps the last value.
+func TestConcurrentCalls(t *testing.T) {
+	agent := listen(t)
+	a, err := New(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+
+	// The packets are read while they are sent, so that the listener does not drop them.
+	packets := make(chan []string)
+	go func() { packets <- receive(t, agent) }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = instrumentedWith(context.Background(), a, false)
+				assert.NoError(t, a.ForceFlush())
+			}
+		}()
+	}
+	wg.Wait()
+	a.Cancel(nil)
+
+	var running []int
+	for _, packet := range <-packets {
+		for _, line := range strings.Split(packet, "\n") {
+			if value, ok := strings.CutPrefix(line, "function.calls.concurrent:"); ok {
+				count, err := strconv.Atoi(value[:strings.IndexByte(value, '|')])
+				if assert.NoError(t, err, line) {
+					running = append(running, count)
+				}
+			}
+		}
+	}
+
+	if !assert.Len(t, running, 200, "each call should send the gauge when it starts and when it ends") {
+		return
+	}
+	for i := 1; i < len(running); i++ {
+		if !assert.InDelta(t, running[i-1], running[i], 1, "the gauge should change by one call at a time (value %d)", i) {
+			return
+		}
+	}
+	assert.Equal(t, 0, running[len(running)-1], "the last value of the gauge should be 0")
+}
+
+var errCrash = errors.New("crash")
+
+func panicking(ctx context.Context) (err error) {
+	amCtx := PreInstrument(NewContext(ctx))
+	defer Instrument(amCtx, &err)
+
+	panic(errCrash)
+}
+
+// TestPanic makes sure that Instrument records a panicking call as an error that is not running
+// anymore, and then panics again with the original value.
+func TestPanic(t *testing.T) {
+	agent := listen(t)
+	if _, err := Init(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour)); err != nil {
+		t.Fatalf("initializing autometrics: %s", err)
+	}
+
+	assert.PanicsWithValue(t, errCrash, func() { _ = panicking(context.Background()) })
+	assert.NoError(t, Shutdown(context.Background()))
+
+	packets := receive(t, agent)
+	if !assert.Len(t, packets, 1) {
+		return
+	}
+	var calls, concurrent []string
+	for _, line := range strings.Split(packets[0], "\n") {
+		if !strings.Contains(line, ",function:panicking,") {
+			continue
+		}
+		if strings.HasPrefix(line, "function.calls:") {
+			calls = append(calls, line)
+		}
+		if strings.HasPrefix(line, "function.calls.concurrent:") {
+			concurrent = append(concurrent, line[:strings.Index(line, "|")])
+		}
+	}
+	if assert.Len(t, calls, 1) {
+		assert.True(t, strings.HasPrefix(calls[0], "function.calls:1|c|"), calls[0])
+		assert.Contains(t, calls[0], ",result:error,")
+	}
+	assert.Equal(t, []string{"function.calls.concurrent:1", "function.calls.concurrent:0"}, concurrent)
+}
+
+var errNotFound = errors.New("not found")
+
+// classify reports the canceled calls as successful, and the not found errors with their
+// own result. The other errors get an undeclared result, which is reported as an error.
+func classify(_ context.Context, err error) am.Result {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return am.ResultOk
+	case errors.Is(err, errNotFound):
+		return "not_found"
+	default:
+		return "teapot"
+	}
+}
+
+// classifiedErrors are the errors returned by the calls of the result classifier tests.
+var classifiedErrors = []error{nil, context.Canceled, errNotFound, errNotFound, errors.New("failure")}
+
+func classified(ctx context.Context, a *Autometrics, returned error) (err error) {
+	amCtx := a.PreInstrument(NewContext(ctx))
+	defer a.Instrument(amCtx, &err)
+
+	return returned
+}
+
+// TestResultClassifier makes sure that the result tag has the value returned by the classifier.
+func TestResultClassifier(t *testing.T) {
+	agent := listen(t)
+	a, err := New(WithAddress(agent.LocalAddr().String()), WithFlushPeriod(time.Hour), WithResultClassifier(classify, "not_found"))
+	if err != nil {
+		t.Fatalf("creating the instance: %s", err)
+	}
+	defer a.Cancel(nil)
+
+	for _, returned := range classifiedErrors {
+		_ = classified(context.Background(), a, returned)
+	}
+	assert.NoError(t, a.ForceFlush())
+
+	// The counters are sent for each call, and added up by the agent.
+	calls := make(map[string]int)
+	for _, packet := range receive(t, agent) {
+		for _, line := range strings.Split(packet, "\n") {
+			value, ok := strings.CutPrefix(line, "function.calls:")
+			if !ok {
+				continue
+			}
+			count, err := strconv.Atoi(value[:strings.Index(value, "|")])
+			assert.NoError(t, err)
+			for _, tag := range strings.Split(value[strings.Index(value, "#")+1:], ",") {
+				if result, ok := strings.CutPrefix(tag, "result:"); ok {
+					calls[result] += count
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]int{"ok": 2, "not_found": 2, "error": 1}, calls)
+}
@@ -0,0 +1,83 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// client buffers the lines of the statsd datagrams, and sends them to the agent in UDP packets
+// of at most maxPacketSize bytes.
+type client struct {
+	conn          net.Conn
+	maxPacketSize int
+
+	lock   sync.Mutex
+	buffer []byte
+}
+
+func newClient(address string, maxPacketSize int) (*client, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the statsd agent at %s: %w", address, err)
+	}
+
+	return &client{
+		conn:          conn,
+		maxPacketSize: maxPacketSize,
+		buffer:        make([]byte, 0, maxPacketSize),
+	}, nil
+}
+
+// send adds a line to the buffer, sending the buffer first if the line does not fit in it.
+func (c *client) send(line string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var err error
+	if len(c.buffer) > 0 && len(c.buffer)+1+len(line) > c.maxPacketSize {
+		err = c.flushLocked()
+	}
+
+	if len(c.buffer) > 0 {
+		c.buffer = append(c.buffer, '\n')
+	}
+	c.buffer = append(c.buffer, line...)
+
+	return err
+}
+
+// flush sends the buffered lines to the agent.
+func (c *client) flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.flushLocked()
+}
+
+func (c *client) flushLocked() error {
+	if len(c.buffer) == 0 {
+		return nil
+	}
+
+	_, err := c.conn.Write(c.buffer)
+	c.buffer = c.buffer[:0]
+	if err != nil {
+		return fmt.Errorf("sending metrics to the statsd agent: %w", err)
+	}
+
+	return nil
+}
+
+// close sends the buffered lines and closes the connection to the agent.
+func (c *client) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	flushErr := c.flushLocked()
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("closing the connection to the statsd agent: %w", err)
+	}
+
+	return flushErr
+}
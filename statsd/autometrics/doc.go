@@ -0,0 +1,10 @@
+// Package autometrics implements the automatic metric collection for autometrics using the [StatsD] protocol,
+// with [DogStatsD] tags.
+//
+// The package contains the function implementations for the generated calls, see
+// the main project's [Readme] for more detail.
+//
+// [Readme]: https://github.com/autometrics-dev/autometrics-go
+// [StatsD]: https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// [DogStatsD]: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+package autometrics
@@ -0,0 +1,267 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type initArguments struct {
+	address          string
+	maxPacketSize    int
+	flushPeriod      time.Duration
+	logger           log.Logger
+	commit           string
+	version          string
+	branch           string
+	service          string
+	repoURL          string
+	repoProvider     string
+	resultClassifier am.ResultClassifier
+	extraResults     []am.Result
+	errorKinds       []am.ErrorKind
+	traceIDExtractor am.TraceIDExtractor
+	tracerProvider   trace.TracerProvider
+	recorders        []am.Recorder
+}
+
+func defaultInitArguments() initArguments {
+	return initArguments{
+		address:          DefaultAddress,
+		maxPacketSize:    DefaultMaxPacketSize,
+		flushPeriod:      defaultFlushPeriod,
+		logger:           log.NoOpLogger{},
+		traceIDExtractor: am.OpenTelemetryTraceIDExtractor{},
+	}
+}
+
+func (initArgs initArguments) Validate() error {
+	return nil
+}
+
+type InitOption interface {
+	Apply(*initArguments) error
+}
+
+type initOptionFunc func(*initArguments) error
+
+func (fn initOptionFunc) Apply(initArgs *initArguments) error {
+	return fn(initArgs)
+}
+
+// WithAddress sets the address ("host:port") of the statsd agent to send the metrics to, over UDP.
+//
+// The default value is [DefaultAddress].
+func WithAddress(address string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if address == "" {
+			return errors.New("setting statsd address: the address cannot be empty")
+		}
+		initArgs.address = address
+		return nil
+	})
+}
+
+// WithMaxPacketSize sets the maximum size of the UDP packets sent to the statsd agent. The metrics are
+// buffered until the next flush, or until the buffer reaches this size. A single metric larger than
+// this size is sent in its own packet.
+//
+// The default value is [DefaultMaxPacketSize].
+func WithMaxPacketSize(maxPacketSize int) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if maxPacketSize <= 0 {
+			return errors.New("setting statsd packet size: the maximum packet size must be positive")
+		}
+		initArgs.maxPacketSize = maxPacketSize
+		return nil
+	})
+}
+
+// WithFlushPeriod sets the period at which the buffered metrics are sent to the statsd agent.
+//
+// The default value is 1 second.
+func WithFlushPeriod(flushPeriod time.Duration) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if flushPeriod <= 0 {
+			return errors.New("setting statsd flush period: the flush period must be positive")
+		}
+		initArgs.flushPeriod = flushPeriod
+		return nil
+	})
+}
+
+// WithLogger sets the logger to use when initializing autometrics.
+//
+// The default logger is a no-op logger that will never log
+// autometrics-specific events.
+func WithLogger(logger log.Logger) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.logger = logger
+		return nil
+	})
+}
+
+// WithCommit sets the commit of the codebase to export with the metrics.
+//
+// The default value is an empty string.
+func WithCommit(currentCommit string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.commit = currentCommit
+		return nil
+	})
+}
+
+// WithVersion sets the version of the codebase to export with the metrics.
+//
+// The default value is an empty string.
+func WithVersion(currentVersion string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.version = currentVersion
+		return nil
+	})
+}
+
+// WithBranch sets the name of the branch to export with the metrics.
+//
+// The default value is an empty string.
+func WithBranch(currentBranch string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.branch = currentBranch
+		return nil
+	})
+}
+
+// WithService sets the name of the current service, to export with the metrics.
+//
+// The default value is an empty string.
+func WithService(currentService string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.service = currentService
+		return nil
+	})
+}
+
+// WithRepoURL sets the URL of the repository containing the codebase being instrumented.
+//
+// The default value is an empty string.
+func WithRepoURL(currentRepoURL string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.repoURL = currentRepoURL
+		return nil
+	})
+}
+
+// WithRepoProvider sets the provider of the repository containing the codebase being instrumented.
+//
+// The default value is an empty string.
+func WithRepoProvider(currentRepoProvider string) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.repoProvider = currentRepoProvider
+		return nil
+	})
+}
+
+// WithResultClassifier sets the classifier that decides the result of the function
+// calls that returned a non-nil error.
+//
+// This allows for example to report [context.Canceled] or "not found" errors as
+// [ResultOk], so that they do not count against success rate objectives. The
+// classifier can also return a result of its own, as long as it is listed in
+// extraResults; any other returned result is reported as [ResultError] so that
+// the cardinality of the result label stays bounded.
+//
+// The default is to report all errors as [ResultError].
+func WithResultClassifier(classifier am.ResultClassifier, extraResults ...am.Result) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, extraResult := range extraResults {
+			if extraResult == "" {
+				return errors.New("setting result classifier: the allowed results cannot be empty")
+			}
+		}
+		initArgs.resultClassifier = classifier
+		initArgs.extraResults = extraResults
+		return nil
+	})
+}
+
+// WithErrorKinds enables the error kind label on the function calls counter, and sets the
+// kinds of errors it reports.
+//
+// Errors are matched against the kinds in order, and the first match gives the value of the
+// label. Errors that match no kind are reported as [ErrorKindOther], and panics as
+// [ErrorKindPanic]. Use [ErrorKindIs] and [ErrorKindAs] to build kinds from sentinel errors
+// and error types.
+//
+// The default is to not have any error kind label.
+func WithErrorKinds(kinds ...am.ErrorKind) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, kind := range kinds {
+			if kind.Name == "" || kind.Matches == nil {
+				return errors.New("setting error kinds: all error kinds must have a name and a matcher")
+			}
+			if kind.Name == am.ErrorKindOther || kind.Name == am.ErrorKindPanic {
+				return fmt.Errorf("setting error kinds: %q is a reserved error kind name", kind.Name)
+			}
+		}
+		initArgs.errorKinds = append([]am.ErrorKind{}, kinds...)
+		return nil
+	})
+}
+
+// WithTraceIDExtractor sets the extractor that reads the trace and span IDs of the current
+// span from the context given to instrumented functions. The IDs are used as exemplars, so
+// that exemplars resolve to the traces recorded by the tracer of the application.
+//
+// Passing nil disables the extraction, and autometrics always generates random IDs.
+//
+// The default is to read the OpenTelemetry span context, with [OpenTelemetryTraceIDExtractor].
+func WithTraceIDExtractor(extractor am.TraceIDExtractor) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		initArgs.traceIDExtractor = extractor
+		return nil
+	})
+}
+
+// WithTracerProvider enables span creation: each call to an instrumented function starts
+// a span named after the function with a tracer of the given provider, and ends it with
+// an error status when the call fails. This gives a trace for every instrumented function,
+// and exemplars that always resolve to a span.
+//
+// Passing nil uses the global OpenTelemetry tracer provider, as returned by [otel.GetTracerProvider].
+//
+// The default is to not start any span.
+func WithTracerProvider(provider trace.TracerProvider) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+		initArgs.tracerProvider = provider
+		return nil
+	})
+}
+
+// WithRecorders sets recorders that receive the function calls on top of the metrics of autometrics.
+//
+// Other instances of autometrics are recorders too, which allows to feed several backends with
+// the same instrumented code, for example during a migration from one backend to another:
+// the calls are instrumented, classified and timed once by the instance created with this
+// option, and the other instances record the calls in their own metrics. The result classifier
+// and the error kinds of this instance decide the results and error kinds of the calls.
+//
+// The default is to not have any other recorder.
+func WithRecorders(recorders ...am.Recorder) InitOption {
+	return initOptionFunc(func(initArgs *initArguments) error {
+		for _, recorder := range recorders {
+			if recorder == nil {
+				return errors.New("setting recorders: the recorders cannot be nil")
+			}
+		}
+		initArgs.recorders = append(initArgs.recorders, recorders...)
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+
+import (
+	"context"
+	"time"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+)
+
+// Instrument called in a defer statement wraps the body of a function
+// with automatic instrumentation.
+//
+// The first argument SHOULD be a call to PreInstrument so that
+// the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
+func Instrument(ctx context.Context, err *error) {
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
+	}
+
+	Default().instrument(ctx, err, panicValue)
+}
+
+// Instrument called in a defer statement wraps the body of a function
+// with automatic instrumentation, recorded with the instance.
+//
+// The first argument SHOULD be a call to [Autometrics.PreInstrument] so that
+// the "concurrent calls" gauge is correctly setup.
+//
+// If the instrumented function panics, the call is recorded as an error
+// and the panic is then propagated again.
+func (a *Autometrics) Instrument(ctx context.Context, err *error) {
+	// recover() only stops a panic when called directly by the deferred function,
+	// so this cannot be moved to a helper.
+	panicValue := recover()
+	if panicValue != nil {
+		defer panic(panicValue)
+	}
+
+	a.instrument(ctx, err, panicValue)
+}
+
+func (a *Autometrics) instrument(ctx context.Context, err *error, panicValue any) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	am.EndCall(ctx, err, panicValue, a)
+}
+
+// PreInstrument runs the "before wrappee" part of instrumentation.
+//
+// It is meant to be called as the first argument to Instrument in a
+// defer call.
+func PreInstrument(ctx context.Context) context.Context {
+	return Default().PreInstrument(ctx)
+}
+
+// PreInstrument runs the "before wrappee" part of instrumentation, recorded with the instance.
+//
+// It is meant to be called as the first argument to [Autometrics.Instrument] in a
+// defer call. It returns nil when the instance is not active.
+func (a *Autometrics) PreInstrument(ctx context.Context) context.Context {
+	if a.ctx.Err() != nil {
+		return nil
+	}
+
+	return am.StartCall(ctx, a.config, a)
+}
+
+// RecordStart sets the concurrent calls gauge of the function if needed.
+//
+// It is called by [Autometrics.PreInstrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordStart(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	if call.TrackConcurrentCalls {
+		a.addConcurrentCall(a.config.Snapshot(ctx), call, 1)
+	}
+}
+
+// RecordEnd sends the finished call to the statsd agent.
+//
+// It is called by [Autometrics.Instrument], and allows to use the instance as an
+// [am.Recorder] of another one.
+func (a *Autometrics) RecordEnd(ctx context.Context, call am.FunctionCall) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	config := a.config.Snapshot(ctx)
+	a.send(formatMetric(FunctionCallsCountName, 1, counterType,
+		formatTags(labelNames.CallsCountLabels(config, call))))
+	a.send(formatMetric(FunctionCallsDurationName, float64(call.Duration)/float64(time.Millisecond), timingType,
+		formatTags(labelNames.CallsDurationLabels(config, call))))
+
+	if call.TrackConcurrentCalls {
+		a.addConcurrentCall(config, call, -1)
+	}
+}
+
+// addConcurrentCall adds delta to the running calls of the function, and sends the new value
+// of the concurrent calls gauge.
+//
+// The value is sent while holding the lock, so that the agent receives the values of the gauge in
+// the order they were computed, and keeps the last one.
+func (a *Autometrics) addConcurrentCall(config *am.Config, call am.FunctionCall, delta int64) {
+	tags := formatTags(labelNames.CallsConcurrentLabels(config, call))
+
+	a.concurrentCallsLock.Lock()
+	defer a.concurrentCallsLock.Unlock()
+
+	running := a.concurrentCalls[tags] + delta
+	if running <= 0 {
+		running = 0
+		delete(a.concurrentCalls, tags)
+	} else {
+		a.concurrentCalls[tags] = running
+	}
+
+	a.send(formatMetric(FunctionCallsConcurrentName, float64(running), gaugeType, tags))
+}
@@ -0,0 +1,166 @@
+package autometrics // import "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	"github.com/autometrics-dev/autometrics-go/pkg/autometrics/log"
+)
+
+const (
+	// AutometricsSpecVersion is the version of the specification the library follows
+	// The specifications can be found in https://github.com/autometrics-dev/autometrics-shared/tree/main/specs
+	AutometricsSpecVersion = "1.0.0"
+
+	// FunctionCallsCountName is the name of the statsd counter of calls to specific functions.
+	FunctionCallsCountName = "function.calls"
+	// FunctionCallsDurationName is the name of the statsd timing of the duration of calls to specific functions.
+	FunctionCallsDurationName = "function.calls.duration"
+	// FunctionCallsConcurrentName is the name of the statsd gauge of concurrent calls to specific functions.
+	FunctionCallsConcurrentName = "function.calls.concurrent"
+	// BuildInfoName is the name of the statsd gauge that tracks the build information of the instrumented code.
+	BuildInfoName = "build_info"
+
+	// FunctionLabel is the statsd tag that describes the function name.
+	//
+	// It is guaranteed that a (FunctionLabel, ModuleLabel) value pair is unique
+	// and matches at most one function in the source code
+	FunctionLabel = "function"
+	// ModuleLabel is the statsd tag that describes the module name that contains the function.
+	//
+	// It is guaranteed that a (FunctionLabel, ModuleLabel) value pair is unique
+	// and matches at most one function in the source code
+	ModuleLabel = "module"
+	// CallerFunctionLabel is the statsd tag that describes the name of the function that called
+	// the current function.
+	CallerFunctionLabel = "caller_function"
+	// CallerModuleLabel is the statsd tag that describes the module of the function that called
+	// the current function.
+	CallerModuleLabel = "caller_module"
+	// ResultLabel is the statsd tag that describes whether a function call is successful.
+	ResultLabel = "result"
+	// ErrorKindLabel is the statsd tag that describes the kind of error a function call returned.
+	//
+	// It is only present when error kinds are registered with [WithErrorKinds].
+	ErrorKindLabel = "error_kind"
+	// TargetLatencyLabel is the statsd tag that describes the latency to respect to match
+	// the Service Level Objective.
+	TargetLatencyLabel = "objective_latency_threshold"
+	// TargetSuccessRateLabel is the statsd tag that describes the percentage of calls that
+	// must succeed to match the Service Level Objective.
+	//
+	// In the case of latency objectives, it describes the percentage of
+	// calls that must last less than the value in [TargetLatencyLabel].
+	//
+	// In the case of success objectives, it describes the percentage of calls
+	// that must be successful (i.e. have their [ResultLabel] be 'ok').
+	TargetSuccessRateLabel = "objective_percentile"
+	// SloNameLabel is the statsd tag that describes the name of the Service Level Objective.
+	SloNameLabel = "objective_name"
+
+	// CommitLabel is the statsd tag that describes the commit of the monitored codebase.
+	CommitLabel = "commit"
+	// VersionLabel is the statsd tag that describes the version of the monitored codebase.
+	VersionLabel = "version"
+	// BranchLabel is the statsd tag that describes the branch of the build of the monitored codebase.
+	BranchLabel = "branch"
+
+	// RepositoryURLLabel is the statsd tag that describes the URL at which the repository containing
+	// the monitored service can be found
+	RepositoryURLLabel = "repository_url"
+	// RepositoryProviderLabel is the statsd tag that describes the service provider for the monitored
+	// service repository url
+	RepositoryProviderLabel = "repository_provider"
+
+	// AutometricsVersionLabel is the statsd tag that describes the version of the Autometrics specification
+	// the library follows
+	AutometricsVersionLabel = "autometrics_version"
+
+	// ServiceNameLabel is the statsd tag that describes the name of the service being monitored
+	ServiceNameLabel = "service_name"
+
+	// DefaultAddress is the address of the local statsd agent, as used by the DogStatsD agent.
+	DefaultAddress = "127.0.0.1:8125"
+	// DefaultMaxPacketSize is the maximum size of the UDP packets sent to the agent, which is the
+	// recommended size for networks with the usual MTU of 1500 bytes.
+	DefaultMaxPacketSize = 1432
+	defaultFlushPeriod   = time.Second
+)
+
+// labelNames are the names of the tags of the function calls metrics.
+var labelNames = autometrics.LabelNames{
+	Function:          FunctionLabel,
+	Module:            ModuleLabel,
+	CallerFunction:    CallerFunctionLabel,
+	CallerModule:      CallerModuleLabel,
+	Result:            ResultLabel,
+	ErrorKind:         ErrorKindLabel,
+	TargetLatency:     TargetLatencyLabel,
+	TargetSuccessRate: TargetSuccessRateLabel,
+	SloName:           SloNameLabel,
+	Commit:            CommitLabel,
+	Version:           VersionLabel,
+	Branch:            BranchLabel,
+	Service:           ServiceNameLabel,
+}
+
+// Logger is an interface for logging autometrics-related events.
+//
+// This is a reexport to allow using only the current package at call site.
+type Logger = log.Logger
+
+// This is a reexport to allow using only the current package at call site.
+type PrintLogger = log.PrintLogger
+
+// This is a reexport to allow using only the current package at call site.
+type NoOpLogger = log.NoOpLogger
+
+// Metric types of the statsd protocol.
+const (
+	counterType = "c"
+	timingType  = "ms"
+	gaugeType   = "g"
+)
+
+// tagReplacer replaces the characters that have a meaning in the DogStatsD datagrams.
+var tagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+
+// formatTags formats the tags of a DogStatsD datagram, sorted by name so that series are stable.
+func formatTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(tagReplacer.Replace(name))
+		buf.WriteByte(':')
+		buf.WriteString(tagReplacer.Replace(tags[name]))
+	}
+
+	return buf.String()
+}
+
+// formatMetric formats a DogStatsD datagram line, like "function.calls:1|c|#function:main,result:ok".
+func formatMetric(name string, value float64, metricType string, tags string) string {
+	var buf strings.Builder
+	buf.WriteString(name)
+	buf.WriteByte(':')
+	buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	buf.WriteByte('|')
+	buf.WriteString(metricType)
+	if tags != "" {
+		buf.WriteString("|#")
+		buf.WriteString(tags)
+	}
+
+	return buf.String()
+}
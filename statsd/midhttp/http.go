@@ -0,0 +1,59 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/statsd/midhttp"
+
+import (
+	"context"
+	"net/http"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+	statsd "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+)
+
+// Autometrics wraps a handler with automatic instrumentation.
+//
+// The W3C Trace Context headers ([mid.TraceparentHeader] and [mid.TracestateHeader]) of
+// the incoming request are used to continue the trace of the caller, and can be
+// propagated to outgoing requests with [InjectTraceHeaders]. The [mid.RequestIdHeader]
+// header is only read with the [WithRequestIdHeader] option.
+//
+// The requests are identified by the name of the handler function, or by their method
+// and route pattern with the [WithRoute] option.
+func Autometrics(next http.HandlerFunc, opts ...am.Option) http.HandlerFunc {
+	return mid.Middleware(mid.Instrumenter{PreInstrument: statsd.PreInstrument, Instrument: statsd.Instrument}, next, opts...)
+}
+
+// InjectTraceHeaders sets the tracing headers of an outgoing request made from ctx, so
+// that the exemplars of the called service are connected to the current trace.
+//
+// This is a reexport to allow using only the current package at call site.
+func InjectTraceHeaders(ctx context.Context, header http.Header) {
+	mid.InjectTraceHeaders(ctx, header)
+}
+
+// WithRequestIdHeader makes the middleware read the [mid.RequestIdHeader] header of the
+// incoming requests, to propagate it and to use it as trace ID without a valid traceparent.
+//
+// This is a reexport to allow using only the current package at call site.
+func WithRequestIdHeader() am.Option {
+	return mid.WithRequestIdHeader()
+}
+
+// RouteFunc returns the route pattern that matched a request, or an empty string.
+//
+// This is a reexport to allow using only the current package at call site.
+type RouteFunc = mid.RouteFunc
+
+// WithRoute makes the middleware identify the requests by their HTTP method and route
+// pattern, instead of the name of the handler function.
+//
+// This is a reexport to allow using only the current package at call site.
+func WithRoute(route RouteFunc) am.Option {
+	return mid.WithRoute(route)
+}
+
+// ServeMuxRoute is the [RouteFunc] of the [http.ServeMux] router (since Go 1.22).
+//
+// This is a reexport to allow using only the current package at call site.
+func ServeMuxRoute(r *http.Request) string {
+	return mid.ServeMuxRoute(r)
+}
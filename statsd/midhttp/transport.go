@@ -0,0 +1,22 @@
+package midhttp // import "github.com/autometrics-dev/autometrics-go/statsd/midhttp"
+
+import (
+	"net/http"
+
+	am "github.com/autometrics-dev/autometrics-go/pkg/autometrics"
+	mid "github.com/autometrics-dev/autometrics-go/pkg/midhttp"
+	statsd "github.com/autometrics-dev/autometrics-go/statsd/autometrics"
+)
+
+// Transport wraps a RoundTripper to record each outgoing request as a function call.
+//
+// The function is named after the host and the route template of the request (see
+// [mid.SetRouteTemplate]), unless a name is given with [am.WithFunctionName]. The caller
+// is the instrumented function that made the request, as found in the request context.
+// A request is successful when the response status code is in the valid ranges
+// (see [am.WithValidHttpCodes]), and the trace headers are propagated to the callee.
+//
+// A nil base uses [http.DefaultTransport].
+func Transport(base http.RoundTripper, opts ...am.Option) http.RoundTripper {
+	return mid.Transport(mid.Instrumenter{PreInstrument: statsd.PreInstrument, Instrument: statsd.Instrument}, base, opts...)
+}